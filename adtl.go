@@ -0,0 +1,78 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var ltxt = NewID("ltxt")
+
+// LabeledText is the content of an "ltxt" chunk of an "adtl" LIST, labeling
+// a region of SampleLength samples starting at the cue point CuePointID.
+type LabeledText struct {
+	CuePointID   uint32
+	SampleLength uint32
+	Purpose      ID // For instance "scrp" for a script or "capt" for a caption
+	Country      uint16
+	Language     uint16
+	Dialect      uint16
+	CodePage     uint16
+	Text         string
+}
+
+// LtxtDecoder is a DecoderFunc for "ltxt" chunks that sets Content to a
+// LabeledText.
+func LtxtDecoder(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseLtxt(b)
+}
+
+func parseLtxt(b []byte) (LabeledText, error) {
+	var l LabeledText
+	if len(b) < 20 {
+		return l, fmt.Errorf("ltxt chunk too short: %v bytes", len(b))
+	}
+	l.CuePointID = binary.LittleEndian.Uint32(b)
+	l.SampleLength = binary.LittleEndian.Uint32(b[4:])
+	copy(l.Purpose[:], b[8:12])
+	l.Country = binary.LittleEndian.Uint16(b[12:])
+	l.Language = binary.LittleEndian.Uint16(b[14:])
+	l.Dialect = binary.LittleEndian.Uint16(b[16:])
+	l.CodePage = binary.LittleEndian.Uint16(b[18:])
+	text := b[20:]
+	if i := bytes.IndexByte(text, 0); i >= 0 {
+		text = text[:i]
+	}
+	l.Text = string(text)
+	return l, nil
+}
+
+// LabeledTexts returns the labeled regions found in the tree rooted at c,
+// grouped by the ID of the cue point they start at. Both chunks decoded
+// with LtxtDecoder and raw ones are returned.
+func (c *Chunk) LabeledTexts() (map[uint32][]LabeledText, error) {
+	m := make(map[uint32][]LabeledText)
+	var err error
+	c.walk(func(c *Chunk) {
+		if c.ID != ltxt || err != nil {
+			return
+		}
+		l, ok := c.Content.(LabeledText)
+		if !ok {
+			if l, err = parseLtxt(c.Data); err != nil {
+				return
+			}
+		}
+		m[l.CuePointID] = append(m[l.CuePointID], l)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
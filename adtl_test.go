@@ -0,0 +1,59 @@
+package riff
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func ltxtBytes(cue, length uint32, purpose, text string) []byte {
+	b := []byte{byte(cue), byte(cue >> 8), 0, 0, byte(length), byte(length >> 8), 0, 0}
+	b = append(b, purpose...)
+	b = append(b, 0x31, 0, 0x09, 0, 0x01, 0, 0xe4, 0x04) // US, English, 1252
+	return append(b, text+"\x00"...)
+}
+
+func TestLabeledTexts(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		listBytes("LIST", "adtl",
+			leafBytes("ltxt", ltxtBytes(1, 4410, "capt", "Hello")),
+			leafBytes("labl", []byte{1, 0, 0, 0, 'x', 0}),
+			leafBytes("ltxt", ltxtBytes(2, 100, "scrp", "World")),
+			leafBytes("ltxt", ltxtBytes(1, 200, "scrp", "")),
+		),
+	)
+	exp := map[uint32][]LabeledText{
+		1: {
+			{1, 4410, NewID("capt"), 0x31, 9, 1, 1252, "Hello"},
+			{1, 200, NewID("scrp"), 0x31, 9, 1, 1252, ""},
+		},
+		2: {{2, 100, NewID("scrp"), 0x31, 9, 1, 1252, "World"}},
+	}
+
+	for _, mapped := range []bool{false, true} {
+		d := NewDecoder(bytes.NewReader(b))
+		if mapped {
+			d.Map(NewID("ltxt"), LtxtDecoder)
+		}
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if mapped {
+			if _, ok := c.Chunks[0].Chunks[0].Content.(LabeledText); !ok {
+				t.Errorf("content is %T, expected LabeledText", c.Chunks[0].Chunks[0].Content)
+			}
+		}
+		got, err := c.LabeledTexts()
+		if err != nil {
+			t.Fatalf("LabeledTexts: %v", err)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("mapped %v: got %+v, expected %+v", mapped, got, exp)
+		}
+	}
+
+	if _, err := LtxtDecoder(bytes.NewReader(make([]byte, 19))); err == nil {
+		t.Errorf("expected error for short ltxt")
+	}
+}
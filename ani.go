@@ -0,0 +1,71 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Flags of ANIHeader.
+const (
+	ANIIcon     = 0x1 // Frames are icons or cursors rather than raw bitmaps
+	ANISequence = 0x2 // The file has a "seq " chunk
+)
+
+// ANIHeader is the content of the "anih" chunk of a Windows animated cursor,
+// a RIFF file of form type "ACON". Its frames are the "icon" chunks of the
+// "fram" list, found with FindAll(NewID("icon")).
+type ANIHeader struct {
+	Size     uint32 // Size of the header, 36
+	Frames   uint32 // Number of distinct frames
+	Steps    uint32 // Number of frames shown in one loop of the animation
+	Width    uint32
+	Height   uint32
+	BitCount uint32
+	Planes   uint32
+	Rate     uint32 // Default display time of each step, in 1/60 of a second
+	Flags    uint32
+}
+
+// AnihDecoder is a DecoderFunc for "anih" chunks that sets Content to an
+// ANIHeader.
+func AnihDecoder(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var h ANIHeader
+	if len(b) < binary.Size(h) {
+		return nil, fmt.Errorf("anih chunk too short: %v bytes", len(b))
+	}
+	err = binary.Read(bytes.NewReader(b), binary.LittleEndian, &h)
+	return h, err
+}
+
+// RateDecoder is a DecoderFunc for the "rate" chunks of animated cursors
+// that sets Content to a []uint32 holding the display time of every step,
+// in 1/60 of a second.
+func RateDecoder(r io.Reader) (interface{}, error) {
+	return decodeUint32s(r, "rate")
+}
+
+// SeqDecoder is a DecoderFunc for the "seq " chunks of animated cursors
+// that sets Content to a []uint32 holding the index of the frame shown at
+// every step.
+func SeqDecoder(r io.Reader) (interface{}, error) {
+	return decodeUint32s(r, "seq ")
+}
+
+func decodeUint32s(r io.Reader, id string) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	vs, err := DecodeRecords[uint32](b, binary.LittleEndian)
+	if err != nil {
+		return nil, fmt.Errorf("decode %v: %v", id, err)
+	}
+	return vs, nil
+}
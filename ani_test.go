@@ -0,0 +1,52 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestANI(t *testing.T) {
+	h := ANIHeader{Size: 36, Frames: 2, Steps: 3, Rate: 10, Flags: ANIIcon | ANISequence}
+	anih := new(bytes.Buffer)
+	binary.Write(anih, binary.LittleEndian, h)
+	b := listBytes("RIFF", "ACON",
+		leafBytes("anih", anih.Bytes()),
+		leafBytes("rate", []byte{10, 0, 0, 0, 20, 0, 0, 0, 10, 0, 0, 0}),
+		leafBytes("seq ", []byte{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}),
+		listBytes("LIST", "fram",
+			leafBytes("icon", []byte("first")),
+			leafBytes("icon", []byte("second")),
+		),
+	)
+
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(NewID("anih"), AnihDecoder)
+	d.Map(NewID("rate"), RateDecoder)
+	d.Map(NewID("seq "), SeqDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := c.FindChunk(NewID("anih")).Content; got != h {
+		t.Errorf("anih: got %+v, expected %+v", got, h)
+	}
+	if got, exp := c.FindChunk(NewID("rate")).Content, []uint32{10, 20, 10}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("rate: got %v, expected %v", got, exp)
+	}
+	if got, exp := c.FindChunk(NewID("seq ")).Content, []uint32{0, 1, 0}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("seq: got %v, expected %v", got, exp)
+	}
+	frames := c.FindChunk(NewID("fram")).FindAll(NewID("icon"))
+	if len(frames) != 2 || string(frames[1].Data) != "second" {
+		t.Errorf("got frames %v", frames)
+	}
+
+	if _, err := AnihDecoder(bytes.NewReader(make([]byte, 35))); err == nil {
+		t.Errorf("expected error for a short anih chunk")
+	}
+	if _, err := RateDecoder(bytes.NewReader(make([]byte, 6))); err == nil {
+		t.Errorf("expected error for a partial rate entry")
+	}
+}
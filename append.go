@@ -0,0 +1,151 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// AppendChunk adds child as the last subchunk of the RIFF chunk of the file
+// f, writing it at the end of the file and updating the RIFF length in
+// place, as when tagging a large recording with a LIST chunk without
+// rewriting its samples. The lengths of child must be up to date, as after
+// UpdateLengths, and a leaf whose length doesn't match its data is an
+// error. A pad byte is written first if the RIFF chunk has an odd
+// length.
+//
+// RIFX and RF64 files are supported. A RIFF file growing past 4GiB is
+// converted to RF64, which needs a 28 bytes "JUNK" chunk reserving room for
+// the "ds64" chunk right after the form type, as recording software
+// usually writes. Files holding data after their RIFF chunk are refused, as
+// it would be overwritten.
+func AppendChunk(f io.ReadWriteSeeker, child *Chunk) error {
+	if _, err := child.MaxDepth(); err != nil {
+		return err
+	}
+	if err := child.checkLeafLengths(); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var h [28]byte
+	if _, err := io.ReadFull(f, h[:12]); err != nil {
+		return fmt.Errorf("read RIFF header: %v", err)
+	}
+	id := ID(h[:4])
+	var size int64 // length of the RIFF chunk
+	switch id {
+	case riff:
+		size = int64(binary.LittleEndian.Uint32(h[4:]))
+	case rifx:
+		size = int64(binary.BigEndian.Uint32(h[4:]))
+	case rf64ID:
+		if _, err := io.ReadFull(f, h[12:]); err != nil {
+			return fmt.Errorf("read ds64 chunk: %v", err)
+		}
+		if ID(h[12:16]) != ds64ID {
+			return fmt.Errorf("RF64 file starts with %q instead of a ds64 chunk", h[12:16])
+		}
+		size = int64(binary.LittleEndian.Uint64(h[20:]))
+	default:
+		return fmt.Errorf("not a RIFF file, top-level id is %q", id)
+	}
+
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if end < 8+size {
+		return fmt.Errorf("file of %v bytes is truncated, its RIFF length is %v", end, size)
+	}
+	if end > 8+size+size%2 {
+		return fmt.Errorf("%v bytes follow the RIFF chunk", end-8-size)
+	}
+
+	if _, err := f.Seek(8+size, io.SeekStart); err != nil {
+		return err
+	}
+	w := &writer{w: f, bigEndian: id == rifx}
+	if size%2 != 0 {
+		w.Write([]byte{0})
+	}
+	child.writeTo(w)
+	if w.err != nil {
+		return fmt.Errorf("write %q: %v", child.ID, w.err)
+	}
+	size += w.n
+
+	switch {
+	case id == rf64ID:
+		binary.LittleEndian.PutUint64(h[20:], uint64(size))
+		return writeAt(f, 20, h[20:28])
+	case size <= rf64Limit:
+		if id == rifx {
+			binary.BigEndian.PutUint32(h[4:], uint32(size))
+		} else {
+			binary.LittleEndian.PutUint32(h[4:], uint32(size))
+		}
+		return writeAt(f, 4, h[4:8])
+	case id == rifx:
+		return fmt.Errorf("RIFX chunk of %v bytes is too large for a 32 bit length", size)
+	}
+	return toRF64(f, size)
+}
+
+// toRF64 turns the RIFF file f, whose RIFF chunk is now size bytes long,
+// into an RF64 file by replacing the JUNK chunk following its form type with
+// a ds64 chunk.
+func toRF64(f io.ReadWriteSeeker, size int64) error {
+	if _, err := f.Seek(12, io.SeekStart); err != nil {
+		return err
+	}
+	var h [8]byte
+	if _, err := io.ReadFull(f, h[:]); err != nil {
+		return err
+	}
+	if ID(h[:4]) != NewID("JUNK") || binary.LittleEndian.Uint32(h[4:]) != 28 {
+		return fmt.Errorf("RIFF chunk of %v bytes needs RF64, but has no 28 bytes JUNK chunk to hold its ds64 chunk", size)
+	}
+
+	// Find the length of the data chunk among the headers of the
+	// subchunks.
+	var dataSize uint64
+	for off := int64(12); off < 8+size; {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(f, h[:]); err != nil {
+			return fmt.Errorf("read subchunk header at offset %v: %v", off, err)
+		}
+		l := int64(binary.LittleEndian.Uint32(h[4:]))
+		if ID(h[:4]) == dataID {
+			dataSize = uint64(l)
+			break
+		}
+		off += 8 + l + l%2
+	}
+
+	var ds64 [8 + 28]byte
+	copy(ds64[:], ds64ID[:])
+	binary.LittleEndian.PutUint32(ds64[4:], 28)
+	binary.LittleEndian.PutUint64(ds64[8:], uint64(size))
+	binary.LittleEndian.PutUint64(ds64[16:], dataSize)
+	if err := writeAt(f, 12, ds64[:]); err != nil {
+		return err
+	}
+	var head [8]byte
+	copy(head[:], rf64ID[:])
+	binary.LittleEndian.PutUint32(head[4:], math.MaxUint32)
+	return writeAt(f, 0, head[:])
+}
+
+// writeAt writes b at offset off of f.
+func writeAt(f io.WriteSeeker, off int64, b []byte) error {
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := f.Write(b)
+	return err
+}
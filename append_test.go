@@ -0,0 +1,110 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempFile returns a file holding b, removed at the end of the test.
+func tempFile(t *testing.T, b []byte) *os.File {
+	f, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestAppendChunk(t *testing.T) {
+	tags := &Chunk{ID: list, ListID: info, Len: 16, Chunks: []*Chunk{{ID: NewID("INAM"), Len: 3, Data: []byte("odd")}}}
+	for _, tt := range []struct {
+		name      string
+		file, exp []byte
+	}{
+		{
+			"riff",
+			BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "data", Data: []byte{1, 2}}),
+			BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "data", Data: []byte{1, 2}}, ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("odd")}}}),
+		},
+		{
+			// The last subchunk has an odd length, and neither it nor the
+			// RIFF chunk is padded.
+			"unpadded",
+			BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "data", Data: []byte{1, 2, 3}})[:20+3],
+			BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "data", Data: []byte{1, 2, 3}}, ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("odd")}}}),
+		},
+		{
+			"rifx",
+			BuildRIFX(NewID("WAVE"), ChunkSpec{ID: "data", Data: []byte{1, 2}}),
+			BuildRIFX(NewID("WAVE"), ChunkSpec{ID: "data", Data: []byte{1, 2}}, ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("odd")}}}),
+		},
+	} {
+		if tt.name == "unpadded" {
+			binary.LittleEndian.PutUint32(tt.file[4:], 4+8+3)
+		}
+		f := tempFile(t, tt.file)
+		if err := AppendChunk(f, tags); err != nil {
+			t.Errorf("%v: AppendChunk: %v", tt.name, err)
+			continue
+		}
+		got, _ := ioutil.ReadFile(f.Name())
+		if !bytes.Equal(got, tt.exp) {
+			t.Errorf("%v: got %q, expected %q", tt.name, got, tt.exp)
+		}
+	}
+
+	trailing := tempFile(t, append(BuildRIFF(NewID("WAVE")), "TAG"...))
+	if err := AppendChunk(trailing, tags); err == nil {
+		t.Errorf("expected error appending to a file with trailing data")
+	}
+}
+
+func TestAppendChunkRF64(t *testing.T) {
+	defer func(l int64) { rf64Limit = l }(rf64Limit)
+	rf64Limit = 40
+
+	b := BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "JUNK", Data: make([]byte, 28)}, ChunkSpec{ID: "data", Data: []byte{1, 2}})
+	f := tempFile(t, b)
+	if err := AppendChunk(f, &Chunk{ID: NewID("abcd"), Len: 2, Data: []byte("xy")}); err != nil {
+		t.Fatalf("AppendChunk: %v", err)
+	}
+	got, _ := ioutil.ReadFile(f.Name())
+	if string(got[:4]) != "RF64" || binary.LittleEndian.Uint32(got[4:]) != 0xffffffff || string(got[12:16]) != "ds64" {
+		t.Fatalf("got header %q, expected an RF64 file", got[:16])
+	}
+	if size, data := binary.LittleEndian.Uint64(got[20:]), binary.LittleEndian.Uint64(got[28:]); size != uint64(len(got)-8) || data != 2 {
+		t.Errorf("got ds64 sizes %v and %v, expected %v and 2", size, data, len(got)-8)
+	}
+
+	// Appending to the RF64 file updates the ds64 chunk.
+	if err := AppendChunk(f, &Chunk{ID: NewID("efgh"), Len: 1, Data: []byte("z")}); err != nil {
+		t.Fatalf("AppendChunk to RF64: %v", err)
+	}
+	got, _ = ioutil.ReadFile(f.Name())
+	if size := binary.LittleEndian.Uint64(got[20:]); size != uint64(len(got)-8) || !bytes.HasSuffix(got, []byte("efgh\x01\x00\x00\x00z\x00")) {
+		t.Errorf("got ds64 RIFF size %v for %v bytes, ending with %q", size, len(got), got[len(got)-10:])
+	}
+	c, err := NewDecoder(bytes.NewReader(got)).Decode()
+	if err != nil {
+		t.Fatalf("Decode appended RF64: %v", err)
+	}
+	if c.ID != rf64ID || len(c.Chunks) != 4 || c.Chunks[3].ID != NewID("efgh") {
+		t.Errorf("decoded appended RF64 as %v", c)
+	}
+
+	if err := AppendChunk(f, &Chunk{ID: NewID("ijkl"), Len: 3, Data: []byte("z")}); err == nil {
+		t.Errorf("expected error appending a chunk whose length doesn't match its data")
+	}
+
+	noJunk := tempFile(t, BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "data", Data: make([]byte, 30)}))
+	if err := AppendChunk(noJunk, &Chunk{ID: NewID("abcd"), Len: 2, Data: []byte("xy")}); err == nil {
+		t.Errorf("expected error growing a file past the RF64 limit without a JUNK chunk")
+	}
+}
@@ -0,0 +1,151 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// AVIStreamHeader is the content of an AVI "strh" chunk, which describes one
+// of the streams of the file.
+type AVIStreamHeader struct {
+	Type                ID // "vids", "auds", "txts" or "mids"
+	Handler             ID // Codec used by the stream
+	Flags               uint32
+	Priority            uint16
+	Language            uint16
+	InitialFrames       uint32
+	Scale               uint32
+	Rate                uint32 // Rate / Scale is the number of samples per second
+	Start               uint32
+	Length              uint32 // Length of the stream in units of Rate / Scale
+	SuggestedBufferSize uint32
+	Quality             uint32
+	SampleSize          uint32
+	Frame               struct{ Left, Top, Right, Bottom int16 }
+}
+
+// FrameRate returns the number of samples, or frames for video streams,
+// per second.
+func (h AVIStreamHeader) FrameRate() float64 {
+	if h.Scale == 0 {
+		return 0
+	}
+	return float64(h.Rate) / float64(h.Scale)
+}
+
+// StrhDecoder is a DecoderFunc for "strh" chunks that sets Content to an
+// AVIStreamHeader. Old files omitting the Frame rectangle are accepted.
+func StrhDecoder(r io.Reader) (interface{}, error) {
+	var h AVIStreamHeader
+	b := make([]byte, binary.Size(h))
+	n, err := io.ReadFull(r, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if n < binary.Size(h)-8 {
+		return nil, fmt.Errorf("strh chunk too short: %v bytes: %w", n, io.ErrUnexpectedEOF)
+	}
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// BitmapInfoHeader is the BITMAPINFOHEADER that starts the "strf" chunk of
+// video streams.
+type BitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   ID
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+// ParseBitmapInfoHeader interprets the data of a "strf" chunk of a video
+// stream. The layout of "strf" depends on the Type of the stream declared
+// in the preceding "strh", so no DecoderFunc is provided for it.
+func ParseBitmapInfoHeader(strf []byte) (BitmapInfoHeader, error) {
+	var h BitmapInfoHeader
+	if len(strf) < binary.Size(h) {
+		return h, fmt.Errorf("bitmap info header too short: %v bytes", len(strf))
+	}
+	err := binary.Read(bytes.NewReader(strf), binary.LittleEndian, &h)
+	return h, err
+}
+
+// Flags of AVIIndexEntry.
+const (
+	AVIIndexList     = 0x00000001 // The entry points to a LIST chunk
+	AVIIndexKeyFrame = 0x00000010 // The chunk is a key frame
+	AVIIndexNoTime   = 0x00000100 // The chunk doesn't affect timing
+)
+
+// AVIIndexEntry is an entry of the "idx1" chunk of an AVI file.
+type AVIIndexEntry struct {
+	ChunkID ID
+	Flags   uint32
+	Offset  uint32 // Offset of the chunk, usually from the "movi" form type
+	Size    uint32 // Length of the chunk
+}
+
+// Idx1Decoder is a DecoderFunc for "idx1" chunks that sets Content to a
+// []AVIIndexEntry.
+func Idx1Decoder(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := DecodeRecords[AVIIndexEntry](b, binary.LittleEndian)
+	if err != nil {
+		return nil, fmt.Errorf("decode idx1: %v", err)
+	}
+	return entries, nil
+}
+
+// DmlhChunk is the content of the "dmlh" chunk found in the "odml" LIST of
+// OpenDML AVI files, which are not limited to 1GiB.
+type DmlhChunk struct {
+	TotalFrames uint32 // Frames of the whole file, all RIFF chunks included
+}
+
+// DmlhDecoder is a DecoderFunc for "dmlh" chunks that sets Content to a
+// DmlhChunk. The reserved bytes following TotalFrames are ignored.
+func DmlhDecoder(r io.Reader) (interface{}, error) {
+	var h DmlhChunk
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("read dmlh chunk: %v", err)
+	}
+	return h, nil
+}
+
+// AVIFrameCount returns the number of frames of the AVI file decoded as
+// root. The total of the "dmlh" chunk of OpenDML files is preferred, since
+// the frame count of the "avih" header only counts the frames of the first
+// RIFF chunk of the file.
+func AVIFrameCount(root *Chunk) (uint32, error) {
+	if c := root.FindChunk(hdrlID, NewID("odml"), NewID("dmlh")); c != nil {
+		if h, ok := c.Content.(DmlhChunk); ok {
+			return h.TotalFrames, nil
+		}
+		if len(c.Data) >= 4 {
+			return binary.LittleEndian.Uint32(c.Data), nil
+		}
+	}
+	c := root.FindChunk(hdrlID, avihID)
+	if c == nil {
+		return 0, fmt.Errorf("no avih chunk found")
+	}
+	if len(c.Data) < 20 {
+		return 0, fmt.Errorf("avih chunk too short: %v bytes", len(c.Data))
+	}
+	return binary.LittleEndian.Uint32(c.Data[16:]), nil
+}
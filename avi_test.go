@@ -0,0 +1,116 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestStreamHeaders(t *testing.T) {
+	strh := AVIStreamHeader{Type: NewID("vids"), Handler: NewID("MJPG"), Scale: 1, Rate: 25, Length: 250}
+	strh.Frame.Right, strh.Frame.Bottom = 320, 240
+	bih := BitmapInfoHeader{Size: 40, Width: 320, Height: 240, Planes: 1, BitCount: 24, Compression: NewID("MJPG")}
+
+	var sb, fb bytes.Buffer
+	binary.Write(&sb, binary.LittleEndian, strh)
+	binary.Write(&fb, binary.LittleEndian, bih)
+	b := listBytes("RIFF", "AVI ",
+		listBytes("LIST", "strl",
+			leafBytes("strh", sb.Bytes()),
+			leafBytes("strf", fb.Bytes()),
+		),
+	)
+
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(NewID("strh"), StrhDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	strl := c.Chunks[0]
+	got, ok := strl.Chunks[0].Content.(AVIStreamHeader)
+	if !ok {
+		t.Fatalf("strh content is %T, expected AVIStreamHeader", strl.Chunks[0].Content)
+	}
+	if got != strh {
+		t.Errorf("strh: got %+v, expected %+v", got, strh)
+	}
+	if r := got.FrameRate(); r != 25 {
+		t.Errorf("frame rate: got %v, expected 25", r)
+	}
+
+	gotBih, err := ParseBitmapInfoHeader(strl.Chunks[1].Data)
+	if err != nil {
+		t.Fatalf("ParseBitmapInfoHeader: %v", err)
+	}
+	if gotBih != bih {
+		t.Errorf("strf: got %+v, expected %+v", gotBih, bih)
+	}
+
+	for _, n := range []int{0, 20} {
+		if _, err := StrhDecoder(bytes.NewReader(sb.Bytes()[:n])); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("decoding a strh of %v bytes: got error %v, expected %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+	if _, err := ParseBitmapInfoHeader(fb.Bytes()[:20]); err == nil {
+		t.Errorf("expected error parsing short strf")
+	}
+}
+
+func TestIdx1Decoder(t *testing.T) {
+	exp := []AVIIndexEntry{
+		{NewID("00dc"), AVIIndexKeyFrame, 4, 1000},
+		{NewID("01wb"), 0, 1012, 441},
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, exp)
+
+	got, err := Idx1Decoder(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("Idx1Decoder: %v", err)
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+
+	if _, err := Idx1Decoder(bytes.NewReader(b.Bytes()[:20])); err == nil {
+		t.Errorf("expected error for a partial entry")
+	}
+}
+
+func TestAVIFrameCount(t *testing.T) {
+	avih := make([]byte, 56)
+	binary.LittleEndian.PutUint32(avih[16:], 1000)
+	dmlh := make([]byte, 248)
+	binary.LittleEndian.PutUint32(dmlh, 250000)
+	decode := func(b []byte) *Chunk {
+		d := NewDecoder(bytes.NewReader(b))
+		d.Map(NewID("dmlh"), DmlhDecoder)
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	plain := decode(BuildRIFF(NewID("AVI "), ChunkSpec{ID: "LIST", Form: "hdrl", Chunks: []ChunkSpec{{ID: "avih", Data: avih}}}))
+	if n, err := AVIFrameCount(plain); err != nil || n != 1000 {
+		t.Errorf("avih only: got %v, %v; expected 1000", n, err)
+	}
+	odml := decode(BuildRIFF(NewID("AVI "), ChunkSpec{ID: "LIST", Form: "hdrl", Chunks: []ChunkSpec{
+		{ID: "avih", Data: avih},
+		{ID: "LIST", Form: "odml", Chunks: []ChunkSpec{{ID: "dmlh", Data: dmlh}}},
+	}}))
+	if h := odml.FindChunk(NewID("hdrl"), NewID("odml"), NewID("dmlh")).Content; h != (DmlhChunk{TotalFrames: 250000}) {
+		t.Errorf("got dmlh content %+v", h)
+	}
+	if n, err := AVIFrameCount(odml); err != nil || n != 250000 {
+		t.Errorf("OpenDML: got %v, %v; expected 250000", n, err)
+	}
+	if _, err := AVIFrameCount(&Chunk{ID: riff, ListID: NewID("AVI ")}); err == nil {
+		t.Errorf("expected error without avih")
+	}
+}
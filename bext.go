@@ -0,0 +1,206 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// bextID is the ID of the Broadcast Wave Format extension chunk.
+var bextID = ID{'b', 'e', 'x', 't'}
+
+// bextSize is the length of the fixed fields of a bext chunk.
+const bextSize = 602
+
+// BextChunk is the broadcast audio extension chunk of a Broadcast Wave Format
+// file, as defined by EBU Tech 3285. Text fields are stored NUL padded to
+// their fixed widths, which are noted next to each of them.
+type BextChunk struct {
+	Description         string // 256 bytes
+	Originator          string // 32 bytes
+	OriginatorReference string // 32 bytes
+	OriginationDate     string // 10 bytes, yyyy-mm-dd
+	OriginationTime     string // 8 bytes, hh-mm-ss
+	TimeReference       uint64 // First sample count since midnight
+	Version             uint16
+	UMID                [64]byte // SMPTE UMID
+	// Loudness values in hundredths of LU, LUFS or dBTP, from version 2 on.
+	LoudnessValue        int16
+	LoudnessRange        int16
+	MaxTruePeakLevel     int16
+	MaxMomentaryLoudness int16
+	MaxShortTermLoudness int16
+	CodingHistory        string // Variable length, follows the fixed fields
+}
+
+// textField is a NUL padded fixed width text field.
+type textField struct {
+	s *string
+	n int
+}
+
+// textFields returns the fixed width text fields of b in layout order.
+func (b *BextChunk) textFields() []textField {
+	return []textField{
+		{&b.Description, 256},
+		{&b.Originator, 32},
+		{&b.OriginatorReference, 32},
+		{&b.OriginationDate, 10},
+		{&b.OriginationTime, 8},
+	}
+}
+
+// bextFixed is the layout of the fields of a bext chunk following its text
+// fields.
+type bextFixed struct {
+	TimeReferenceLow, TimeReferenceHigh uint32
+	Version                             uint16
+	UMID                                [64]byte
+	Loudness                            [5]int16
+	Reserved                            [180]byte
+}
+
+// BextDecoder is a DecoderFunc for "bext" chunks that sets Content to a
+// BextChunk.
+func BextDecoder(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < bextSize {
+		return nil, fmt.Errorf("bext chunk too short: %v bytes", len(data))
+	}
+	var b BextChunk
+	br := bytes.NewReader(data)
+	for _, f := range b.textFields() {
+		*f.s, _ = ReadFixedString(br, f.n)
+	}
+	var fixed bextFixed
+	binary.Read(br, binary.LittleEndian, &fixed)
+	b.TimeReference = uint64(fixed.TimeReferenceLow) | uint64(fixed.TimeReferenceHigh)<<32
+	b.Version = fixed.Version
+	b.UMID = fixed.UMID
+	b.LoudnessValue, b.LoudnessRange, b.MaxTruePeakLevel, b.MaxMomentaryLoudness, b.MaxShortTermLoudness =
+		fixed.Loudness[0], fixed.Loudness[1], fixed.Loudness[2], fixed.Loudness[3], fixed.Loudness[4]
+	b.CodingHistory, _ = ReadFixedString(br, br.Len())
+	return b, nil
+}
+
+// BextEncoder is an EncoderFunc for "bext" chunks that serializes a
+// BextChunk, or a pointer to one, into the layout read by BextDecoder. Text
+// fields longer than their fixed widths are an error rather than truncated.
+func BextEncoder(v interface{}) ([]byte, error) {
+	var b BextChunk
+	switch v := v.(type) {
+	case BextChunk:
+		b = v
+	case *BextChunk:
+		b = *v
+	default:
+		return nil, fmt.Errorf("can't encode %T as a bext chunk", v)
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, bextSize+len(b.CodingHistory)))
+	for _, f := range b.textFields() {
+		if len(*f.s) > f.n {
+			return nil, fmt.Errorf("bext field %q is longer than %v bytes", *f.s, f.n)
+		}
+		buf.WriteString(*f.s)
+		buf.Write(make([]byte, f.n-len(*f.s)))
+	}
+	fixed := bextFixed{
+		TimeReferenceLow:  uint32(b.TimeReference),
+		TimeReferenceHigh: uint32(b.TimeReference >> 32),
+		Version:           b.Version,
+		UMID:              b.UMID,
+		Loudness:          [5]int16{b.LoudnessValue, b.LoudnessRange, b.MaxTruePeakLevel, b.MaxMomentaryLoudness, b.MaxShortTermLoudness},
+	}
+	binary.Write(buf, binary.LittleEndian, fixed)
+	buf.WriteString(b.CodingHistory)
+	return buf.Bytes(), nil
+}
+
+// Formats of the peak envelope in a LevlChunk.
+const (
+	LevlFormat8Bit  = 1
+	LevlFormat16Bit = 2
+)
+
+// LevlChunk is the content of a "levl" chunk, the peak envelope of a
+// Broadcast Wave Format file defined by EBU Tech 3285 supplement 3, which
+// lets editors draw waveforms without reading the samples.
+type LevlChunk struct {
+	Version        uint32
+	Format         uint32 // LevlFormat8Bit or LevlFormat16Bit
+	PointsPerValue uint32 // 1 for positive peaks only, 2 for positive and negative
+	BlockSize      uint32 // Audio frames per peak frame
+	PeakChannels   uint32
+	PeakFrames     uint32
+	PosPeakOfPeaks uint32 // Frame of the highest peak, or 0xffffffff if unknown
+	Timestamp      string // Creation time, "yyyy:mm:dd:hh:mm:ss:uuu"
+	// Peaks holds PeakFrames peak frames of PeakChannels channels of
+	// PointsPerValue little endian values of the given Format each.
+	Peaks []byte
+}
+
+// levlHeaderSize is the length of the header of a levl chunk, beyond which
+// its peak envelope starts.
+const levlHeaderSize = 120
+
+// LevlDecoder is a DecoderFunc for "levl" chunks that sets Content to a
+// LevlChunk.
+func LevlDecoder(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < levlHeaderSize {
+		return nil, fmt.Errorf("levl chunk too short: %v bytes", len(data))
+	}
+	var l LevlChunk
+	for i, v := range []*uint32{&l.Version, &l.Format, &l.PointsPerValue, &l.BlockSize, &l.PeakChannels, &l.PeakFrames, &l.PosPeakOfPeaks} {
+		*v = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	// The offset to the peaks is counted from the start of the chunk header.
+	off := int64(binary.LittleEndian.Uint32(data[28:])) - 8
+	if off < levlHeaderSize || off > int64(len(data)) {
+		return nil, fmt.Errorf("invalid levl peaks offset %v", off+8)
+	}
+	l.Timestamp, _ = ReadFixedString(bytes.NewReader(data[32:60]), 28)
+	l.Peaks = data[off:]
+	return l, nil
+}
+
+// Flags of MpegExtChunk.SoundInformation.
+const (
+	MextHomogeneous = 0x1 // All frames have the same format and size
+	MextNoPadding   = 0x2 // Frames don't use the padding bit
+	MextPaddedRate  = 0x4 // Frames at 22.05 or 44.1 kHz use the padding bit
+	MextFreeFormat  = 0x8 // Frames are in free format
+)
+
+// MpegExtChunk is the content of a "mext" chunk, describing the MPEG audio
+// of a Broadcast Wave Format file with format tag WaveFormatMPEGLayer3 or
+// MPEG, as defined by EBU Tech 3285 supplement 1.
+type MpegExtChunk struct {
+	SoundInformation    uint16
+	FrameSize           uint16 // Bytes per frame, if MextHomogeneous is set
+	AncillaryDataLength uint16 // Bytes of ancillary data per frame
+	AncillaryDataDef    uint16 // Kind of ancillary data
+}
+
+// MextDecoder is a DecoderFunc for "mext" chunks that sets Content to an
+// MpegExtChunk. The 4 reserved bytes closing the 12 byte chunk are ignored.
+func MextDecoder(r io.Reader) (interface{}, error) {
+	var b [12]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, fmt.Errorf("mext chunk too short: %v", err)
+	}
+	return MpegExtChunk{
+		SoundInformation:    binary.LittleEndian.Uint16(b[0:]),
+		FrameSize:           binary.LittleEndian.Uint16(b[2:]),
+		AncillaryDataLength: binary.LittleEndian.Uint16(b[4:]),
+		AncillaryDataDef:    binary.LittleEndian.Uint16(b[6:]),
+	}, nil
+}
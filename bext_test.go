@@ -0,0 +1,136 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBextRoundTrip(t *testing.T) {
+	b := BextChunk{
+		Description:         "Interview, take 3",
+		Originator:          "riff",
+		OriginatorReference: "USRIFF000000001",
+		OriginationDate:     "2024-03-01",
+		OriginationTime:     "12-30-00",
+		TimeReference:       1<<32 + 48000,
+		Version:             2,
+		LoudnessValue:       -2300,
+		MaxTruePeakLevel:    -100,
+		CodingHistory:       "A=PCM,F=48000,W=24,M=mono,T=riff\r\n",
+	}
+	b.UMID[0] = 0x06
+	root := &Chunk{
+		ID:     NewID("RIFF"),
+		ListID: NewID("WAVE"),
+		Chunks: []*Chunk{
+			{ID: NewID("bext"), Content: &b},
+			{ID: NewID("data"), Len: 2, Data: []byte{1, 2}},
+		},
+	}
+	root.updateLen()
+
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf)
+	if err := e.Map(NewID("bext"), BextEncoder); err != nil {
+		t.Fatalf("Map: %v", err)
+	}
+	if err := e.Encode(root); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := Validate(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if root.Chunks[0].Data != nil || root.Len != 4+8+8+2 {
+		t.Errorf("Encode modified the tree")
+	}
+
+	d := NewDecoder(bytes.NewReader(buf.Bytes()))
+	d.Map(NewID("bext"), BextDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	bc := c.FindChunk(NewID("bext"))
+	if bc == nil {
+		t.Fatalf("no bext chunk in %v", c)
+	}
+	if exp := uint32(602 + len(b.CodingHistory)); bc.Len != exp {
+		t.Errorf("bext length: got %v, expected %v", bc.Len, exp)
+	}
+	desc := bc.Data[:256]
+	if !bytes.HasPrefix(desc, []byte(b.Description)) || strings.Trim(string(desc[len(b.Description):]), "\x00") != "" {
+		t.Errorf("description isn't NUL padded: %q", desc)
+	}
+	if got := bc.Data[338:346]; !bytes.Equal(got, []byte{0x80, 0xbb, 0, 0, 1, 0, 0, 0}) {
+		t.Errorf("time reference: got % x", got)
+	}
+	if !reflect.DeepEqual(bc.Content, b) {
+		t.Errorf("got %+v, expected %+v", bc.Content, b)
+	}
+}
+
+func TestBextEncoderErrors(t *testing.T) {
+	if _, err := BextEncoder(BextChunk{OriginationDate: "1 March 2024"}); err == nil {
+		t.Errorf("expected error for a field longer than its width")
+	}
+	if _, err := BextEncoder("bext"); err == nil {
+		t.Errorf("expected error for a non BextChunk value")
+	}
+	if _, err := BextDecoder(bytes.NewReader(make([]byte, 601))); err == nil {
+		t.Errorf("expected error for a short bext chunk")
+	}
+}
+
+func TestLevlDecoder(t *testing.T) {
+	b := make([]byte, 120, 124)
+	for i, v := range []uint32{1, LevlFormat8Bit, 2, 256, 1, 2, 0xffffffff, 128} {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	copy(b[32:], "2024:03:01:12:30:00:000")
+	b = append(b, 100, 90, 80, 120)
+
+	got, err := LevlDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("LevlDecoder: %v", err)
+	}
+	exp := LevlChunk{
+		Version:        1,
+		Format:         LevlFormat8Bit,
+		PointsPerValue: 2,
+		BlockSize:      256,
+		PeakChannels:   1,
+		PeakFrames:     2,
+		PosPeakOfPeaks: 0xffffffff,
+		Timestamp:      "2024:03:01:12:30:00:000",
+		Peaks:          []byte{100, 90, 80, 120},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+
+	if _, err := LevlDecoder(bytes.NewReader(b[:119])); err == nil {
+		t.Errorf("expected error for a short levl chunk")
+	}
+	binary.LittleEndian.PutUint32(b[28:], 200)
+	if _, err := LevlDecoder(bytes.NewReader(b)); err == nil {
+		t.Errorf("expected error for peaks past the end of the chunk")
+	}
+}
+
+func TestMextDecoder(t *testing.T) {
+	b := []byte{0x03, 0, 0xa1, 0x01, 2, 0, 1, 0, 0, 0, 0, 0}
+	got, err := MextDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("MextDecoder: %v", err)
+	}
+	exp := MpegExtChunk{SoundInformation: MextHomogeneous | MextNoPadding, FrameSize: 417, AncillaryDataLength: 2, AncillaryDataDef: 1}
+	if got != exp {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+	if _, err := MextDecoder(bytes.NewReader(b[:8])); err == nil {
+		t.Errorf("expected error for a short mext chunk")
+	}
+}
@@ -0,0 +1,116 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// ChunkSpec describes a chunk generated by BuildRIFF: a LIST chunk holding
+// Chunks if Form is set, or a leaf holding Data otherwise.
+type ChunkSpec struct {
+	ID     string
+	Data   []byte
+	Form   string
+	Chunks []ChunkSpec
+}
+
+// BuildRIFF returns a little endian RIFF file of the given form type
+// holding the chunks described by spec, with correct lengths and pad bytes.
+func BuildRIFF(form ID, spec ...ChunkSpec) []byte {
+	return ChunkSpec{ID: "RIFF", Form: form.String(), Chunks: spec}.build(binary.LittleEndian)
+}
+
+// BuildRIFX is like BuildRIFF for a big endian RIFX file.
+func BuildRIFX(form ID, spec ...ChunkSpec) []byte {
+	return ChunkSpec{ID: "RIFX", Form: form.String(), Chunks: spec}.build(binary.BigEndian)
+}
+
+func (s ChunkSpec) build(order binary.ByteOrder) []byte {
+	body := s.Data
+	if s.Form != "" {
+		body = []byte(s.Form)
+		for _, c := range s.Chunks {
+			body = append(body, c.build(order)...)
+		}
+	}
+	b := append([]byte(s.ID), 0, 0, 0, 0)
+	order.PutUint32(b[4:], uint32(len(body)))
+	b = append(b, body...)
+	if len(body)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// nested returns depth LIST chunks nested in each other around leaf.
+func nested(depth int, leaf ChunkSpec) ChunkSpec {
+	if depth == 0 {
+		return leaf
+	}
+	return ChunkSpec{ID: "LIST", Form: "nest", Chunks: []ChunkSpec{nested(depth-1, leaf)}}
+}
+
+func TestBuildRIFF(t *testing.T) {
+	got := BuildRIFF(NewID("WAVE"),
+		ChunkSpec{ID: "fmt ", Data: make([]byte, 16)},
+		ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("odd")}}},
+		ChunkSpec{ID: "data"},
+	)
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("odd"))),
+		leafBytes("data", nil),
+	)
+	if !bytes.Equal(got, exp) {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+
+	if got, exp := BuildRIFX(NewID("XFIR"), ChunkSpec{ID: "abcd", Data: []byte{1}}), []byte("RIFX\x00\x00\x00\x0eXFIRabcd\x00\x00\x00\x01\x01\x00"); !bytes.Equal(got, exp) {
+		t.Errorf("RIFX: got %q, expected %q", got, exp)
+	}
+}
+
+func TestGeneratedEdgeCases(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file []byte
+	}{
+		{"odd lengths", BuildRIFF(NewID("WAVE"),
+			ChunkSpec{ID: "odd1", Data: []byte{1}},
+			ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("abc")}}},
+			ChunkSpec{ID: "odd5", Data: []byte{1, 2, 3, 4, 5}},
+		)},
+		{"zero length data", BuildRIFF(NewID("WAVE"),
+			ChunkSpec{ID: "fmt ", Data: make([]byte, 16)},
+			ChunkSpec{ID: "data"},
+		)},
+		{"empty list", BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "LIST", Form: "INFO"})},
+		{"deeply nested", BuildRIFF(NewID("TEST"), nested(100, ChunkSpec{ID: "leaf", Data: []byte("deep")}))},
+	} {
+		c, err := NewDecoder(bytes.NewReader(tt.file)).Decode()
+		if err != nil {
+			t.Errorf("%v: Decode: %v", tt.name, err)
+			continue
+		}
+		if err := Validate(bytes.NewReader(tt.file)); err != nil {
+			t.Errorf("%v: Validate: %v", tt.name, err)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := c.WriteTo(buf); err != nil {
+			t.Errorf("%v: WriteTo: %v", tt.name, err)
+		} else if !bytes.Equal(buf.Bytes(), tt.file) {
+			t.Errorf("%v: round trip: got %q, expected %q", tt.name, buf.Bytes(), tt.file)
+		}
+	}
+
+	file := BuildRIFF(NewID("WAVE"), ChunkSpec{ID: "data", Data: []byte{1, 2}})
+	trailing := append(append([]byte{}, file...), "garbage"...)
+	d := NewDecoder(bytes.NewReader(trailing))
+	if _, err := d.Decode(); err != nil {
+		t.Errorf("trailing bytes: Decode: %v", err)
+	}
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("trailing bytes: expected error decoding them")
+	}
+}
@@ -0,0 +1,85 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// cartSize is the length of the fixed fields of a cart chunk.
+const cartSize = 2048
+
+// CartTimer is a timer of a cart chunk, marking a position in the audio.
+type CartTimer struct {
+	Usage ID     // Kind of timer, such as "SEG1" or "INT ", or zeros if unused
+	Value uint32 // Position in samples from the start of the audio
+}
+
+// CartChunk is the cart chunk used by radio automation systems, as defined
+// by AES46. Text fields have their NUL and space padding removed.
+type CartChunk struct {
+	Version            string // Four digits, "0101" for version 1.01
+	Title              string
+	Artist             string
+	CutID              string
+	ClientID           string
+	Category           string
+	Classification     string
+	OutCue             string
+	StartDate          string // yyyy/mm/dd
+	StartTime          string // hh:mm:ss
+	EndDate            string
+	EndTime            string
+	ProducerAppID      string
+	ProducerAppVersion string
+	UserDef            string
+	LevelReference     int32 // Sample value of 0 dB reference
+	PostTimers         [8]CartTimer
+	URL                string
+	TagText            string // Variable length, follows the fixed fields
+}
+
+// CartDecoder is a DecoderFunc for "cart" chunks that sets Content to a
+// CartChunk.
+func CartDecoder(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < cartSize {
+		return nil, fmt.Errorf("cart chunk too short: %v bytes", len(data))
+	}
+	var c CartChunk
+	r = bytes.NewReader(data)
+	for _, f := range []textField{
+		{&c.Version, 4},
+		{&c.Title, 64},
+		{&c.Artist, 64},
+		{&c.CutID, 64},
+		{&c.ClientID, 64},
+		{&c.Category, 64},
+		{&c.Classification, 64},
+		{&c.OutCue, 64},
+		{&c.StartDate, 10},
+		{&c.StartTime, 8},
+		{&c.EndDate, 10},
+		{&c.EndTime, 8},
+		{&c.ProducerAppID, 64},
+		{&c.ProducerAppVersion, 64},
+		{&c.UserDef, 64},
+	} {
+		*f.s, _ = ReadFixedString(r, f.n)
+	}
+	var fixed struct {
+		LevelReference int32
+		PostTimers     [8]CartTimer
+		Reserved       [276]byte
+	}
+	binary.Read(r, binary.LittleEndian, &fixed)
+	c.LevelReference, c.PostTimers = fixed.LevelReference, fixed.PostTimers
+	c.URL, _ = ReadFixedString(r, 1024)
+	c.TagText, _ = ReadFixedString(r, len(data)-cartSize)
+	return c, nil
+}
@@ -0,0 +1,61 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCartDecoder(t *testing.T) {
+	b := make([]byte, 2048, 2048+6)
+	copy(b[0:], "0101")
+	copy(b[4:], "Morning jingle")
+	copy(b[68:], "The Band")
+	copy(b[132:], "CUT-042")
+	copy(b[452:], "2024/03/01")
+	copy(b[462:], "06:00:00")
+	copy(b[488:], "riff")
+	binary.LittleEndian.PutUint32(b[680:], uint32(32768))
+	copy(b[684:], "SEG1")
+	binary.LittleEndian.PutUint32(b[688:], 48000)
+	copy(b[692:], "INT ")
+	binary.LittleEndian.PutUint32(b[696:], 96000)
+	copy(b[1024:], "https://example.com/cut/42")
+	b = append(b, "tag\r\n\x00"...)
+
+	v, err := CartDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("CartDecoder: %v", err)
+	}
+	c, ok := v.(CartChunk)
+	if !ok {
+		t.Fatalf("got content of type %T, expected CartChunk", v)
+	}
+	for _, f := range []struct{ name, got, exp string }{
+		{"Version", c.Version, "0101"},
+		{"Title", c.Title, "Morning jingle"},
+		{"Artist", c.Artist, "The Band"},
+		{"CutID", c.CutID, "CUT-042"},
+		{"ClientID", c.ClientID, ""},
+		{"StartDate", c.StartDate, "2024/03/01"},
+		{"StartTime", c.StartTime, "06:00:00"},
+		{"ProducerAppID", c.ProducerAppID, "riff"},
+		{"URL", c.URL, "https://example.com/cut/42"},
+		{"TagText", c.TagText, "tag\r\n"},
+	} {
+		if f.got != f.exp {
+			t.Errorf("%v: got %q, expected %q", f.name, f.got, f.exp)
+		}
+	}
+	if c.LevelReference != 32768 {
+		t.Errorf("LevelReference: got %v, expected 32768", c.LevelReference)
+	}
+	exp := [8]CartTimer{{NewID("SEG1"), 48000}, {NewID("INT "), 96000}}
+	if c.PostTimers != exp {
+		t.Errorf("PostTimers: got %v, expected %v", c.PostTimers, exp)
+	}
+
+	if _, err := CartDecoder(bytes.NewReader(b[:2047])); err == nil {
+		t.Errorf("expected error for a short cart chunk")
+	}
+}
@@ -0,0 +1,67 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// chnaEntrySize is the length of every audio ID entry of a chna chunk.
+const chnaEntrySize = 40
+
+// ChnaChunk is the content of a "chna" chunk, which maps the tracks of a
+// multichannel Broadcast Wave Format file to the audio track UIDs of its ADM
+// metadata, as defined by ITU-R BS.2076.
+type ChnaChunk struct {
+	NumTracks uint16 // Number of tracks used
+	AudioIDs  []ChnaAudioID
+}
+
+// ChnaAudioID maps a track to an audio track UID of the ADM metadata.
+type ChnaAudioID struct {
+	TrackIndex uint16 // Index of the track, from 1
+	UID        string // 12 bytes, as "ATU_00000001"
+	TrackRef   string // 14 bytes, as "AT_00031001_01"
+	PackRef    string // 11 bytes, as "AP_00031001"
+}
+
+// ChnaDecoder is a DecoderFunc for "chna" chunks that sets Content to a
+// ChnaChunk.
+func ChnaDecoder(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("chna chunk too short: %v bytes", len(data))
+	}
+	c := ChnaChunk{NumTracks: binary.LittleEndian.Uint16(data)}
+	n := int(binary.LittleEndian.Uint16(data[2:]))
+	data = data[4:]
+	if len(data) < n*chnaEntrySize {
+		return nil, fmt.Errorf("chna chunk has room for %v of its %v audio IDs", len(data)/chnaEntrySize, n)
+	}
+	c.AudioIDs = make([]ChnaAudioID, n)
+	for i := range c.AudioIDs {
+		e := bytes.NewReader(data[i*chnaEntrySize:])
+		id := &c.AudioIDs[i]
+		binary.Read(e, binary.LittleEndian, &id.TrackIndex)
+		id.UID, _ = ReadFixedString(e, 12)
+		id.TrackRef, _ = ReadFixedString(e, 14)
+		id.PackRef, _ = ReadFixedString(e, 11)
+	}
+	return c, nil
+}
+
+// IXMLDecoder is a DecoderFunc for "iXML" chunks that sets Content to their
+// XML document as a string, trailing NUL padding removed, for the caller to
+// parse with encoding/xml.
+func IXMLDecoder(r io.Reader) (interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes.TrimRight(data, "\x00")), nil
+}
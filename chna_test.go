@@ -0,0 +1,42 @@
+package riff
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestChnaDecoder(t *testing.T) {
+	b := []byte{2, 0, 2, 0}
+	for _, e := range []string{
+		"\x01\x00ATU_00000001AT_00031001_01AP_00031001\x00",
+		"\x02\x00ATU_00000002AT_00031002_01AP_00031001\x00",
+	} {
+		b = append(b, e...)
+	}
+	v, err := ChnaDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ChnaDecoder: %v", err)
+	}
+	exp := ChnaChunk{NumTracks: 2, AudioIDs: []ChnaAudioID{
+		{1, "ATU_00000001", "AT_00031001_01", "AP_00031001"},
+		{2, "ATU_00000002", "AT_00031002_01", "AP_00031001"},
+	}}
+	if !reflect.DeepEqual(v, exp) {
+		t.Errorf("got %+v, expected %+v", v, exp)
+	}
+
+	if _, err := ChnaDecoder(bytes.NewReader(b[:len(b)-1])); err == nil {
+		t.Errorf("expected error for truncated audio IDs")
+	}
+	if _, err := ChnaDecoder(bytes.NewReader(b[:3])); err == nil {
+		t.Errorf("expected error for truncated header")
+	}
+}
+
+func TestIXMLDecoder(t *testing.T) {
+	v, err := IXMLDecoder(bytes.NewReader([]byte("<BWFXML><PROJECT>p</PROJECT></BWFXML>\x00\x00")))
+	if err != nil || v != "<BWFXML><PROJECT>p</PROJECT></BWFXML>" {
+		t.Errorf("got %q, %v", v, err)
+	}
+}
@@ -0,0 +1,243 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Severity tells how serious an Issue is.
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // Deviation from the spec most readers accept
+	SeverityError                   // Violation of the spec readers may fail on
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Issue is a problem found by ConformanceReport.
+type Issue struct {
+	Severity Severity
+	Path     string // IDs from the root to the chunk, ListIDs for containers, separated by "/"
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%v: %v: %v", i.Path, i.Severity, i.Message)
+}
+
+// requiredChunks are the chunks, by ID or ListID, that a RIFF of the given
+// form type must hold.
+var requiredChunks = map[ID][]ID{
+	wave:    {fmtID, dataID},
+	aviForm: {hdrlID, moviID},
+}
+
+// ConformanceReport checks the tree rooted at c against the RIFF spec and
+// returns every issue found, in tree order, or nil if there is none. It
+// checks that the top-level chunk is a RIFF or RIFX chunk, that IDs and
+// form types are printable ASCII, that leaves have no subchunks and a
+// length matching their data, that containers have no data and a length
+// matching their subchunks, as CheckContainerLength does, that every chunk
+// is word aligned once written, as VerifyAlignment does, and that WAVE and
+// AVI files hold the chunks they require, in the required order.
+func (c *Chunk) ConformanceReport() []Issue {
+	r := &conformance{}
+	if _, err := c.MaxDepth(); err != nil {
+		r.add(SeverityError, c.name().String(), "%v", err)
+		return r.issues
+	}
+	if c.ID != riff && c.ID != rifx {
+		r.add(SeverityError, c.name().String(), "top-level id %q is neither RIFF nor RIFX", c.ID)
+	}
+	r.check(c, nil, 0, 0)
+	return r.issues
+}
+
+type conformance struct {
+	issues []Issue
+}
+
+func (r *conformance) add(s Severity, path string, format string, args ...interface{}) {
+	r.issues = append(r.issues, Issue{s, path, fmt.Sprintf(format, args...)})
+}
+
+// check checks c, written at offset off, nested depth containers deep
+// under the containers of the given path, and returns the offset
+// following it.
+func (r *conformance) check(c *Chunk, path []string, depth int, off int64) int64 {
+	path = append(path, c.name().String())
+	p := strings.Join(path, "/")
+
+	if off%2 != 0 {
+		r.add(SeverityError, p, "chunk at offset %v is not word aligned", off)
+	}
+	if !printable(c.ID) {
+		r.add(SeverityError, p, "id %q is not printable ASCII", c.ID)
+	}
+
+	if !c.IsContainer() {
+		if len(c.Chunks) > 0 {
+			r.add(SeverityError, p, "leaf %q has %v subchunks", c.ID, len(c.Chunks))
+		}
+		if n := c.dataLen(); (c.Data != nil || c.section != nil) && n != int64(c.Len) {
+			r.add(SeverityError, p, "length %v doesn't match the %v bytes of data", c.Len, n)
+		}
+		return off + 8 + c.dataLen() + int64(c.Len%2)
+	}
+
+	if !printable(c.ListID) {
+		r.add(SeverityError, p, "form type %q is not printable ASCII", c.ListID)
+	}
+	if depth > 0 && c.ID != list {
+		r.add(SeverityWarning, p, "%q chunk nested in a container, only LIST chunks should be", c.ID)
+	}
+	if len(c.Data) > 0 {
+		r.add(SeverityError, p, "container %q has %v bytes of data", c.ID, len(c.Data))
+	}
+	exp := int64(4)
+	for _, sc := range c.Chunks {
+		exp += 8 + int64(sc.Len) + int64(sc.Len%2)
+	}
+	if int64(c.Len) != exp {
+		r.add(SeverityError, p, "length %v doesn't match the %v bytes of its form type and subchunks", c.Len, exp)
+	}
+	if depth == 0 {
+		r.checkForm(c, p)
+	}
+
+	off += 12
+	for _, sc := range c.Chunks {
+		off = r.check(sc, path, depth+1, off)
+	}
+	return off
+}
+
+// checkForm checks that the top-level chunk c has the chunks its form type
+// requires.
+func (r *conformance) checkForm(c *Chunk, p string) {
+	for _, id := range requiredChunks[c.ListID] {
+		if c.FindChunk(id) == nil {
+			r.add(SeverityError, p, "missing %q chunk required in %q files", id, c.ListID)
+		}
+	}
+	if c.ListID == wave {
+		if d, f := c.index(dataID), c.index(fmtID); d >= 0 && f > d {
+			r.add(SeverityError, p, "%q chunk after the %q chunk", fmtID, dataID)
+		}
+	}
+}
+
+// ValidateWAVE checks that the "fmt ", "fact" and "data" chunks of the WAVE
+// file c agree with each other, beyond the structure ConformanceReport
+// checks, and returns every issue found, or nil if there is none. It checks
+// that cbSize matches the length of the fmt chunk, that formats other than
+// PCM have a fact chunk, and that for PCM and IEEE float BlockAlign is the
+// size of a frame, ByteRate is SampleRate frames, and the data holds whole
+// frames. The length of compressed data can't be checked against the fact
+// chunk, as it depends on the codec.
+func (c *Chunk) ValidateWAVE() []Issue {
+	r := &conformance{}
+	if c.ID != riff || c.ListID != wave {
+		r.add(SeverityError, c.name().String(), "not a WAVE file: %q form %q", c.ID, c.ListID)
+		return r.issues
+	}
+	fc := c.leaf(fmtID)
+	if fc == nil {
+		r.add(SeverityError, "WAVE", "missing %q chunk", fmtID)
+		return r.issues
+	}
+	p := "WAVE/fmt "
+	b, err := fc.loadedData()
+	if err != nil {
+		r.add(SeverityError, p, "%v", err)
+		return r.issues
+	}
+	switch {
+	case len(b) < 16:
+		r.add(SeverityError, p, "fmt chunk of %v bytes is shorter than the 16 bytes of its fixed fields", len(b))
+		return r.issues
+	case len(b) == 17:
+		r.add(SeverityError, p, "fmt chunk of 17 bytes ends in the middle of cbSize")
+		return r.issues
+	case len(b) >= 18:
+		cb := int(binary.LittleEndian.Uint16(b[16:]))
+		if n := len(b) - 18; cb > n {
+			r.add(SeverityError, p, "cbSize %v overruns the fmt chunk by %v bytes", cb, cb-n)
+			return r.issues
+		} else if cb < n {
+			r.add(SeverityWarning, p, "%v bytes following the %v extra format bytes of cbSize", n-cb, cb)
+		}
+	}
+	v, err := WaveFmtDecoder(bytes.NewReader(b))
+	if err != nil {
+		r.add(SeverityError, p, "%v", err)
+		return r.issues
+	}
+	f := v.(WaveFmt)
+	format := f.Format()
+
+	if f.Channels == 0 {
+		r.add(SeverityError, p, "no channels")
+	}
+	if f.BlockAlign == 0 {
+		r.add(SeverityError, p, "BlockAlign is 0")
+	}
+	pcm := format == WaveFormatPCM || format == WaveFormatIEEEFloat
+	if pcm {
+		if frame := uint32(f.Channels) * ((uint32(f.BitsPerSample) + 7) / 8); uint32(f.BlockAlign) != frame {
+			r.add(SeverityError, p, "BlockAlign %v doesn't match the %v bytes of %v channels of %v bits", f.BlockAlign, frame, f.Channels, f.BitsPerSample)
+		}
+		if rate := uint64(f.SampleRate) * uint64(f.BlockAlign); uint64(f.ByteRate) != rate {
+			r.add(SeverityError, p, "ByteRate %v doesn't match the %v bytes per second of %v frames of %v bytes", f.ByteRate, rate, f.SampleRate, f.BlockAlign)
+		}
+	}
+	if f.FormatTag == WaveFormatExtensible && f.ValidBitsPerSample > f.BitsPerSample {
+		r.add(SeverityError, p, "%v valid bits in samples of %v bits", f.ValidBitsPerSample, f.BitsPerSample)
+	}
+
+	if format != WaveFormatPCM {
+		if len(b) < 18 {
+			r.add(SeverityWarning, p, "fmt chunk of format %#x has no cbSize field", format)
+		}
+		if fact := c.leaf(factID); fact == nil {
+			r.add(SeverityError, "WAVE", "missing %q chunk required for format %#x", factID, format)
+		} else if n := fact.dataLen(); fact.loaded() && n < 4 {
+			r.add(SeverityError, "WAVE/fact", "fact chunk of %v bytes has no room for a sample count", n)
+		}
+	}
+
+	data := c.leaf(dataID)
+	if data == nil {
+		r.add(SeverityError, "WAVE", "missing %q chunk", dataID)
+	} else if pcm && f.BlockAlign > 0 && data.Len%uint32(f.BlockAlign) != 0 {
+		r.add(SeverityWarning, "WAVE/data", "length %v is not a whole number of %v byte frames", data.Len, f.BlockAlign)
+	}
+	return r.issues
+}
+
+// leaf returns the first leaf subchunk of c with the given id, or nil if
+// there is none. Unlike FindChunk, it doesn't match lists of that form type.
+func (c *Chunk) leaf(id ID) *Chunk {
+	if i := c.index(id); i >= 0 {
+		return c.Chunks[i]
+	}
+	return nil
+}
+
+// printable reports whether id is made of printable ASCII characters.
+func printable(id ID) bool {
+	for _, b := range id {
+		if b < ' ' || b > '~' {
+			return false
+		}
+	}
+	return true
+}
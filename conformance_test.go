@@ -0,0 +1,139 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConformanceReport(t *testing.T) {
+	for _, path := range []string{"data/hand.wav", "data/odd.wav"} {
+		if issues := decodeFile(t, path).ConformanceReport(); issues != nil {
+			t.Errorf("%v: got issues %v", path, issues)
+		}
+	}
+
+	c := &Chunk{ID: riff, ListID: wave, Len: 40, Chunks: []*Chunk{
+		{ID: list, ListID: NewID("IN\x01O"), Len: 4, Data: []byte{1}},
+		{ID: dataID, Len: 2, Data: []byte{1}},
+		{ID: NewID("fmt "), Len: 0, Chunks: []*Chunk{{ID: NewID("x   ")}}},
+		{ID: riff, ListID: NewID("JUNK"), Len: 4},
+	}}
+	var got []string
+	for _, i := range c.ConformanceReport() {
+		got = append(got, i.String())
+	}
+	exp := []string{
+		`WAVE: error: length 40 doesn't match the 46 bytes of its form type and subchunks`,
+		`WAVE: error: "fmt " chunk after the "data" chunk`,
+		`WAVE/IN` + "\x01" + `O: error: form type "IN\x01O" is not printable ASCII`,
+		`WAVE/IN` + "\x01" + `O: error: container "LIST" has 1 bytes of data`,
+		`WAVE/data: error: length 2 doesn't match the 1 bytes of data`,
+		`WAVE/fmt : error: chunk at offset 33 is not word aligned`,
+		`WAVE/fmt : error: leaf "fmt " has 1 subchunks`,
+		`WAVE/JUNK: error: chunk at offset 41 is not word aligned`,
+		`WAVE/JUNK: warning: "RIFF" chunk nested in a container, only LIST chunks should be`,
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got issues\n%q\nexpected\n%q", got, exp)
+	}
+
+	c = &Chunk{ID: NewID("RF64"), ListID: NewID("TEST"), Len: 4}
+	if got := c.ConformanceReport(); len(got) != 1 || got[0].Severity != SeverityError {
+		t.Errorf("got issues %v for a RF64 root", got)
+	}
+	c = &Chunk{ID: riff, ListID: aviForm, Len: 4}
+	if got := c.ConformanceReport(); len(got) != 2 {
+		t.Errorf("got issues %v, expected the missing hdrl and movi lists", got)
+	}
+}
+
+func TestValidateWAVE(t *testing.T) {
+	for _, path := range []string{"data/hand.wav", "data/odd.wav"} {
+		if issues := decodeFile(t, path).ValidateWAVE(); issues != nil {
+			t.Errorf("%v: got issues %v", path, issues)
+		}
+	}
+
+	b, err := os.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewReaderAtDecoder(bytes.NewReader(b), int64(len(b))).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if issues := c.ValidateWAVE(); issues != nil {
+		t.Errorf("lazy tree: got issues %v", issues)
+	}
+	if c, err = NewDecoder(bytes.NewReader(b)).DecodeStructure(); err != nil {
+		t.Fatalf("DecodeStructure: %v", err)
+	}
+	if issues := c.ValidateWAVE(); len(issues) != 1 || !strings.Contains(issues[0].String(), "no data loaded") {
+		t.Errorf("structure: got issues %v", issues)
+	}
+
+	fmtData := func(tag, channels uint16, rate, byteRate uint32, align, bits uint16, extra ...byte) []byte {
+		b := binary.LittleEndian.AppendUint16(nil, tag)
+		b = binary.LittleEndian.AppendUint16(b, channels)
+		b = binary.LittleEndian.AppendUint32(b, rate)
+		b = binary.LittleEndian.AppendUint32(b, byteRate)
+		b = binary.LittleEndian.AppendUint16(b, align)
+		b = binary.LittleEndian.AppendUint16(b, bits)
+		return append(b, extra...)
+	}
+	wav := func(chunks ...*Chunk) *Chunk {
+		for _, c := range chunks {
+			c.Len = uint32(len(c.Data))
+		}
+		return &Chunk{ID: riff, ListID: wave, Chunks: chunks}
+	}
+	for _, tt := range []struct {
+		name string
+		c    *Chunk
+		exp  []string
+	}{
+		{"not wave", &Chunk{ID: riff, ListID: aviForm}, []string{
+			`AVI : error: not a WAVE file: "RIFF" form "AVI "`,
+		}},
+		{"no fmt", wav(), []string{`WAVE: error: missing "fmt " chunk`}},
+		{"fmt list", wav(&Chunk{ID: list, ListID: fmtID}), []string{`WAVE: error: missing "fmt " chunk`}},
+		{"cbSize overrun", wav(&Chunk{ID: fmtID, Data: fmtData(0x11, 1, 8000, 4055, 256, 4, 4, 0, 1)}), []string{
+			`WAVE/fmt : error: cbSize 4 overruns the fmt chunk by 3 bytes`,
+		}},
+		{"compressed", wav(
+			&Chunk{ID: fmtID, Data: fmtData(0x11, 1, 8000, 4055, 256, 4, 0, 0, 0)},
+			&Chunk{ID: dataID, Data: make([]byte, 3)},
+		), []string{
+			`WAVE/fmt : warning: 1 bytes following the 0 extra format bytes of cbSize`,
+			`WAVE: error: missing "fact" chunk required for format 0x11`,
+		}},
+		{"pcm", wav(
+			&Chunk{ID: fmtID, Data: fmtData(WaveFormatPCM, 2, 8000, 16000, 2, 16)},
+			&Chunk{ID: dataID, Data: make([]byte, 3)},
+		), []string{
+			`WAVE/fmt : error: BlockAlign 2 doesn't match the 4 bytes of 2 channels of 16 bits`,
+			`WAVE/data: warning: length 3 is not a whole number of 2 byte frames`,
+		}},
+		{"float", wav(
+			&Chunk{ID: fmtID, Data: fmtData(WaveFormatIEEEFloat, 1, 8000, 8000, 4, 32)},
+			&Chunk{ID: factID, Data: []byte{1}},
+		), []string{
+			`WAVE/fmt : error: ByteRate 8000 doesn't match the 32000 bytes per second of 8000 frames of 4 bytes`,
+			`WAVE/fmt : warning: fmt chunk of format 0x3 has no cbSize field`,
+			`WAVE/fact: error: fact chunk of 1 bytes has no room for a sample count`,
+			`WAVE: error: missing "data" chunk`,
+		}},
+	} {
+		var got []string
+		for _, i := range tt.c.ValidateWAVE() {
+			got = append(got, i.String())
+		}
+		if !reflect.DeepEqual(got, tt.exp) {
+			t.Errorf("%v: got issues\n%q\nexpected\n%q", tt.name, got, tt.exp)
+		}
+	}
+}
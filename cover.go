@@ -0,0 +1,178 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// dispID is the ID of the chunks holding data in a Windows clipboard format,
+// often used to embed a picture of the contents of a file.
+var dispID = ID{'D', 'I', 'S', 'P'}
+
+// Clipboard formats of "DISP" chunks holding text and device independent
+// bitmaps.
+const (
+	cfText = 1
+	cfDIB  = 8
+)
+
+// imageMagic maps the leading bytes of known image formats to their MIME
+// types.
+var imageMagic = []struct {
+	magic string
+	mime  string
+}{
+	{"\xff\xd8\xff", "image/jpeg"},
+	{"\x89PNG\r\n\x1a\n", "image/png"},
+	{"GIF87a", "image/gif"},
+	{"GIF89a", "image/gif"},
+	{"BM", "image/bmp"},
+}
+
+// CoverArt returns the first picture embedded in a "DISP" chunk of the tree
+// rooted at c, along with its MIME type. Device independent bitmaps are
+// returned as a complete BMP file, with the file header they lack in the
+// chunk; other pictures are returned as found and their MIME type guessed
+// from their leading bytes. CoverArt returns no data and no error if the
+// tree has no picture.
+func (c *Chunk) CoverArt() ([]byte, string, error) {
+	var err error
+	var data []byte
+	var mime string
+	c.first(func(c *Chunk) bool {
+		if c.ID != dispID {
+			return false
+		}
+		data, mime, err = dispPicture(c)
+		return data != nil || err != nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return data, mime, nil
+}
+
+// dispPicture returns the picture held by the "DISP" chunk c and its MIME
+// type, or no data if it holds none.
+func dispPicture(c *Chunk) ([]byte, string, error) {
+	if len(c.Data) < 4 {
+		return nil, "", nil
+	}
+	b := c.Data[4:]
+	if binary.LittleEndian.Uint32(c.Data) == cfDIB {
+		data, err := dibToBMP(b)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, "image/bmp", nil
+	}
+	if mime := imageType(b); mime != "" {
+		return b, mime, nil
+	}
+	return nil, "", nil
+}
+
+// imageType returns the MIME type of the image b, guessed from its leading
+// bytes, or "" if it isn't a known image format.
+func imageType(b []byte) string {
+	for _, m := range imageMagic {
+		if bytes.HasPrefix(b, []byte(m.magic)) {
+			return m.mime
+		}
+	}
+	return ""
+}
+
+// AVIThumbnail returns the first picture embedded in the AVI file c, along
+// with its MIME type: a picture held by a "DISP" chunk, as CoverArt returns
+// it, or any other leaf whose data is a picture, such as the JPEG thumbnail
+// cameras write in a "ncth" chunk. The "movi" list is skipped, as its
+// frames may be pictures too. Note that "ISMP" and "IDIT" INFO tags hold a
+// timecode and a date, not pictures. AVIThumbnail returns no data and no
+// error if the file has no thumbnail.
+func (c *Chunk) AVIThumbnail() ([]byte, string, error) {
+	if c.ID != riff || c.ListID != aviForm {
+		return nil, "", fmt.Errorf("not an AVI file: %q form %q", c.ID, c.ListID)
+	}
+	var err error
+	var data []byte
+	var mime string
+	var find func(c *Chunk) bool
+	find = func(c *Chunk) bool {
+		if c.IsContainer() {
+			if c.ListID == moviID {
+				return false
+			}
+			for _, sc := range c.Chunks {
+				if find(sc) {
+					return true
+				}
+			}
+			return false
+		}
+		if c.ID == dispID {
+			data, mime, err = dispPicture(c)
+		} else if mime = imageType(c.Data); mime != "" {
+			data = c.Data
+		}
+		return data != nil || err != nil
+	}
+	find(c)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, mime, nil
+}
+
+// dibToBMP returns a BMP file holding the device independent bitmap dib,
+// made of a bitmap info header, an optional color table, and the pixels.
+func dibToBMP(dib []byte) ([]byte, error) {
+	h, err := ParseBitmapInfoHeader(dib)
+	if err != nil {
+		return nil, err
+	}
+	if h.Size < 40 || int(h.Size) > len(dib) {
+		return nil, fmt.Errorf("invalid bitmap info header size %v", h.Size)
+	}
+	colors := h.ClrUsed
+	if colors == 0 && h.BitCount <= 8 {
+		colors = 1 << h.BitCount
+	}
+	pixels := 14 + h.Size + 4*colors
+	if h.Size == 40 && binary.LittleEndian.Uint32(h.Compression[:]) == 3 {
+		pixels += 12 // BI_BITFIELDS color masks
+	}
+
+	bmp := make([]byte, 14, 14+len(dib))
+	copy(bmp, "BM")
+	binary.LittleEndian.PutUint32(bmp[2:], uint32(14+len(dib)))
+	binary.LittleEndian.PutUint32(bmp[10:], pixels)
+	return append(bmp, dib...), nil
+}
+
+// NowPlaying returns the title, artist and album of c, as a player shows
+// them, from the INAM, IART and IPRD tags of its INFO list. If there is no
+// title, the first "DISP" chunk holding text, as CF_TEXT, is used instead.
+// Missing fields are empty.
+func (c *Chunk) NowPlaying() (title, artist, album string) {
+	if l := infoList(c); l != nil {
+		for _, f := range []struct {
+			id ID
+			s  *string
+		}{{NewID("INAM"), &title}, {NewID("IART"), &artist}, {NewID("IPRD"), &album}} {
+			if tag := l.first(func(sc *Chunk) bool { return sc.ID == f.id }); tag != nil {
+				*f.s, _ = ReadFixedString(bytes.NewReader(tag.Data), len(tag.Data))
+			}
+		}
+	}
+	if title == "" {
+		disp := c.first(func(c *Chunk) bool {
+			return c.ID == dispID && len(c.Data) >= 4 && binary.LittleEndian.Uint32(c.Data) == cfText
+		})
+		if disp != nil {
+			title, _ = ReadFixedString(bytes.NewReader(disp.Data[4:]), len(disp.Data)-4)
+		}
+	}
+	return title, artist, album
+}
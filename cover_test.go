@@ -0,0 +1,123 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCoverArt(t *testing.T) {
+	// A 2x1 24 bit bitmap, each row padded to 4 bytes.
+	dib := make([]byte, 40+8)
+	binary.LittleEndian.PutUint32(dib[0:], 40)
+	binary.LittleEndian.PutUint32(dib[4:], 2)
+	binary.LittleEndian.PutUint32(dib[8:], 1)
+	binary.LittleEndian.PutUint16(dib[12:], 1)
+	binary.LittleEndian.PutUint16(dib[14:], 24)
+	copy(dib[40:], "\xff\x00\x00\x00\xff\x00")
+	png := []byte("\x89PNG\r\n\x1a\nIHDR")
+
+	for _, tt := range []struct {
+		name string
+		disp []byte
+		mime string
+		data []byte
+	}{
+		{"dib", append([]byte{cfDIB, 0, 0, 0}, dib...), "image/bmp", nil},
+		{"png", append([]byte{0, 0, 0, 0}, png...), "image/png", png},
+	} {
+		b := listBytes("RIFF", "WAVE",
+			leafBytes("DISP", []byte{1, 0, 0, 0, 'h', 'i'}),
+			listBytes("LIST", "INFO", leafBytes("DISP", tt.disp)),
+		)
+		c, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err != nil {
+			t.Fatalf("%v: Decode: %v", tt.name, err)
+		}
+		data, mime, err := c.CoverArt()
+		if err != nil {
+			t.Fatalf("%v: CoverArt: %v", tt.name, err)
+		}
+		if mime != tt.mime {
+			t.Errorf("%v: got MIME type %q, expected %q", tt.name, mime, tt.mime)
+		}
+		if tt.data != nil && !bytes.Equal(data, tt.data) {
+			t.Errorf("%v: got %q, expected %q", tt.name, data, tt.data)
+		}
+		if tt.data == nil {
+			if len(data) != 14+len(dib) || string(data[:2]) != "BM" || !bytes.Equal(data[14:], dib) {
+				t.Fatalf("%v: got %q", tt.name, data)
+			}
+			if size := binary.LittleEndian.Uint32(data[2:]); size != uint32(len(data)) {
+				t.Errorf("%v: BMP size is %v, expected %v", tt.name, size, len(data))
+			}
+			if off := binary.LittleEndian.Uint32(data[10:]); off != 54 {
+				t.Errorf("%v: pixels offset is %v, expected 54", tt.name, off)
+			}
+		}
+	}
+
+	c := decodeFile(t, "data/hand.wav")
+	if data, mime, err := c.CoverArt(); data != nil || mime != "" || err != nil {
+		t.Errorf("no cover art: got %q, %q, %v", data, mime, err)
+	}
+	c = &Chunk{ID: dispID, Data: []byte{cfDIB, 0, 0, 0, 40, 0}}
+	if _, _, err := c.CoverArt(); err == nil {
+		t.Errorf("expected error for a truncated bitmap")
+	}
+}
+
+func TestNowPlaying(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("DISP", []byte("\x01\x00\x00\x00Shown title\x00")),
+		listBytes("LIST", "INFO",
+			leafBytes("IART", []byte("Artist\x00")),
+			leafBytes("IPRD", []byte("Album \x00\x00")),
+		),
+	)
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if title, artist, album := c.NowPlaying(); title != "Shown title" || artist != "Artist" || album != "Album" {
+		t.Errorf("got %q, %q, %q", title, artist, album)
+	}
+
+	info := c.FindChunk(NewID("INFO"))
+	info.Chunks = append(info.Chunks, &Chunk{ID: NewID("INAM"), Data: []byte("Title")})
+	if title, _, _ := c.NowPlaying(); title != "Title" {
+		t.Errorf("got title %q, expected the INAM tag", title)
+	}
+
+	if title, artist, album := decodeFile(t, "data/hand.wav").NowPlaying(); title != "" || artist != "" || album != "" {
+		t.Errorf("got %q, %q, %q for a file without tags", title, artist, album)
+	}
+}
+
+func TestAVIThumbnail(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0thumbnail")
+	frame := []byte("\xff\xd8\xff\xe0frame")
+	c, err := NewDecoder(bytes.NewReader(BuildRIFF(aviForm,
+		ChunkSpec{ID: "LIST", Form: "hdrl", Chunks: []ChunkSpec{{ID: "avih", Data: make([]byte, 56)}}},
+		ChunkSpec{ID: "LIST", Form: "movi", Chunks: []ChunkSpec{{ID: "00dc", Data: frame}}},
+		ChunkSpec{ID: "LIST", Form: "ncdt", Chunks: []ChunkSpec{
+			{ID: "nctg", Data: make([]byte, 8)},
+			{ID: "ncth", Data: jpeg},
+		}},
+	))).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	data, mime, err := c.AVIThumbnail()
+	if err != nil || mime != "image/jpeg" || !bytes.Equal(data, jpeg) {
+		t.Errorf("got %q of type %q, %v; expected the ncth thumbnail", data, mime, err)
+	}
+
+	c.Chunks = c.Chunks[:2]
+	if data, mime, err := c.AVIThumbnail(); data != nil || mime != "" || err != nil {
+		t.Errorf("got %q of type %q, %v; expected no thumbnail from movi frames", data, mime, err)
+	}
+	if _, _, err := decodeFile(t, "data/hand.wav").AVIThumbnail(); err == nil {
+		t.Errorf("expected error for a WAVE file")
+	}
+}
@@ -0,0 +1,81 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// csetID is the ID of the character set chunk.
+var csetID = ID{'C', 'S', 'E', 'T'}
+
+// Code pages of a CsetChunk understood by CsetChunk.DecodeString.
+const (
+	CodePageUTF16LE     = 1200
+	CodePageWindows1252 = 1252
+	CodePageLatin1      = 28591
+	CodePageUTF8        = 65001
+)
+
+// CsetChunk is the content of a "CSET" chunk, which declares the character
+// set and language of the text chunks of a file.
+type CsetChunk struct {
+	CodePage     uint16
+	CountryCode  uint16
+	LanguageCode uint16
+	Dialect      uint16
+}
+
+// CsetDecoder is a DecoderFunc for "CSET" chunks that sets Content to a
+// CsetChunk.
+func CsetDecoder(r io.Reader) (interface{}, error) {
+	var c CsetChunk
+	if err := binary.Read(r, binary.LittleEndian, &c); err != nil {
+		return nil, fmt.Errorf("read CSET chunk: %v", err)
+	}
+	return c, nil
+}
+
+// DecodeString converts the data b of a text chunk from the code page of c
+// to a string, ending it at its first NUL character and removing its
+// trailing spaces like ReadFixedString. A code page of 0 leaves the bytes
+// as they are, and other code pages than the ones defined in this package
+// are an error.
+func (c CsetChunk) DecodeString(b []byte) (string, error) {
+	if c.CodePage == CodePageUTF16LE {
+		s, err := (&Chunk{ID: csetID, Data: b}).DataUTF16()
+		if i := bytes.IndexByte([]byte(s), 0); i >= 0 {
+			s = s[:i]
+		}
+		return string(bytes.TrimRight([]byte(s), " ")), err
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	b = bytes.TrimRight(b, " ")
+	switch c.CodePage {
+	case 0, CodePageUTF8:
+		return string(b), nil
+	case CodePageLatin1, CodePageWindows1252:
+		s := make([]byte, 0, len(b))
+		for _, v := range b {
+			r := rune(v)
+			if c.CodePage == CodePageWindows1252 && r >= 0x80 && r < 0xa0 {
+				r = windows1252[r-0x80]
+			}
+			s = utf8.AppendRune(s, r)
+		}
+		return string(s), nil
+	}
+	return "", fmt.Errorf("unsupported code page %v", c.CodePage)
+}
+
+// windows1252 maps bytes 0x80 to 0x9f of code page 1252 to the characters
+// they stand for. Unassigned bytes map to the control characters of the
+// same value, as in Latin-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
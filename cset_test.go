@@ -0,0 +1,57 @@
+package riff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCsetDecoder(t *testing.T) {
+	v, err := CsetDecoder(bytes.NewReader([]byte{0xe4, 0x04, 34, 0, 10, 0, 1, 0}))
+	if err != nil {
+		t.Fatalf("CsetDecoder: %v", err)
+	}
+	if exp := (CsetChunk{CodePage: 1252, CountryCode: 34, LanguageCode: 10, Dialect: 1}); v != exp {
+		t.Errorf("got %+v, expected %+v", v, exp)
+	}
+	if _, err := CsetDecoder(bytes.NewReader([]byte{1, 2, 3})); err == nil {
+		t.Errorf("expected error for a short chunk")
+	}
+}
+
+func TestCsetDecodeString(t *testing.T) {
+	for _, tt := range []struct {
+		page uint16
+		data string
+		exp  string
+	}{
+		{0, "plain \x00junk", "plain"},
+		{CodePageUTF8, "caf\xc3\xa9  ", "café"},
+		{CodePageLatin1, "caf\xe9\x00", "café"},
+		{CodePageWindows1252, "\x93caf\xe9\x94 \x80", "“café” €"},
+		{CodePageUTF16LE, "c\x00a\x00f\x00\xe9\x00\x00\x00", "café"},
+	} {
+		got, err := CsetChunk{CodePage: tt.page}.DecodeString([]byte(tt.data))
+		if err != nil || got != tt.exp {
+			t.Errorf("code page %v: got %q, %v, expected %q", tt.page, got, err, tt.exp)
+		}
+	}
+	if _, err := (CsetChunk{CodePage: 936}).DecodeString([]byte("abc")); err == nil {
+		t.Errorf("expected error for an unsupported code page")
+	}
+}
+
+func TestOpenWAVCset(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x40, 0x1f, 0, 0, 1, 0, 8, 0}),
+		leafBytes("CSET", []byte{0xe4, 0x04, 0, 0, 0, 0, 0, 0}),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("Caf\xe9\x00"))),
+		leafBytes("data", []byte{0x80, 0x80}),
+	)
+	w, err := OpenWAV(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("OpenWAV: %v", err)
+	}
+	if got := w.Info[NewID("INAM")]; got != "Café" {
+		t.Errorf("got INAM %q, expected %q", got, "Café")
+	}
+}
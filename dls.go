@@ -0,0 +1,54 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// CollectionHeader is the content of the "colh" chunk of a DLS file, a RIFF
+// file of form type "DLS " holding a collection of instruments.
+type CollectionHeader struct {
+	Instruments uint32 // Number of instruments in the collection
+}
+
+// ColhDecoder is a DecoderFunc for "colh" chunks that sets Content to a
+// CollectionHeader.
+func ColhDecoder(r io.Reader) (interface{}, error) {
+	var h CollectionHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("colh chunk too short: %v", err)
+	}
+	return h, nil
+}
+
+// PoolTable is the content of the "ptbl" chunk of a DLS file, which locates
+// the waves of the "wvpl" list used by the instruments.
+type PoolTable struct {
+	// Cues holds the offset of every wave from the start of the form type
+	// of the "wvpl" list, indexed by the wave numbers instruments refer to.
+	Cues []uint32
+}
+
+// PtblDecoder is a DecoderFunc for "ptbl" chunks that sets Content to a
+// PoolTable. The number of cues declared in the chunk must match its
+// length.
+func PtblDecoder(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, fmt.Errorf("ptbl chunk too short: %v bytes", len(b))
+	}
+	size, n := binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])
+	if size < 8 || int64(size)+4*int64(n) != int64(len(b)) {
+		return nil, fmt.Errorf("ptbl of length %v can't hold a %v byte header and %v cues", len(b), size, n)
+	}
+	cues, err := DecodeRecords[uint32](b[size:], binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+	return PoolTable{Cues: cues}, nil
+}
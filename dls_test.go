@@ -0,0 +1,45 @@
+package riff
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDLS(t *testing.T) {
+	b := listBytes("RIFF", "DLS ",
+		leafBytes("colh", []byte{2, 0, 0, 0}),
+		leafBytes("ptbl", []byte{8, 0, 0, 0, 2, 0, 0, 0, 4, 0, 0, 0, 40, 0, 0, 0}),
+	)
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(NewID("colh"), ColhDecoder)
+	d.Map(NewID("ptbl"), PtblDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := c.FindChunk(NewID("colh")).Content; got != (CollectionHeader{2}) {
+		t.Errorf("colh: got %+v", got)
+	}
+	if got, exp := c.FindChunk(NewID("ptbl")).Content, (PoolTable{[]uint32{4, 40}}); !reflect.DeepEqual(got, exp) {
+		t.Errorf("ptbl: got %+v, expected %+v", got, exp)
+	}
+
+	// A ptbl with a larger header is accepted.
+	got, err := PtblDecoder(bytes.NewReader([]byte{12, 0, 0, 0, 1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 4, 0, 0, 0}))
+	if err != nil || !reflect.DeepEqual(got, PoolTable{[]uint32{4}}) {
+		t.Errorf("extended header: got %+v, %v", got, err)
+	}
+	for _, b := range [][]byte{
+		{8, 0, 0, 0},
+		{8, 0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0, 40, 0, 0, 0},
+		{4, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		if _, err := PtblDecoder(bytes.NewReader(b)); err == nil {
+			t.Errorf("%v: expected error", b)
+		}
+	}
+	if _, err := ColhDecoder(bytes.NewReader([]byte{2, 0})); err == nil {
+		t.Errorf("expected error for a short colh chunk")
+	}
+}
@@ -0,0 +1,298 @@
+package riff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// UpdateLengths recomputes the Len of every chunk in the tree rooted at c
+// from its content: the length of Data for leaves, and the form type plus
+// the size of every subchunk, headers and pad bytes included, for
+// containers. Leaves whose data wasn't loaded, as with ReadOnly or
+// DecodeStructure, keep their length. Call it on the root after editing a
+// tree and before writing it. If a chunk contains itself an error is
+// returned and no length is changed.
+func (c *Chunk) UpdateLengths() error {
+	if _, err := c.MaxDepth(); err != nil {
+		return err
+	}
+	c.updateLengths()
+	return nil
+}
+
+func (c *Chunk) updateLengths() {
+	if !c.IsContainer() {
+		if c.loaded() {
+			c.Len = uint32(c.dataLen())
+		}
+		return
+	}
+	for _, sc := range c.Chunks {
+		sc.updateLengths()
+	}
+	c.updateLen()
+}
+
+// Normalize prepares the tree rooted at c, built or edited in memory, to be
+// written as a valid RIFF file. IDs and form types shorter than four
+// characters, padded with NUL bytes, are padded with spaces instead, as in
+// "fmt ". Pad bytes are reset to zero, and lengths are recomputed as with
+// UpdateLengths. If pruneEmptyLists is true, LIST chunks without subchunks
+// are removed, including those left empty by removing their own. As with
+// UpdateLengths, a chunk containing itself is an error, and the tree is
+// then left unchanged.
+func (c *Chunk) Normalize(pruneEmptyLists bool) error {
+	if _, err := c.MaxDepth(); err != nil {
+		return err
+	}
+	if pruneEmptyLists {
+		c.FilterChildren(func(sc *Chunk) bool { return sc.ID != list || len(sc.Chunks) > 0 }, true)
+	}
+	c.walk(func(c *Chunk) {
+		c.ID, c.padByte = spacePadded(c.ID), 0
+		if c.IsContainer() {
+			c.ListID = spacePadded(c.ListID)
+		}
+	})
+	c.updateLengths()
+	return nil
+}
+
+// spacePadded returns id with its trailing NUL bytes replaced by spaces.
+func spacePadded(id ID) ID {
+	for i := len(id) - 1; i >= 0 && id[i] == 0; i-- {
+		id[i] = ' '
+	}
+	return id
+}
+
+// Clone returns a deep copy of the tree rooted at c, which can be edited
+// without changing c: the Data and Chunks of every chunk are copied. Content
+// is shared, as are the sections data is read from for chunks created by
+// SectionChunk or decoded by NewReaderAtDecoder. A chunk found several times
+// in the tree is copied once.
+func (c *Chunk) Clone() *Chunk {
+	return c.clone(map[*Chunk]*Chunk{})
+}
+
+func (c *Chunk) clone(done map[*Chunk]*Chunk) *Chunk {
+	if cc, ok := done[c]; ok {
+		return cc
+	}
+	cc := *c
+	done[c] = &cc
+	if c.Data != nil {
+		cc.Data = append(make([]byte, 0, len(c.Data)), c.Data...)
+	}
+	if c.Chunks != nil {
+		cc.Chunks = make([]*Chunk, len(c.Chunks))
+		for i, sc := range c.Chunks {
+			cc.Chunks[i] = sc.clone(done)
+		}
+	}
+	return &cc
+}
+
+// SetID renames c to id, as when disabling a chunk by renaming it to
+// "JUNK". Renaming a leaf to a container ID or a container to a leaf ID is
+// an error, since the chunk would neither have nor need a form type and
+// subchunks.
+func (c *Chunk) SetID(id ID) error {
+	if isContainer(id) != c.IsContainer() {
+		if c.IsContainer() {
+			return fmt.Errorf("can't rename container %q to leaf id %q", c.ID, id)
+		}
+		return fmt.Errorf("can't rename leaf %q to container id %q", c.ID, id)
+	}
+	c.ID = id
+	return nil
+}
+
+// SetContent sets the Content of the leaf chunk c to v, and its Data and
+// Len to the encoding of v by e. As with Truncate, UpdateLengths must then
+// be called on the root before the tree is written.
+func (c *Chunk) SetContent(v interface{}, e EncoderFunc) error {
+	if c.IsContainer() {
+		return fmt.Errorf("can't set the content of container %q", c.ID)
+	}
+	data, err := e(v)
+	if err != nil {
+		return fmt.Errorf("encode %q: %v", c.ID, err)
+	}
+	c.Content, c.Data, c.Len, c.padByte = v, data, uint32(len(data)), 0
+	c.decoded = true
+	return nil
+}
+
+// Truncate shortens the data of the leaf chunk c to n bytes and updates its
+// Len. The containers holding c still declare the old length, so
+// UpdateLengths must be called on the root before the tree is written. The
+// data of section chunks, such as those decoded by NewReaderAtDecoder, is
+// cut too, but truncating a leaf whose data isn't loaded is an error.
+func (c *Chunk) Truncate(n uint32) error {
+	if c.IsContainer() {
+		return fmt.Errorf("can't truncate container %q", c.ID)
+	}
+	if n > c.Len || int64(n) > c.dataLen() && c.loaded() {
+		return fmt.Errorf("can't truncate %q of length %v to %v bytes", c.ID, c.Len, n)
+	}
+	switch {
+	case c.section != nil:
+		c.section = io.NewSectionReader(c.section, 0, int64(n))
+	case !c.loaded():
+		return fmt.Errorf("can't truncate %q, its data isn't loaded", c.ID)
+	default:
+		c.Data = c.Data[:n]
+	}
+	c.Len = n
+	return nil
+}
+
+// SplitData replaces every subchunk of c with the given id holding more
+// than max bytes of data by as many consecutive chunks with the same id as
+// needed to hold at most max bytes each. Section chunks are split in
+// sections of the same reader. The length of c is updated, but not those
+// of the containers holding it. A chunk to split whose data isn't loaded
+// is an error.
+func (c *Chunk) SplitData(id ID, max uint32) error {
+	if isContainer(id) {
+		return fmt.Errorf("can't split container chunks")
+	}
+	if max == 0 {
+		return fmt.Errorf("can't split data in chunks of 0 bytes")
+	}
+	var chunks []*Chunk
+	for _, sc := range c.Chunks {
+		if sc.ID != id || sc.loaded() && sc.dataLen() <= int64(max) {
+			chunks = append(chunks, sc)
+			continue
+		}
+		if !sc.loaded() {
+			return fmt.Errorf("can't split %q, its data isn't loaded", id)
+		}
+		if sc.section != nil {
+			for off := int64(0); off < sc.section.Size(); off += int64(max) {
+				n := min(int64(max), sc.section.Size()-off)
+				chunks = append(chunks, &Chunk{ID: id, Len: uint32(n), section: io.NewSectionReader(sc.section, off, n)})
+			}
+			continue
+		}
+		for data := sc.Data; len(data) > 0; {
+			n := len(data)
+			if n > int(max) {
+				n = int(max)
+			}
+			chunks = append(chunks, &Chunk{ID: id, Len: uint32(n), Data: data[:n]})
+			data = data[n:]
+		}
+	}
+	c.Chunks = chunks
+	c.updateLen()
+	return nil
+}
+
+// MergeAdjacent replaces every run of consecutive subchunks of c with the
+// given id by a single chunk holding all their data, undoing SplitData. The
+// length of c is updated, but not those of the containers holding it.
+func (c *Chunk) MergeAdjacent(id ID) error {
+	if isContainer(id) {
+		return fmt.Errorf("can't merge container chunks")
+	}
+	var chunks []*Chunk
+	for i := 0; i < len(c.Chunks); i++ {
+		sc := c.Chunks[i]
+		if sc.ID != id || i+1 == len(c.Chunks) || c.Chunks[i+1].ID != id {
+			chunks = append(chunks, sc)
+			continue
+		}
+		m := &Chunk{ID: id}
+		for ; i < len(c.Chunks) && c.Chunks[i].ID == id; i++ {
+			data, err := c.Chunks[i].loadedData()
+			if err != nil {
+				return fmt.Errorf("can't merge %q: %v", id, err)
+			}
+			m.Data = append(m.Data, data...)
+		}
+		i--
+		m.Len = uint32(len(m.Data))
+		chunks = append(chunks, m)
+	}
+	c.Chunks = chunks
+	c.updateLen()
+	return nil
+}
+
+// FilterChildren removes every subchunk of c for which keep returns false.
+// If recursive is true, the containers kept are filtered too, depth first,
+// so keep sees them with their subchunks already filtered. The lengths of c
+// and of the filtered containers are updated, but not those of the
+// containers holding c. As with Walk, a container found among its own
+// descendants isn't filtered again.
+func (c *Chunk) FilterChildren(keep func(*Chunk) bool, recursive bool) {
+	c.filterChildren(keep, recursive, map[*Chunk]bool{})
+}
+
+func (c *Chunk) filterChildren(keep func(*Chunk) bool, recursive bool, path map[*Chunk]bool) {
+	path[c] = true
+	defer delete(path, c)
+	chunks := c.Chunks[:0]
+	for _, sc := range c.Chunks {
+		if recursive && sc.IsContainer() && !path[sc] {
+			sc.filterChildren(keep, true, path)
+		}
+		if keep(sc) {
+			chunks = append(chunks, sc)
+		}
+	}
+	for i := len(chunks); i < len(c.Chunks); i++ {
+		c.Chunks[i] = nil
+	}
+	c.Chunks = chunks
+	if c.IsContainer() {
+		c.updateLen()
+	}
+}
+
+// RemoveAll removes every chunk with the given ID from the tree rooted at c,
+// c excluded, and returns the number of chunks removed. As with
+// FilterChildren, the lengths of c and of the containers it holds are
+// updated, but not those of the containers holding c.
+func (c *Chunk) RemoveAll(id ID) int {
+	return c.removeIf(func(sc *Chunk) bool { return sc.ID == id })
+}
+
+// StripPadding removes the padding chunks, "JUNK", "junk", "PAD " and
+// "FLLR", inserted by many tools to align what follows them, from the tree
+// rooted at c as RemoveAll does, and returns the number of chunks removed.
+func (c *Chunk) StripPadding() int {
+	return c.removeIf(func(sc *Chunk) bool { return junkIDs[sc.ID] })
+}
+
+func (c *Chunk) removeIf(drop func(*Chunk) bool) int {
+	n := 0
+	c.FilterChildren(func(sc *Chunk) bool {
+		if drop(sc) {
+			n++
+			return false
+		}
+		return true
+	}, true)
+	return n
+}
+
+// SortChildren sorts the subchunks of c with less, keeping the original
+// order of equal subchunks, so that trees assembled in a nondeterministic
+// order are written identically. Lengths are unaffected.
+func (c *Chunk) SortChildren(less func(a, b *Chunk) bool) {
+	sort.SliceStable(c.Chunks, func(i, j int) bool { return less(c.Chunks[i], c.Chunks[j]) })
+}
+
+// updateLen sets the Len of the container c from the lengths of its
+// subchunks.
+func (c *Chunk) updateLen() {
+	c.Len = 4
+	for _, sc := range c.Chunks {
+		c.Len += 8 + sc.Len + sc.Len%2
+	}
+}
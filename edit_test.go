@@ -0,0 +1,475 @@
+package riff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func decodeFile(t testing.TB, path string) *Chunk {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+	c, err := NewDecoder(f).Decode()
+	if err != nil {
+		t.Fatalf("decode %v: %v", path, err)
+	}
+	return c
+}
+
+func TestUpdateLengths(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	exp := decodeFile(t, "data/hand.wav")
+
+	var zero func(c *Chunk)
+	zero = func(c *Chunk) {
+		c.Len = 0
+		for _, sc := range c.Chunks {
+			zero(sc)
+		}
+	}
+	zero(c)
+	c.UpdateLengths()
+	compare(t, exp, c)
+}
+
+func TestSetID(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	data := c.FindChunk(NewID("data"))
+	if err := data.SetID(NewID("JUNK")); err != nil {
+		t.Fatalf("SetID: %v", err)
+	}
+	if c.FindChunk(NewID("data")) != nil || c.FindChunk(NewID("JUNK")) != data {
+		t.Errorf("data chunk wasn't renamed to JUNK")
+	}
+	info := c.FindChunk(NewID("INFO"))
+	if err := info.SetID(NewID("RIFF")); err != nil {
+		t.Errorf("renaming LIST to RIFF: %v", err)
+	}
+
+	if err := data.SetID(NewID("LIST")); err == nil {
+		t.Errorf("expected error renaming a leaf to LIST")
+	}
+	if err := info.SetID(NewID("data")); err == nil {
+		t.Errorf("expected error renaming a container to a leaf id")
+	}
+	if data.ID != NewID("JUNK") || info.ID != NewID("RIFF") {
+		t.Errorf("failed renames changed ids to %q and %q", data.ID, info.ID)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	cc := c.Clone()
+	if !cc.Equal(c) {
+		t.Fatalf("clone differs from the original")
+	}
+	data := cc.FindChunk(NewID("data"))
+	data.Data[0]++
+	cc.Chunks[0].ID = NewID("JUNK")
+	if cc.Equal(c) || c.FindChunk(NewID("data")).Data[0] == data.Data[0] || c.Chunks[0].ID != NewID("fmt ") {
+		t.Errorf("editing the clone changed the original")
+	}
+
+	cyclic := &Chunk{ID: list, ListID: info}
+	cyclic.Chunks = []*Chunk{cyclic}
+	if cc := cyclic.Clone(); cc == cyclic || cc.Chunks[0] != cc {
+		t.Errorf("cyclic tree not cloned as a cyclic tree")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	data := c.FindChunk(NewID("data"))
+	if err := data.Truncate(7001); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	c.UpdateLengths()
+
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	// 799 bytes of data are dropped, but one comes back as a pad byte.
+	if buf.Len() != 7952-798 {
+		t.Errorf("wrote %v bytes, expected %v", buf.Len(), 7952-798)
+	}
+	got, err := NewDecoder(buf).Decode()
+	if err != nil {
+		t.Fatalf("Decode truncated file: %v", err)
+	}
+	if got.Len != 7944-798 {
+		t.Errorf("RIFF length is %v, expected %v", got.Len, 7944-798)
+	}
+	if l := got.FindChunk(NewID("data")).Len; l != 7001 {
+		t.Errorf("data length is %v, expected 7001", l)
+	}
+	if got := got.FindChunk(NewID("INFO"), NewID("ISFT")); got == nil || got.Len != 62 {
+		t.Errorf("chunk following data is %v", got)
+	}
+
+	if err := c.Truncate(0); err == nil {
+		t.Errorf("expected error truncating a container")
+	}
+	if err := data.Truncate(7002); err == nil {
+		t.Errorf("expected error growing a chunk")
+	}
+}
+
+func TestSplitData(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	exp := decodeFile(t, "data/hand.wav")
+
+	if err := c.SplitData(NewID("data"), 3001); err != nil {
+		t.Fatalf("SplitData: %v", err)
+	}
+	var lens []uint32
+	for _, sc := range c.Chunks {
+		lens = append(lens, sc.Len)
+	}
+	if exp := []uint32{30, 4, 3001, 3001, 1798, 74}; !reflect.DeepEqual(lens, exp) {
+		t.Errorf("chunk lengths after split: got %v, expected %v", lens, exp)
+	}
+	// Two extra headers and two pad bytes.
+	if exp := uint32(7944 + 2*8 + 2); c.Len != exp {
+		t.Errorf("RIFF length after split is %v, expected %v", c.Len, exp)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	c, err := NewDecoder(buf).Decode()
+	if err != nil {
+		t.Fatalf("Decode split file: %v", err)
+	}
+
+	if err := c.MergeAdjacent(NewID("data")); err != nil {
+		t.Fatalf("MergeAdjacent: %v", err)
+	}
+	compare(t, exp, c)
+	if !bytes.Equal(c.Chunks[2].Data, exp.Chunks[2].Data) {
+		t.Errorf("merged data differs from the original")
+	}
+
+	if err := c.SplitData(NewID("data"), 0); err == nil {
+		t.Errorf("expected error splitting in 0 byte chunks")
+	}
+	if err := c.SplitData(NewID("LIST"), 10); err == nil {
+		t.Errorf("expected error splitting containers")
+	}
+}
+
+func TestEditUnloaded(t *testing.T) {
+	b, err := os.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	lazy := func() *Chunk {
+		c, err := NewReaderAtDecoder(bytes.NewReader(b), int64(len(b))).Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return c
+	}
+
+	c := lazy()
+	data := c.FindChunk(dataID)
+	if err := data.Truncate(3); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	if got, err := data.loadedData(); err != nil || !bytes.Equal(got, b[70:73]) {
+		t.Errorf("truncated data is %v, %v, expected %v", got, err, b[70:73])
+	}
+
+	c, exp := lazy(), decodeFile(t, "data/hand.wav")
+	if err := c.SplitData(dataID, 3001); err != nil {
+		t.Fatalf("SplitData: %v", err)
+	}
+	if err := exp.SplitData(dataID, 3001); err != nil {
+		t.Fatalf("SplitData: %v", err)
+	}
+	if !c.Equal(exp) {
+		t.Errorf("lazy tree split as %v, expected %v", c, exp)
+	}
+	if err := c.MergeAdjacent(dataID); err != nil {
+		t.Fatalf("MergeAdjacent: %v", err)
+	}
+	if got := c.FindChunk(dataID); got.Len != 7800 || !bytes.Equal(got.Data, b[70:70+7800]) {
+		t.Errorf("merged data chunk of length %v differs from the original", got.Len)
+	}
+
+	c, err = NewDecoder(bytes.NewReader(b)).DecodeStructure()
+	if err != nil {
+		t.Fatalf("DecodeStructure: %v", err)
+	}
+	if err := c.FindChunk(dataID).Truncate(3); err == nil {
+		t.Errorf("expected error truncating a leaf without data")
+	}
+	if err := c.SplitData(dataID, 3001); err == nil {
+		t.Errorf("expected error splitting a leaf without data")
+	}
+	c.Chunks = append(c.Chunks, c.FindChunk(dataID))
+	if err := c.MergeAdjacent(dataID); err != nil {
+		t.Errorf("MergeAdjacent of chunks that aren't adjacent: %v", err)
+	}
+	c.Chunks[3], c.Chunks[4] = c.Chunks[4], c.Chunks[3]
+	if err := c.MergeAdjacent(dataID); err == nil {
+		t.Errorf("expected error merging leaves without data")
+	}
+}
+
+func TestUpdateLengthsUnloaded(t *testing.T) {
+	b, err := os.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	d := NewDecoder(bytes.NewReader(b))
+	d.ReadOnly = []ID{NewID("ISFT")}
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if err := c.UpdateLengths(); err != nil {
+		t.Fatalf("UpdateLengths: %v", err)
+	}
+	if data := c.FindChunk(dataID); c.Len != 7944 || data.Len != 7800 {
+		t.Errorf("UpdateLengths changed the lengths to %v and %v for data %v", c.Len, data.Len, data)
+	}
+	if err := c.Normalize(false); err != nil || c.Len != 7944 {
+		t.Errorf("Normalize: %v, RIFF length %v", err, c.Len)
+	}
+	if _, err := c.WriteTo(ioutil.Discard); err == nil {
+		t.Errorf("expected error writing leaves without data")
+	}
+	e := NewEncoder(ioutil.Discard)
+	e.UpdateLengths = true
+	if err := e.Encode(c); err == nil {
+		t.Errorf("expected error encoding leaves without data")
+	}
+}
+
+func TestSetContent(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	d.Map(fmtID, WaveFmtDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	fc := c.FindChunk(fmtID)
+	orig := append([]byte{}, fc.Data...)
+	format := fc.Content.(WaveFmt)
+	if err := fc.SetContent(format, WaveFmtEncoder); err != nil {
+		t.Fatalf("SetContent: %v", err)
+	}
+	if !bytes.Equal(fc.Data, orig) {
+		t.Errorf("unmodified content encoded as %q, expected %q", fc.Data, orig)
+	}
+
+	format.SampleRate = 44100
+	format.Extra = nil
+	if err := fc.SetContent(format, WaveFmtEncoder); err != nil {
+		t.Fatalf("SetContent: %v", err)
+	}
+	if fc.Len != 18 || len(fc.Data) != 18 {
+		t.Errorf("fmt length is %v with %v bytes of data, expected 18", fc.Len, len(fc.Data))
+	}
+	c.UpdateLengths()
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	d = NewDecoder(buf)
+	d.Map(fmtID, WaveFmtDecoder)
+	got, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode edited file: %v", err)
+	}
+	if got := got.FindChunk(fmtID).Content.(WaveFmt); got.SampleRate != 44100 {
+		t.Errorf("got sample rate %v, expected 44100", got.SampleRate)
+	}
+
+	if err := c.SetContent(format, WaveFmtEncoder); err == nil {
+		t.Errorf("expected error setting the content of a container")
+	}
+	if err := fc.SetContent("fmt ", WaveFmtEncoder); err == nil {
+		t.Errorf("expected error encoding a string")
+	}
+}
+
+func TestFilterChildren(t *testing.T) {
+	allowed := map[ID]bool{NewID("LIST"): true, NewID("fmt "): true, NewID("data"): true, NewID("INAM"): true}
+	keep := func(c *Chunk) bool { return allowed[c.ID] }
+	build := func() *Chunk {
+		b := listBytes("RIFF", "WAVE",
+			leafBytes("fmt ", make([]byte, 16)),
+			leafBytes("JUNK", make([]byte, 27)),
+			listBytes("LIST", "INFO",
+				leafBytes("ISFT", []byte("riff\x00")),
+				leafBytes("INAM", []byte("name")),
+			),
+			leafBytes("data", []byte{1, 2, 3}),
+		)
+		c, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return c
+	}
+
+	c := build()
+	c.FilterChildren(keep, false)
+	if len(c.Chunks) != 3 || len(c.Chunks[1].Chunks) != 2 {
+		t.Errorf("non recursive: got %v", c)
+	}
+	if exp := uint32(4 + 24 + 12 + 14 + 12 + 12); c.Len != exp {
+		t.Errorf("non recursive: got length %v, expected %v", c.Len, exp)
+	}
+
+	c = build()
+	c.FilterChildren(keep, true)
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("name"))),
+		leafBytes("data", []byte{1, 2, 3}),
+	)
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("recursive: got %q, expected %q", buf.Bytes(), exp)
+	}
+}
+
+func TestStripPadding(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("JUNK", make([]byte, 28)),
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO",
+			leafBytes("PAD ", make([]byte, 3)),
+			leafBytes("INAM", []byte("name")),
+		),
+		leafBytes("FLLR", make([]byte, 5)),
+		leafBytes("data", []byte{1, 2, 3}),
+	)
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if n := c.StripPadding(); n != 3 {
+		t.Errorf("removed %v chunks, expected 3", n)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	want := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("name"))),
+		leafBytes("data", []byte{1, 2, 3}),
+	)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), want)
+	}
+	if _, err := NewDecoder(buf).Decode(); err != nil {
+		t.Errorf("Decode stripped file: %v", err)
+	}
+
+	if n := c.RemoveAll(NewID("INAM")); n != 1 || c.FindChunk(NewID("INFO"), NewID("INAM")) != nil {
+		t.Errorf("RemoveAll removed %v chunks, leaving %v", n, c)
+	}
+	if n := c.RemoveAll(NewID("INAM")); n != 0 {
+		t.Errorf("RemoveAll removed %v chunks again", n)
+	}
+	if exp := uint32(4 + 24 + 12 + 12); c.Len != exp {
+		t.Errorf("got length %v, expected %v", c.Len, exp)
+	}
+}
+
+func TestSortChildren(t *testing.T) {
+	c := &Chunk{ID: riff, ListID: wave, Chunks: []*Chunk{
+		{ID: NewID("LIST"), ListID: info},
+		{ID: dataID, Data: []byte{1}},
+		{ID: NewID("JUNK"), Data: []byte{1}},
+		{ID: fmtID},
+		{ID: NewID("JUNK"), Data: []byte{2}},
+	}}
+	priority := map[ID]int{fmtID: 1, dataID: 2}
+	c.SortChildren(func(a, b *Chunk) bool {
+		pa, pb := priority[a.ID], priority[b.ID]
+		if pa == 0 {
+			pa = 3
+		}
+		if pb == 0 {
+			pb = 3
+		}
+		return pa < pb
+	})
+	var got []string
+	for _, sc := range c.Chunks {
+		got = append(got, sc.ID.String())
+	}
+	if exp := []string{"fmt ", "data", "LIST", "JUNK", "JUNK"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got order %q, expected %q", got, exp)
+	}
+	if c.Chunks[3].Data[0] != 1 {
+		t.Errorf("equal chunks were reordered")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	build := func() *Chunk {
+		return &Chunk{ID: riff, ListID: NewID("WAVE"), Len: 1, Chunks: []*Chunk{
+			{ID: ID{'f', 'm', 't', 0}, Len: 3, Data: make([]byte, 16)},
+			{ID: list, ListID: NewID("INFO"), Chunks: []*Chunk{{ID: list, ListID: NewID("labl")}}},
+			{ID: NewID("data"), Len: 100, Data: []byte("odd"), padByte: 0xff},
+		}}
+	}
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		leafBytes("data", []byte("odd")),
+	)
+	c := build()
+	if err := c.Normalize(true); err != nil {
+		t.Fatalf("Normalize: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	c.WriteTo(buf)
+	if !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), exp)
+	}
+	if err := Validate(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	c = build()
+	c.Normalize(false)
+	if got := len(c.Chunks); got != 3 || c.Len != 4+24+24+12 {
+		t.Errorf("kept %v chunks with RIFF length %v", got, c.Len)
+	}
+
+	c.Chunks[1].Chunks[0].Chunks = []*Chunk{c}
+	if err := c.Normalize(true); err == nil {
+		t.Errorf("expected error normalizing a cyclic tree")
+	}
+}
+
+func TestFilterChildrenCyclic(t *testing.T) {
+	c := cyclicTree()
+	c.FilterChildren(func(c *Chunk) bool { return c.ID != NewID("INAM") }, true)
+	if l := c.Chunks[1]; len(l.Chunks) != 1 || l.Chunks[0] != l {
+		t.Errorf("got %v subchunks after filtering", len(l.Chunks))
+	}
+}
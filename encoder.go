@@ -0,0 +1,340 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// EncoderFunc serializes the Content of a chunk into its Data, performing
+// the reverse operation of a DecoderFunc.
+type EncoderFunc func(interface{}) ([]byte, error)
+
+// Encoder writes chunk trees to an output stream.
+type Encoder struct {
+	// PruneEmptyLists makes Encode drop every LIST chunk without subchunks,
+	// including those left empty after dropping their own empty LISTs,
+	// rather than writing them with just a form type. The lengths of the
+	// containers holding them are reduced accordingly. The encoded tree is
+	// not modified.
+	PruneEmptyLists bool
+
+	// RF64 makes Encode write RIFF chunks as RF64 even if they are smaller
+	// than 4GiB. See Encode.
+	RF64 bool
+
+	// PadOddChunks, set by NewEncoder, makes Encode and EncodeStreaming
+	// follow every odd-length chunk with a pad byte, as RIFF requires.
+	// Unset, the next chunk follows right after, and the lengths of
+	// containers don't count pad bytes, as some nonconformant readers
+	// expect. Such files are read back with Decoder.Unpadded. RF64 chunks
+	// are always padded.
+	PadOddChunks bool
+
+	// UpdateLengths makes Encode compute the length of every chunk from its
+	// content, as Chunk.UpdateLengths does, for trees built or edited in
+	// memory without keeping their lengths in sync. The encoded tree is not
+	// modified.
+	UpdateLengths bool
+
+	w     io.Writer
+	funcs map[ID]EncoderFunc
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, funcs: make(map[ID]EncoderFunc), PadOddChunks: true}
+}
+
+// Map registers f to encode the Content of every leaf chunk with the given
+// id. Leaves with a nil Content are written from their Data as usual.
+func (e *Encoder) Map(id ID, f EncoderFunc) error {
+	if isContainer(id) {
+		return fmt.Errorf("id %v is reserved", id)
+	}
+	e.funcs[id] = f
+	return nil
+}
+
+// Encode writes the tree rooted at c. Chunks whose Content is encoded by a
+// registered EncoderFunc are written with the resulting Data and the
+// lengths of their containers adjusted, without modifying the tree.
+//
+// A RIFF chunk too large for its length to fit in 32 bits, or holding a
+// "data" chunk that large, is written in the RF64 format instead: its ID is
+// "RF64", a "ds64" chunk holding the 64 bit sizes is written first, and the
+// lengths of the RF64 and data chunks are set to 0xFFFFFFFF. The sizes of
+// leaves are then taken from their Data rather than their Len. RF64 chunks,
+// as read by Decode, are written that way too.
+func (e *Encoder) Encode(c *Chunk) error {
+	if _, err := c.MaxDepth(); err != nil {
+		return err
+	}
+	if len(e.funcs) > 0 {
+		var err error
+		if c, err = e.encoded(c); err != nil {
+			return err
+		}
+	}
+	if e.UpdateLengths {
+		c = c.withLengths()
+	}
+	if e.PruneEmptyLists {
+		if c = c.pruned(); c == nil {
+			return nil
+		}
+	}
+	if c.ID == rf64ID || c.ID == riff && (e.RF64 || c.needsRF64()) {
+		w := &writer{w: e.w}
+		c.writeRF64(w)
+		return w.err
+	}
+	if !e.PadOddChunks {
+		_, err := c.unpadded().write(nil, e.w, false)
+		return err
+	}
+	_, err := c.WriteTo(e.w)
+	return err
+}
+
+// EncodeStreaming writes the tree rooted at c like Encode, except that
+// leaves without Data whose Content is an io.Reader, such as the samples of
+// a recording in progress, are written from that reader until its end. The
+// length of every container, and of those leaves, is written once its
+// content has been, seeking back to its header, so the writer must be an
+// io.WriteSeeker. The Len fields of the tree are ignored and left
+// unchanged.
+func (e *Encoder) EncodeStreaming(c *Chunk) error {
+	ws, ok := e.w.(io.WriteSeeker)
+	if !ok {
+		return fmt.Errorf("EncodeStreaming needs an io.WriteSeeker, got %T", e.w)
+	}
+	if _, err := c.MaxDepth(); err != nil {
+		return err
+	}
+	if len(e.funcs) > 0 {
+		var err error
+		if c, err = e.encoded(c); err != nil {
+			return err
+		}
+	}
+	if e.PruneEmptyLists {
+		if c = c.pruned(); c == nil {
+			return nil
+		}
+	}
+	s := &streamWriter{ws: ws, w: &writer{w: ws, unpadded: !e.PadOddChunks}}
+	_, err := s.write(c)
+	return err
+}
+
+// streamWriter writes chunks whose lengths are only known once they've
+// been written.
+type streamWriter struct {
+	ws io.WriteSeeker
+	w  *writer // counts the bytes written, but not the lengths patched
+}
+
+// write writes c and returns its length.
+func (s *streamWriter) write(c *Chunk) (uint32, error) {
+	start := s.w.n
+	if c.ID == riff || c.ID == rifx {
+		s.w.bigEndian = c.ID == rifx
+	}
+	s.w.Write(c.ID[:])
+	s.w.writeUint32(0)
+
+	var l int64
+	r, streamed := c.Content.(io.Reader)
+	switch {
+	case c.IsContainer():
+		s.w.Write(c.ListID[:])
+		l = 4
+		for _, sc := range c.Chunks {
+			n, err := s.write(sc)
+			if err != nil {
+				return 0, err
+			}
+			l += 8 + int64(n)
+			if !s.w.unpadded {
+				l += int64(n % 2)
+			}
+		}
+	case c.Data == nil && streamed:
+		if s.w.err == nil {
+			var err error
+			if l, err = io.Copy(s.w, r); err != nil && s.w.err == nil {
+				return 0, fmt.Errorf("stream %q: %v", c.ID, err)
+			}
+		}
+	default:
+		c.writeData(s.w)
+		l = c.dataLen()
+	}
+	if s.w.err != nil {
+		return 0, s.w.err
+	}
+	if l > math.MaxUint32 {
+		return 0, fmt.Errorf("chunk %q of %v bytes is too large for a 32 bit length", c.ID, l)
+	}
+	if l%2 != 0 && !s.w.unpadded {
+		s.w.Write([]byte{0})
+	}
+
+	// Patch the length, then come back to the end of the chunk.
+	end := s.w.n
+	var b [4]byte
+	if s.w.bigEndian {
+		binary.BigEndian.PutUint32(b[:], uint32(l))
+	} else {
+		binary.LittleEndian.PutUint32(b[:], uint32(l))
+	}
+	if _, err := s.ws.Seek(start+4-end, io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	if _, err := s.ws.Write(b[:]); err != nil {
+		return 0, err
+	}
+	if _, err := s.ws.Seek(end-start-8, io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	return uint32(l), s.w.err
+}
+
+// encoded returns a copy of the tree rooted at c with the Content of its
+// leaves encoded by the registered functions. Chunks without any encoded
+// descendant are shared with the original tree.
+func (e *Encoder) encoded(c *Chunk) (*Chunk, error) {
+	if !c.IsContainer() {
+		f, ok := e.funcs[c.ID]
+		if !ok || c.Content == nil {
+			return c, nil
+		}
+		data, err := f(c.Content)
+		if err != nil {
+			return nil, fmt.Errorf("encode %q: %v", c.ID, err)
+		}
+		ec := *c
+		ec.Data, ec.Len, ec.padByte = data, uint32(len(data)), 0
+		return &ec, nil
+	}
+	var chunks []*Chunk
+	for i, sc := range c.Chunks {
+		ec, err := e.encoded(sc)
+		if err != nil {
+			return nil, err
+		}
+		if ec != sc && chunks == nil {
+			chunks = append(make([]*Chunk, 0, len(c.Chunks)), c.Chunks[:i]...)
+		}
+		if chunks != nil {
+			chunks = append(chunks, ec)
+		}
+	}
+	if chunks == nil {
+		return c, nil
+	}
+	ec := *c
+	ec.Chunks = chunks
+	ec.updateLen()
+	return &ec, nil
+}
+
+// pruned returns a copy of the tree rooted at c without empty LIST chunks,
+// or nil if c itself is one. Leaves are shared with the original tree.
+func (c *Chunk) pruned() *Chunk {
+	if !c.IsContainer() {
+		return c
+	}
+	p := *c
+	p.Chunks = nil
+	for _, sc := range c.Chunks {
+		ps := sc.pruned()
+		if ps == nil {
+			p.Len -= 8 + sc.Len + sc.Len%2
+			continue
+		}
+		p.Len = p.Len - sc.Len + ps.Len
+		p.Chunks = append(p.Chunks, ps)
+	}
+	if p.ID == list && len(p.Chunks) == 0 {
+		return nil
+	}
+	return &p
+}
+
+// withLengths returns a copy of the tree rooted at c with its lengths
+// updated as by UpdateLengths. Leaves share their data with the original
+// tree.
+func (c *Chunk) withLengths() *Chunk {
+	cc := *c
+	if !c.IsContainer() {
+		if c.loaded() {
+			cc.Len = uint32(c.dataLen())
+		}
+		return &cc
+	}
+	cc.Chunks = make([]*Chunk, len(c.Chunks))
+	for i, sc := range c.Chunks {
+		cc.Chunks[i] = sc.withLengths()
+	}
+	cc.updateLen()
+	return &cc
+}
+
+// unpadded returns a copy of the tree rooted at c with the lengths of its
+// containers not counting the pad bytes of their subchunks. Leaves are
+// shared with the original tree.
+func (c *Chunk) unpadded() *Chunk {
+	if !c.IsContainer() {
+		return c
+	}
+	u := *c
+	u.Chunks = make([]*Chunk, len(c.Chunks))
+	u.Len = 4
+	for i, sc := range c.Chunks {
+		u.Chunks[i] = sc.unpadded()
+		u.Len += 8 + u.Chunks[i].Len
+	}
+	return &u
+}
+
+// BufferedEncoder assembles a RIFF tree in memory, so that chunks can be
+// added in any order to any container, and writes it at once with lengths
+// computed from the data added. It suits writers that can't seek, as long
+// as the file fits in memory.
+type BufferedEncoder struct {
+	root *Chunk
+}
+
+// NewBufferedEncoder returns a BufferedEncoder for a RIFF file of the given
+// form type.
+func NewBufferedEncoder(form ID) *BufferedEncoder {
+	return &BufferedEncoder{root: &Chunk{ID: riff, ListID: form}}
+}
+
+// Add appends child to the subchunks of the container found by following
+// parentPath from the RIFF chunk, as in Chunk.FindChunk; an empty path
+// designates the RIFF chunk itself. The lengths of child and of its
+// subchunks don't need to be set.
+func (e *BufferedEncoder) Add(parentPath []ID, child *Chunk) error {
+	p := e.root.FindChunk(parentPath...)
+	if p == nil {
+		return fmt.Errorf("no chunk found at %q", parentPath)
+	}
+	if !p.IsContainer() {
+		return fmt.Errorf("can't add %q to leaf %q", child.ID, p.ID)
+	}
+	p.Chunks = append(p.Chunks, child)
+	return nil
+}
+
+// Flush computes the lengths of every chunk added, with UpdateLengths, and
+// writes the whole tree to w.
+func (e *BufferedEncoder) Flush(w io.Writer) (int64, error) {
+	if err := e.root.UpdateLengths(); err != nil {
+		return 0, err
+	}
+	return e.root.WriteTo(w)
+}
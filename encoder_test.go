@@ -0,0 +1,310 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPruneEmptyLists(t *testing.T) {
+	full := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO"),
+		listBytes("LIST", "adtl", listBytes("LIST", "labl")),
+		leafBytes("data", []byte("odd")),
+	)
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		leafBytes("data", []byte("odd")),
+	)
+	c, err := NewDecoder(bytes.NewReader(full)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	for _, prune := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		e := NewEncoder(buf)
+		e.PruneEmptyLists = prune
+		if err := e.Encode(c); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		want := full
+		if prune {
+			want = exp
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("prune %v: got %q, expected %q", prune, buf.Bytes(), want)
+		}
+	}
+	if len(c.Chunks) != 4 {
+		t.Errorf("Encode modified the tree, it has %v chunks", len(c.Chunks))
+	}
+
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf)
+	e.PruneEmptyLists = true
+	if err := e.Encode(&Chunk{ID: NewID("LIST"), Len: 4, ListID: NewID("INFO")}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("empty root LIST: wrote %q", buf.Bytes())
+	}
+}
+
+func TestBufferedEncoder(t *testing.T) {
+	e := NewBufferedEncoder(NewID("WAVE"))
+	for _, add := range []struct {
+		path  []ID
+		chunk *Chunk
+	}{
+		{nil, &Chunk{ID: NewID("fmt "), Data: make([]byte, 16)}},
+		{nil, &Chunk{ID: NewID("LIST"), ListID: NewID("INFO")}},
+		{nil, &Chunk{ID: NewID("data"), Data: []byte("odd")}},
+		{[]ID{NewID("INFO")}, &Chunk{ID: NewID("INAM"), Data: []byte("name\x00")}},
+		{[]ID{NewID("INFO")}, &Chunk{ID: NewID("ISFT"), Data: []byte("riff")}},
+	} {
+		if err := e.Add(add.path, add.chunk); err != nil {
+			t.Fatalf("Add %q: %v", add.chunk.ID, err)
+		}
+	}
+	if err := e.Add([]ID{NewID("adtl")}, &Chunk{ID: NewID("labl")}); err == nil {
+		t.Errorf("expected error adding to a missing container")
+	}
+	if err := e.Add([]ID{NewID("data")}, &Chunk{ID: NewID("labl")}); err == nil {
+		t.Errorf("expected error adding to a leaf")
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := e.Flush(buf)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO",
+			leafBytes("INAM", []byte("name\x00")),
+			leafBytes("ISFT", []byte("riff")),
+		),
+		leafBytes("data", []byte("odd")),
+	)
+	if n != int64(len(exp)) || !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("wrote %v bytes %q, expected %q", n, buf.Bytes(), exp)
+	}
+}
+
+func TestEncodeStreaming(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("prefix")
+
+	root := &Chunk{ID: riff, ListID: NewID("WAVE"), Chunks: []*Chunk{
+		{ID: NewID("fmt "), Len: 16, Data: make([]byte, 16)},
+		{ID: list, ListID: NewID("INFO"), Chunks: []*Chunk{{ID: NewID("INAM"), Data: []byte("odd")}}},
+		{ID: NewID("data"), Content: strings.NewReader("samples")},
+	}}
+	if err := NewEncoder(f).EncodeStreaming(root); err != nil {
+		t.Fatalf("EncodeStreaming: %v", err)
+	}
+	f.WriteString("suffix")
+
+	got, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "prefix" + string(listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("odd"))),
+		leafBytes("data", []byte("samples")),
+	)) + "suffix"
+	if string(got) != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+	if root.Len != 0 || root.Chunks[2].Len != 0 {
+		t.Errorf("the encoded tree was modified")
+	}
+
+	if err := NewEncoder(new(bytes.Buffer)).EncodeStreaming(root); err == nil {
+		t.Errorf("expected error encoding to a writer that can't seek")
+	}
+}
+
+func TestEncodeStreamingCyclic(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	l := &Chunk{ID: list, ListID: NewID("INFO")}
+	l.Chunks = []*Chunk{l}
+	if err := NewEncoder(f).EncodeStreaming(&Chunk{ID: riff, ListID: NewID("WAVE"), Chunks: []*Chunk{l}}); err == nil {
+		t.Errorf("expected error encoding a cyclic tree")
+	}
+	if st, err := f.Stat(); err != nil || st.Size() != 0 {
+		t.Errorf("wrote %v bytes, expected none", st.Size())
+	}
+}
+
+func TestPadOddChunks(t *testing.T) {
+	root := &Chunk{ID: riff, ListID: NewID("WAVE"), Chunks: []*Chunk{
+		{ID: NewID("fmt "), Data: make([]byte, 16)},
+		{ID: list, ListID: NewID("INFO"), Chunks: []*Chunk{{ID: NewID("INAM"), Data: []byte("odd")}}},
+		{ID: NewID("data"), Data: []byte("samples")},
+	}}
+	if err := root.UpdateLengths(); err != nil {
+		t.Fatal(err)
+	}
+	padded := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("odd"))),
+		leafBytes("data", []byte("samples")),
+	)
+	// Unpadded chunks are the padded ones without their last byte, and
+	// lengths not counting it.
+	unpadded := append([]byte("RIFF\x42\x00\x00\x00WAVE"), padded[12:36]...)
+	unpadded = append(unpadded, "LIST\x0f\x00\x00\x00INFOINAM\x03\x00\x00\x00odd"...)
+	unpadded = append(unpadded, "data\x07\x00\x00\x00samples"...)
+
+	for _, pad := range []bool{true, false} {
+		exp := padded
+		if !pad {
+			exp = unpadded
+		}
+		buf := new(bytes.Buffer)
+		e := NewEncoder(buf)
+		e.PadOddChunks = pad
+		if err := e.Encode(root); err != nil {
+			t.Fatalf("pad %v: Encode: %v", pad, err)
+		}
+		if !bytes.Equal(buf.Bytes(), exp) {
+			t.Errorf("pad %v: got %q, expected %q", pad, buf.Bytes(), exp)
+		}
+
+		d := NewDecoder(bytes.NewReader(buf.Bytes()))
+		d.Unpadded = !pad
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("pad %v: Decode: %v", pad, err)
+		}
+		if !EqualContent(c, root) {
+			t.Errorf("pad %v: decoded %v, expected %v", pad, c, root)
+		}
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		e = NewEncoder(f)
+		e.PadOddChunks = pad
+		err = e.EncodeStreaming(root)
+		f.Close()
+		if err != nil {
+			t.Fatalf("pad %v: EncodeStreaming: %v", pad, err)
+		}
+		if got, err := ioutil.ReadFile(f.Name()); err != nil || !bytes.Equal(got, exp) {
+			t.Errorf("pad %v: EncodeStreaming wrote %q, %v; expected %q", pad, got, err, exp)
+		}
+	}
+	if _, err := NewDecoder(bytes.NewReader(unpadded)).Decode(); err == nil {
+		t.Errorf("expected error decoding unpadded chunks without Unpadded")
+	}
+}
+
+func TestEncoderUpdateLengths(t *testing.T) {
+	root := &Chunk{ID: riff, ListID: NewID("WAVE"), Chunks: []*Chunk{
+		{ID: NewID("fmt "), Data: make([]byte, 16)},
+		{ID: list, ListID: NewID("INFO"), Chunks: []*Chunk{{ID: NewID("INAM"), Data: []byte("odd")}}},
+		{ID: NewID("data"), Data: []byte("samples")},
+	}}
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf)
+	e.UpdateLengths = true
+	if err := e.Encode(root); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("odd"))),
+		leafBytes("data", []byte("samples")),
+	)
+	if !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), exp)
+	}
+	if root.Len != 0 || root.Chunks[1].Len != 0 || root.Chunks[2].Len != 0 {
+		t.Errorf("the encoded tree was modified")
+	}
+
+	c, err := NewDecoder(bytes.NewReader(buf.Bytes())).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	root.UpdateLengths()
+	for i, l := range []uint32{16, 16, 7} {
+		if got := c.Chunks[i].Len; got != l || got != root.Chunks[i].Len {
+			t.Errorf("chunk #%v: decoded length %v, expected %v", i, got, l)
+		}
+	}
+}
+
+func TestEncoderMap(t *testing.T) {
+	b, err := ioutil.ReadFile("data/odd.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(fmtID, WaveFmtDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	fc := c.FindChunk(fmtID)
+	f := fc.Content.(WaveFmt)
+	f.SampleRate = 16000
+	fc.Content = f
+
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf)
+	if err := e.Map(list, WaveFmtEncoder); err == nil {
+		t.Errorf("expected error mapping a container id")
+	}
+	if err := e.Map(fmtID, WaveFmtEncoder); err != nil {
+		t.Fatalf("Map: %v", err)
+	}
+	if err := e.Encode(c); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	w, err := OpenWAV(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("OpenWAV: %v", err)
+	}
+	if !reflect.DeepEqual(w.Format, f) {
+		t.Errorf("got format %+v, expected %+v", w.Format, f)
+	}
+	if got := binary.LittleEndian.Uint32(fc.Data[4:]); got != 8000 {
+		t.Errorf("the Data of the encoded tree was modified, sample rate %v", got)
+	}
+
+	// Without Content, Data is written as is.
+	fc.Content = nil
+	buf.Reset()
+	if err := e.Encode(c); err != nil || !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("got %q, %v; expected the original file", buf.Bytes(), err)
+	}
+}
+
+func TestEncodeCyclic(t *testing.T) {
+	e := NewEncoder(ioutil.Discard)
+	e.Map(NewID("INAM"), func(v interface{}) ([]byte, error) { return nil, nil })
+	e.PruneEmptyLists, e.RF64 = true, true
+	if err := e.Encode(cyclicTree()); err == nil {
+		t.Errorf("expected error encoding a cyclic tree")
+	}
+}
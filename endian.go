@@ -0,0 +1,93 @@
+package riff
+
+import "encoding/binary"
+
+// cueID is the ID of the cue points chunk of WAV files.
+var cueID = ID{'c', 'u', 'e', ' '}
+
+// fieldLayouts give the sizes in bytes of the numeric fields of the data of
+// chunks whose byte order ToLittleEndian and ToBigEndian know how to swap,
+// given their data and its byte order. Negative sizes are fields of bytes
+// kept as they are, such as IDs, and bytes past the last field are kept as
+// they are too.
+var fieldLayouts = map[ID]func(data []byte, order binary.ByteOrder) []int{
+	fmtID: func(data []byte, order binary.ByteOrder) []int {
+		// FormatTag, Channels, SampleRate, ByteRate, BlockAlign,
+		// BitsPerSample and cbSize.
+		fields := []int{2, 2, 4, 4, 2, 2, 2}
+		if len(data) >= 2 && order.Uint16(data) == WaveFormatExtensible {
+			// ValidBitsPerSample, ChannelMask and the SubFormat GUID.
+			fields = append(fields, 2, 4, 4, 2, 2, -8)
+		}
+		return fields
+	},
+	factID: func([]byte, binary.ByteOrder) []int { return []int{4} },
+	cueID: func(data []byte, order binary.ByteOrder) []int {
+		fields := []int{4}
+		for i := 4; i+24 <= len(data); i += 24 {
+			// ID, Position, the ID of the chunk holding the cue, ChunkStart,
+			// BlockStart and SampleOffset.
+			fields = append(fields, 4, 4, -4, 4, 4, 4)
+		}
+		return fields
+	},
+}
+
+// ToLittleEndian returns a copy of the RIFX tree rooted at c converted to a
+// RIFF tree, or c itself if it isn't a RIFX chunk. The numeric fields of
+// the "fmt ", "fact" and "cue " chunks are byte swapped, but the data of
+// other chunks is copied as it is, which is wrong for chunks holding
+// numbers in the byte order of the file. Content is copied unchanged.
+func (c *Chunk) ToLittleEndian() *Chunk {
+	if c.ID != rifx {
+		return c
+	}
+	cc := c.swapped(binary.BigEndian)
+	cc.ID = riff
+	return cc
+}
+
+// ToBigEndian is the reverse of ToLittleEndian, converting a RIFF tree to a
+// RIFX tree, with the same limitations.
+func (c *Chunk) ToBigEndian() *Chunk {
+	if c.ID != riff {
+		return c
+	}
+	cc := c.swapped(binary.LittleEndian)
+	cc.ID = rifx
+	return cc
+}
+
+// swapped returns a copy of the tree rooted at c with the numeric fields of
+// the chunks found in fieldLayouts, currently in the given byte order,
+// byte swapped.
+func (c *Chunk) swapped(order binary.ByteOrder) *Chunk {
+	cc := *c
+	if c.IsContainer() {
+		cc.Chunks = make([]*Chunk, len(c.Chunks))
+		for i, sc := range c.Chunks {
+			cc.Chunks[i] = sc.swapped(order)
+		}
+		return &cc
+	}
+	layout, ok := fieldLayouts[c.ID]
+	if !ok || c.Data == nil {
+		return &cc
+	}
+	cc.Data = append([]byte(nil), c.Data...)
+	off := 0
+	for _, n := range layout(c.Data, order) {
+		if n < 0 {
+			off -= n
+			continue
+		}
+		if off+n > len(cc.Data) {
+			break
+		}
+		for i, j := off, off+n-1; i < j; i, j = i+1, j-1 {
+			cc.Data[i], cc.Data[j] = cc.Data[j], cc.Data[i]
+		}
+		off += n
+	}
+	return &cc
+}
@@ -0,0 +1,61 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestToLittleEndian(t *testing.T) {
+	// fmtData returns a PCM fmt chunk followed by one extra byte, and a
+	// fact chunk, in the given byte order.
+	fmtData := func(order binary.AppendByteOrder) ([]byte, []byte) {
+		b := order.AppendUint16(nil, WaveFormatPCM)
+		b = order.AppendUint16(b, 2)
+		b = order.AppendUint32(b, 44100)
+		b = order.AppendUint32(b, 176400)
+		b = order.AppendUint16(b, 4)
+		b = order.AppendUint16(b, 16)
+		b = order.AppendUint16(b, 1)
+		return append(b, 0xab), order.AppendUint32(nil, 1234)
+	}
+	file := func(build func(ID, ...ChunkSpec) []byte, order binary.AppendByteOrder) []byte {
+		f, fact := fmtData(order)
+		return build(NewID("WAVE"),
+			ChunkSpec{ID: "fmt ", Data: f},
+			ChunkSpec{ID: "fact", Data: fact},
+			ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("odd")}}},
+			ChunkSpec{ID: "data", Data: []byte{1, 2, 3, 4}},
+		)
+	}
+	be, le := file(BuildRIFX, binary.BigEndian), file(BuildRIFF, binary.LittleEndian)
+
+	c, err := NewDecoder(bytes.NewReader(be)).Decode()
+	if err != nil {
+		t.Fatalf("decode RIFX: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil || !bytes.Equal(buf.Bytes(), be) {
+		t.Fatalf("RIFX written back as %q, %v; expected %q", buf.Bytes(), err, be)
+	}
+
+	l := c.ToLittleEndian()
+	buf.Reset()
+	l.WriteTo(buf)
+	if !bytes.Equal(buf.Bytes(), le) {
+		t.Errorf("ToLittleEndian got %q, expected %q", buf.Bytes(), le)
+	}
+	buf.Reset()
+	l.ToBigEndian().WriteTo(buf)
+	if !bytes.Equal(buf.Bytes(), be) {
+		t.Errorf("ToBigEndian got %q, expected %q", buf.Bytes(), be)
+	}
+	buf.Reset()
+	c.WriteTo(buf)
+	if !bytes.Equal(buf.Bytes(), be) {
+		t.Errorf("converting modified the original tree")
+	}
+	if l.ToLittleEndian() != l {
+		t.Errorf("ToLittleEndian of a RIFF tree should return it unchanged")
+	}
+}
@@ -0,0 +1,85 @@
+package riff
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// File gives random access to the chunks of a RIFF file without loading
+// their data in memory. Use a Decoder to load a whole file instead.
+type File struct {
+	// Chunks holds the structure of every top-level chunk of the file, as
+	// returned by Decoder.DecodeStructure.
+	Chunks []*Chunk
+
+	r io.ReadSeeker
+}
+
+// OpenFile indexes the headers of every chunk of the file read from r,
+// seeking past their data.
+func OpenFile(r io.ReadSeeker) (*File, error) {
+	f := &File{r: r}
+	d := NewDecoder(r)
+	for {
+		c, err := d.DecodeStructure()
+		if err == io.EOF {
+			return f, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("index chunk #%v: %w", len(f.Chunks), err)
+		}
+		f.Chunks = append(f.Chunks, c)
+	}
+}
+
+// Chunk returns the chunk found by following path, as in Chunk.FindChunk,
+// with its first element selecting a top-level chunk. The chunk is returned
+// from the index so leaves have no Data; the returned reader streams the
+// Len bytes following its header instead, form type included for
+// containers. The reader reads directly from the file, so it is only valid
+// until the next call to Chunk.
+func (f *File) Chunk(path ...ID) (*Chunk, io.Reader, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("empty chunk path")
+	}
+	c := (&Chunk{Chunks: f.Chunks}).FindChunk(path...)
+	if c == nil {
+		return nil, nil, fmt.Errorf("no chunk found at %q", path)
+	}
+	if _, err := f.r.Seek(c.Offset+8, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	return c, io.LimitReader(f.r, int64(c.Len)), nil
+}
+
+// chunkOverhead is the memory taken by a decoded chunk besides its data:
+// the Chunk itself and the pointer to it held by its container.
+const chunkOverhead = int64(unsafe.Sizeof(Chunk{}) + unsafe.Sizeof(&Chunk{}))
+
+// EstimateMemory returns the number of bytes a Decoder without any
+// DecoderFunc needs to decode the next chunk of r: the data of its leaves
+// plus the overhead of every chunk. Only chunk headers are read, seeking
+// past the data, and r is then positioned back where it was so the chunk
+// can be decoded, or not.
+func EstimateMemory(r io.ReadSeeker) (int64, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	c, err := NewDecoder(r).DecodeStructure()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	c.walk(func(c *Chunk) {
+		total += chunkOverhead
+		if !c.IsContainer() {
+			total += int64(c.Len)
+		}
+	})
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
@@ -0,0 +1,85 @@
+package riff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	raw, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	second := listBytes("RIFF", "AVI ", leafBytes("avih", []byte("header")))
+	f, err := OpenFile(bytes.NewReader(append(append([]byte{}, raw...), second...)))
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if len(f.Chunks) != 2 {
+		t.Fatalf("got %v top-level chunks, expected 2", len(f.Chunks))
+	}
+
+	for _, tt := range []struct {
+		path []ID
+		data []byte
+	}{
+		{[]ID{NewID("WAVE"), NewID("data")}, raw[70 : 70+7800]},
+		{[]ID{NewID("WAVE"), NewID("INFO"), NewID("ISFT")}, raw[7890 : 7890+62]},
+		{[]ID{NewID("AVI "), NewID("avih")}, []byte("header")},
+	} {
+		c, r, err := f.Chunk(tt.path...)
+		if err != nil {
+			t.Fatalf("%q: Chunk: %v", tt.path, err)
+		}
+		if c.ID != tt.path[len(tt.path)-1] || c.Data != nil {
+			t.Errorf("%q: got chunk %v", tt.path, c)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%q: read: %v", tt.path, err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("%q: read %v bytes, expected %v", tt.path, len(got), len(tt.data))
+		}
+	}
+
+	if _, _, err := f.Chunk(NewID("WAVE"), NewID("idx1")); err == nil {
+		t.Errorf("expected error for a missing chunk")
+	}
+	if _, _, err := f.Chunk(); err == nil {
+		t.Errorf("expected error for an empty path")
+	}
+
+	osf, err := os.Open("data/odd.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer osf.Close()
+	if _, err := OpenFile(osf); err != nil {
+		t.Errorf("OpenFile(%v): %v", osf.Name(), err)
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	b := listBytes("RIFF", "TEST",
+		leafBytes("data", make([]byte, 1000)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("odd"))),
+	)
+	r := bytes.NewReader(append(b, "trailing"...))
+	got, err := EstimateMemory(r)
+	if err != nil {
+		t.Fatalf("EstimateMemory: %v", err)
+	}
+	if exp := 1003 + 4*chunkOverhead; got != exp {
+		t.Errorf("got %v bytes, expected %v", got, exp)
+	}
+	if r.Len() != len(b)+8 {
+		t.Errorf("reader left at %v bytes from the end, expected the start", r.Len())
+	}
+
+	if _, err := EstimateMemory(bytes.NewReader(b[:20])); err == nil {
+		t.Errorf("expected error for a truncated file")
+	}
+}
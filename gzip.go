@@ -0,0 +1,16 @@
+package riff
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// NewGzipDecoder returns a Decoder reading the RIFF file compressed with gzip
+// in r.
+func NewGzipDecoder(r io.Reader) (*Decoder, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewDecoder(zr), nil
+}
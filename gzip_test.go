@@ -0,0 +1,75 @@
+package riff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestGzipDecoder(t *testing.T) {
+	orig, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+
+	gz := new(bytes.Buffer)
+	zw := gzip.NewWriter(gz)
+	zw.Write(orig)
+	zw.Close()
+
+	d, err := NewGzipDecoder(iotest.HalfReader(gz))
+	if err != nil {
+		t.Fatalf("NewGzipDecoder: %v", err)
+	}
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	gz.Reset()
+	zw.Reset(gz)
+	if _, err := c.WriteTo(zw); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	zw.Close()
+
+	zr, err := gzip.NewReader(gz)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, orig) {
+		t.Errorf("file changed after a round trip through gzip")
+	}
+
+	if _, err := NewGzipDecoder(bytes.NewReader(orig)); err == nil {
+		t.Errorf("expected error for data that isn't gzip compressed")
+	}
+}
+
+func TestShortReads(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	c, err := NewDecoder(iotest.OneByteReader(bytes.NewReader(b))).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if c.Len != 7944 || len(c.Chunks) != 4 {
+		t.Errorf("unexpected chunk %v", c)
+	}
+
+	_, err = NewDecoder(iotest.HalfReader(bytes.NewReader(b[:5000]))).Decode()
+	if !errors.Is(err, io.ErrUnexpectedEOF) || !strings.Contains(err.Error(), `chunk "data" truncated after 4930 of 7800 bytes`) {
+		t.Errorf("truncated file: got error %v", err)
+	}
+}
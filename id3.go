@@ -0,0 +1,77 @@
+package riff
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// IDs used by WAV writers for chunks holding an ID3v2 tag.
+var (
+	ID3Lower = NewID("id3 ")
+	ID3Upper = NewID("ID3 ")
+)
+
+// ID3Tag is the Content of ID3 chunks decoded with ID3Decoder.
+type ID3Tag struct {
+	ID3Header
+	Raw []byte // Whole ID3v2 block, header included, for an ID3 library
+}
+
+// ID3Decoder is a DecoderFunc for ID3Lower and ID3Upper chunks. Content is
+// set to an ID3Tag holding the parsed header of the tag, as returned by
+// ParseID3Header, and its raw block. Frames are not parsed.
+func ID3Decoder(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ParseID3Header(b)
+	if err != nil {
+		return nil, err
+	}
+	return ID3Tag{ID3Header: h, Raw: b}, nil
+}
+
+// ID3 returns the raw ID3v2 block of the first ID3 chunk found in the tree
+// rooted at c, or nil if there is none.
+func (c *Chunk) ID3() []byte {
+	t := c.first(func(c *Chunk) bool { return c.ID == ID3Lower || c.ID == ID3Upper })
+	if t == nil {
+		return nil
+	}
+	switch v := t.Content.(type) {
+	case ID3Tag:
+		return v.Raw
+	case []byte:
+		return v
+	}
+	return t.Data
+}
+
+// ID3Header is the 10 byte header opening an ID3v2 tag.
+type ID3Header struct {
+	Major, Revision uint8 // Version of the tag, 3 for ID3v2.3.0
+	Flags           uint8
+	Size            uint32 // Length of the tag following the header
+}
+
+// ParseID3Header parses the ID3v2 header at the start of b, as returned by
+// ID3, checking its "ID3" identifier and decoding its syncsafe size. Frames
+// are left to the caller.
+func ParseID3Header(b []byte) (ID3Header, error) {
+	if len(b) < 10 {
+		return ID3Header{}, fmt.Errorf("ID3v2 header too short: %v bytes", len(b))
+	}
+	if string(b[:3]) != "ID3" {
+		return ID3Header{}, fmt.Errorf("bad ID3v2 identifier %q", b[:3])
+	}
+	h := ID3Header{Major: b[3], Revision: b[4], Flags: b[5]}
+	for _, v := range b[6:10] {
+		if v&0x80 != 0 {
+			return ID3Header{}, fmt.Errorf("ID3v2 size % x isn't syncsafe", b[6:10])
+		}
+		h.Size = h.Size<<7 | uint32(v)
+	}
+	return h, nil
+}
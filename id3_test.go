@@ -0,0 +1,62 @@
+package riff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestID3(t *testing.T) {
+	tag := []byte("ID3\x03\x00\x00\x00\x00\x00\x02xy")
+	for _, id := range []string{"id3 ", "ID3 "} {
+		b := listBytes("RIFF", "WAVE",
+			leafBytes("fmt ", make([]byte, 16)),
+			leafBytes(id, tag),
+		)
+		d := NewDecoder(bytes.NewReader(b))
+		d.Map(ID3Lower, ID3Decoder)
+		d.Map(ID3Upper, ID3Decoder)
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("decode %q: %v", id, err)
+		}
+		got, ok := c.Chunks[1].Content.(ID3Tag)
+		if exp := (ID3Header{Major: 3, Size: 2}); !ok || got.ID3Header != exp || !bytes.Equal(got.Raw, tag) {
+			t.Errorf("%q content: got %+v, expected %+v and %q", id, c.Chunks[1].Content, exp, tag)
+		}
+		if got := c.ID3(); !bytes.Equal(got, tag) {
+			t.Errorf("%q ID3(): got %q, expected %q", id, got, tag)
+		}
+	}
+
+	b := listBytes("RIFF", "WAVE", leafBytes("id3 ", []byte("TAG\x03")))
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(ID3Lower, ID3Decoder)
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected error decoding a bad ID3v2 tag")
+	}
+
+	c := &Chunk{ID: NewID("RIFF"), ListID: NewID("WAVE")}
+	if got := c.ID3(); got != nil {
+		t.Errorf("ID3() without tag: got %q, expected nil", got)
+	}
+}
+
+func TestParseID3Header(t *testing.T) {
+	h, err := ParseID3Header([]byte("ID3\x04\x00\x40\x00\x00\x02\x01rest"))
+	if err != nil {
+		t.Fatalf("ParseID3Header: %v", err)
+	}
+	if exp := (ID3Header{Major: 4, Flags: 0x40, Size: 2<<7 | 1}); h != exp {
+		t.Errorf("got %+v, expected %+v", h, exp)
+	}
+
+	for _, b := range []string{
+		"ID3\x03\x00\x00\x00\x00",         // too short
+		"TAG\x03\x00\x00\x00\x00\x00\x02", // bad identifier
+		"ID3\x03\x00\x00\x00\x00\x80\x02", // not syncsafe
+	} {
+		if _, err := ParseID3Header([]byte(b)); err == nil {
+			t.Errorf("%q: expected error", b)
+		}
+	}
+}
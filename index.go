@@ -0,0 +1,108 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Index is a table of contents of a RIFF stream, lighter than the tree
+// returned by DecodeStructure: it is a single slice, with no Chunk
+// allocated per chunk.
+type Index struct {
+	Entries []IndexEntry // Every chunk, in depth-first order
+}
+
+// IndexEntry describes a chunk of an Index.
+type IndexEntry struct {
+	ID       ID
+	FormType ID     // Form type of containers, zero for leaves
+	Offset   int64  // Offset of the chunk header from the start of the scan
+	Len      uint32 // Length of the chunk, as declared in its header
+	Depth    int    // Number of containers around the chunk
+}
+
+// ReadIndex scans the RIFF or RIFX chunk read from r, starting at its
+// current offset, and returns the index of its chunks. Only the headers of
+// the chunks and the form types of containers are read, the data of leaves
+// is seeked past, and r is left right after the chunk. Chunks overrunning
+// their container or the end of r are an error.
+func ReadIndex(r io.ReadSeeker) (*Index, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	size -= start
+
+	ix := &Index{}
+	var order binary.ByteOrder = binary.LittleEndian
+	var open []IndexEntry // containers around the next chunk
+	var b [8]byte
+	for off := int64(0); ; {
+		for len(open) > 0 {
+			c := open[len(open)-1]
+			end := c.Offset + 8 + int64(c.Len)
+			if off < end {
+				break
+			}
+			open = open[:len(open)-1]
+			off = end + int64(c.Len%2)
+			if len(open) == 0 {
+				_, err := r.Seek(start+min(off, size), io.SeekStart)
+				return ix, err
+			}
+		}
+		if len(open) > 0 {
+			c := open[len(open)-1]
+			if left := c.Offset + 8 + int64(c.Len) - off; left < 8 {
+				return nil, fmt.Errorf("offset %v: %v stray bytes at the end of %q", off, left, c.FormType)
+			}
+		}
+
+		if _, err := r.Seek(start+off, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, b[:8]); err != nil {
+			return nil, fmt.Errorf("offset %v: read chunk header: %w", off, err)
+		}
+		e := IndexEntry{Offset: off, Depth: len(open)}
+		copy(e.ID[:], b[:4])
+		if len(open) == 0 {
+			if e.ID != riff && e.ID != rifx {
+				return nil, fmt.Errorf("not a RIFF stream, top-level id is %q", e.ID)
+			}
+			if e.ID == rifx {
+				order = binary.BigEndian
+			}
+		}
+		e.Len = order.Uint32(b[4:])
+		end := off + 8 + int64(e.Len)
+		if len(open) > 0 {
+			c := open[len(open)-1]
+			if cend := c.Offset + 8 + int64(c.Len); end > cend {
+				return nil, fmt.Errorf("offset %v: chunk %q of length %v overruns %q by %v bytes", off, e.ID, e.Len, c.FormType, end-cend)
+			}
+		}
+		if end > size {
+			return nil, fmt.Errorf("offset %v: chunk %q of length %v truncated after %v bytes", off, e.ID, e.Len, size-off-8)
+		}
+
+		if isContainer(e.ID) {
+			if e.Len < 4 {
+				return nil, fmt.Errorf("offset %v: container of length %v has no room for a form type", off, e.Len)
+			}
+			if _, err := io.ReadFull(r, e.FormType[:]); err != nil {
+				return nil, fmt.Errorf("offset %v: read form type: %w", off, err)
+			}
+			open = append(open, e)
+			off += 12
+		} else {
+			off = end + int64(e.Len%2)
+		}
+		ix.Entries = append(ix.Entries, e)
+	}
+}
@@ -0,0 +1,68 @@
+package riff
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadIndex(t *testing.T) {
+	f, err := os.Open("data/odd.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+	ix, err := ReadIndex(f)
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+
+	f.Seek(0, io.SeekStart)
+	c, err := NewDecoder(f).DecodeStructure()
+	if err != nil {
+		t.Fatalf("DecodeStructure: %v", err)
+	}
+	var exp []IndexEntry
+	var flatten func(c *Chunk, depth int)
+	flatten = func(c *Chunk, depth int) {
+		exp = append(exp, IndexEntry{ID: c.ID, FormType: c.ListID, Offset: c.Offset, Len: c.Len, Depth: depth})
+		for _, sc := range c.Chunks {
+			flatten(sc, depth+1)
+		}
+	}
+	flatten(c, 0)
+	if len(ix.Entries) != len(exp) {
+		t.Fatalf("got %v entries, expected %v", len(ix.Entries), len(exp))
+	}
+	for i, e := range ix.Entries {
+		if e != exp[i] {
+			t.Errorf("entry #%v: got %+v, expected %+v", i, e, exp[i])
+		}
+	}
+
+	b := BuildRIFF(NewID("TEST"), ChunkSpec{ID: "abcd", Data: []byte{1}})
+	r := bytes.NewReader(append(append([]byte("skip"), b...), "next"...))
+	r.Seek(4, io.SeekStart)
+	ix, err = ReadIndex(r)
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+	if len(ix.Entries) != 2 || ix.Entries[1].Offset != 12 {
+		t.Errorf("got %+v", ix.Entries)
+	}
+	if rest, _ := ioutil.ReadAll(r); string(rest) != "next" {
+		t.Errorf("reader left before %q, expected \"next\"", rest)
+	}
+
+	for name, b := range map[string][]byte{
+		"truncated": b[:len(b)-2],
+		"overrun":   withRIFFLen(b, 12),
+		"not RIFF":  append([]byte("LIST"), b[4:]...),
+	} {
+		if _, err := ReadIndex(bytes.NewReader(b)); err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package riff
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+)
+
+// MergeInfo copies the tags of the INFO list of src into the INFO list of
+// dst, replacing the tags dst already has with the same ID, and updates the
+// lengths of the lists and of dst. Both dst and src can be either an INFO
+// list or a container holding one, usually a RIFF chunk. If dst has no INFO
+// list one is appended to it.
+func MergeInfo(dst, src *Chunk) error {
+	if !dst.IsContainer() {
+		return fmt.Errorf("can't merge INFO into %q, it isn't a container", dst.ID)
+	}
+	s := infoList(src)
+	if s == nil {
+		return nil
+	}
+	d := infoList(dst)
+	if d == nil {
+		d = &Chunk{ID: list, ListID: info}
+		dst.Chunks = append(dst.Chunks, d)
+	}
+
+	for _, tag := range s.Chunks {
+		t := &Chunk{ID: tag.ID, Data: append([]byte(nil), tag.Data...)}
+		t.Len = uint32(len(t.Data))
+		replaced := false
+		for i, old := range d.Chunks {
+			if old.ID == tag.ID {
+				d.Chunks[i], replaced = t, true
+				break
+			}
+		}
+		if !replaced {
+			d.Chunks = append(d.Chunks, t)
+		}
+	}
+	d.updateLen()
+	if d != dst {
+		dst.updateLen()
+	}
+	return nil
+}
+
+// infoList returns c if it is an INFO list, or else the INFO list held by c,
+// if any.
+func infoList(c *Chunk) *Chunk {
+	if c.ID == list && c.ListID == info {
+		return c
+	}
+	for _, sc := range c.Chunks {
+		if sc.ID == list && sc.ListID == info {
+			return sc
+		}
+	}
+	return nil
+}
+
+// ToMap returns the form type of the container c and the data of its leaf
+// subchunks by ID, for editing lists of tags such as INFO as a map. Later
+// subchunks override earlier ones with the same ID, and containers are
+// left out. Data is read from the sections of lazily decoded leaves, and
+// a leaf whose data isn't loaded is an error.
+func (c *Chunk) ToMap() (ID, map[ID][]byte, error) {
+	m := make(map[ID][]byte)
+	for _, sc := range c.Chunks {
+		if sc.IsContainer() {
+			continue
+		}
+		data, err := sc.loadedData()
+		if err != nil {
+			return c.ListID, nil, err
+		}
+		m[sc.ID] = data
+	}
+	return c.ListID, m, nil
+}
+
+// InfoMap returns the tags of the INFO list c, such as "ISFT" or "INAM", by
+// ID, as strings ending at their first NUL byte, if any. Later tags
+// override earlier ones with the same ID. Calling it on a chunk that isn't
+// a LIST of form type INFO is an error.
+func (c *Chunk) InfoMap() (map[string]string, error) {
+	if c.ID != list || c.ListID != info {
+		return nil, fmt.Errorf("%q chunk of form type %q is not an INFO list", c.ID, c.ListID)
+	}
+	m := make(map[string]string, len(c.Chunks))
+	for _, sc := range c.Chunks {
+		if sc.IsContainer() {
+			continue
+		}
+		r, err := sc.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read %q: %v", sc.ID, err)
+		}
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		m[sc.ID.String()] = string(b)
+	}
+	return m, nil
+}
+
+// ListFromMap returns a LIST chunk of the given form type holding a leaf for
+// every entry of m, with their lengths computed. Since maps aren't ordered,
+// the leaves are sorted by ID so the result is always the same.
+func ListFromMap(formType ID, m map[ID][]byte) *Chunk {
+	c := &Chunk{ID: list, ListID: formType}
+	for id, data := range m {
+		c.Chunks = append(c.Chunks, &Chunk{ID: id, Len: uint32(len(data)), Data: data})
+	}
+	c.SortChildren(func(a, b *Chunk) bool { return a.ID.Compare(b.ID) < 0 })
+	c.updateLen()
+	return c
+}
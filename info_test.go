@@ -0,0 +1,111 @@
+package riff
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMergeInfo(t *testing.T) {
+	dst := decodeFile(t, "data/odd.wav")
+	src := decodeFile(t, "data/hand.wav")
+	name := &Chunk{ID: NewID("INAM"), Len: 5, Data: []byte("hand\x00")}
+	srcInfo := src.FindChunk(NewID("INFO"))
+	srcInfo.Chunks = append(srcInfo.Chunks, name)
+
+	if err := MergeInfo(dst, src); err != nil {
+		t.Fatalf("MergeInfo: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := dst.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	w, err := OpenWAV(buf)
+	if err != nil {
+		t.Fatalf("OpenWAV: %v", err)
+	}
+	exp := map[ID]string{
+		NewID("INAM"): "hand",
+		NewID("ISFT"): "File created by GoldWave.  GoldWave copyright (C) Chris Craig",
+	}
+	if len(w.Info) != len(exp) {
+		t.Errorf("got info %q, expected %q", w.Info, exp)
+	}
+	for id, v := range exp {
+		if w.Info[id] != v {
+			t.Errorf("%q: got %q, expected %q", id, w.Info[id], v)
+		}
+	}
+
+	// Without an INFO list in dst one is created.
+	dst = &Chunk{ID: NewID("RIFF"), Len: 4, ListID: NewID("WAVE")}
+	if err := MergeInfo(dst, src); err != nil {
+		t.Fatalf("MergeInfo: %v", err)
+	}
+	if exp := uint32(4 + 12 + 8 + 62 + 8 + 5 + 1); dst.Len != exp {
+		t.Errorf("length of new RIFF is %v, expected %v", dst.Len, exp)
+	}
+	name.Data[0] = 'H'
+	if got := dst.FindChunk(NewID("INFO"), NewID("INAM")).Data; !bytes.Equal(got, []byte("hand\x00")) {
+		t.Errorf("merged tag shares data with the source: %q", got)
+	}
+}
+
+func TestToMap(t *testing.T) {
+	c := decodeFile(t, "data/odd.wav")
+	form, m, err := c.FindChunk(NewID("INFO")).ToMap()
+	if err != nil {
+		t.Fatalf("ToMap: %v", err)
+	}
+	if form != NewID("INFO") {
+		t.Errorf("got form type %q", form)
+	}
+	exp := map[ID][]byte{NewID("INAM"): []byte("Odd song\x00"), NewID("ISFT"): []byte("riff\x00")}
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("got %q, expected %q", m, exp)
+	}
+
+	m[NewID("ICMT")] = []byte("comment")
+	delete(m, NewID("ISFT"))
+	l := ListFromMap(form, m)
+	want := listBytes("LIST", "INFO",
+		leafBytes("ICMT", []byte("comment")),
+		leafBytes("INAM", []byte("Odd song\x00")),
+	)
+	buf := new(bytes.Buffer)
+	if _, err := l.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), want)
+	}
+
+	l.Chunks[0].Data = nil
+	if _, _, err := l.ToMap(); err == nil {
+		t.Errorf("expected error for a leaf without data")
+	}
+}
+
+func TestInfoMap(t *testing.T) {
+	c := decodeFile(t, "data/odd.wav")
+	m, err := c.FindChunk(NewID("INFO")).InfoMap()
+	if err != nil {
+		t.Fatalf("InfoMap: %v", err)
+	}
+	if exp := map[string]string{"INAM": "Odd song", "ISFT": "riff"}; !reflect.DeepEqual(m, exp) {
+		t.Errorf("got %q, expected %q", m, exp)
+	}
+
+	l := &Chunk{ID: list, ListID: info, Chunks: []*Chunk{
+		{ID: NewID("ICMT"), Data: []byte("no NUL")},
+		{ID: NewID("IART"), Data: []byte("first\x00garbage")},
+		{ID: NewID("IART"), Data: []byte("second\x00")},
+	}}
+	if m, err := l.InfoMap(); err != nil || !reflect.DeepEqual(m, map[string]string{"ICMT": "no NUL", "IART": "second"}) {
+		t.Errorf("got %q, %v", m, err)
+	}
+	if _, err := c.InfoMap(); err == nil {
+		t.Errorf("expected error for a RIFF chunk")
+	}
+}
@@ -0,0 +1,411 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// IDSet returns every chunk ID found in the tree rooted at c, c included,
+// mapped to its number of occurrences.
+func (c *Chunk) IDSet() map[ID]int {
+	ids := make(map[ID]int)
+	c.walk(func(c *Chunk) { ids[c.ID]++ })
+	return ids
+}
+
+// FormSet returns the form types of every container in the tree rooted at
+// c, c included, mapped to their number of occurrences.
+func (c *Chunk) FormSet() map[ID]int {
+	forms := make(map[ID]int)
+	c.walk(func(c *Chunk) {
+		if c.IsContainer() {
+			forms[c.ListID]++
+		}
+	})
+	return forms
+}
+
+// SizeByID returns the number of bytes taken by the chunks of the tree
+// rooted at c, c included, summed per ID. A leaf accounts for its header,
+// data and pad byte, but a container only for its 12 byte header and form
+// type, its subchunks being accounted under their own IDs, so that the
+// values add up to the size of the tree as written by WriteTo.
+func (c *Chunk) SizeByID() map[ID]int64 {
+	sizes := make(map[ID]int64)
+	c.walk(func(c *Chunk) {
+		if c.IsContainer() {
+			sizes[c.ID] += 12
+		} else {
+			sizes[c.ID] += 8 + int64(c.Len) + int64(c.Len%2)
+		}
+	})
+	return sizes
+}
+
+// StructureHash returns a fingerprint of the layout of the tree rooted at
+// c: the IDs of its chunks, the form types of its containers and how they
+// nest, but neither their data nor their lengths. Files written by the same
+// tool usually share it whatever their contents. It is the 64 bit FNV-1a
+// hash of the tree serialized in depth-first order, every leaf as its ID
+// and every container as its ID, its form type, its number of subchunks as
+// a little endian uint32, and then its subchunks.
+func (c *Chunk) StructureHash() uint64 {
+	h := fnv.New64a()
+	var n [4]byte
+	c.walk(func(c *Chunk) {
+		h.Write(c.ID[:])
+		if c.IsContainer() {
+			h.Write(c.ListID[:])
+			binary.LittleEndian.PutUint32(n[:], uint32(len(c.Chunks)))
+			h.Write(n[:])
+		}
+	})
+	return h.Sum64()
+}
+
+// EqualContent reports whether the trees rooted at a and b hold the same
+// chunks, in the same order, with the same IDs, form types and data, so that
+// they are written identically by WriteTo once their lengths are updated.
+// Unlike Chunk.Equal, it doesn't compare lengths. Offsets and Content are
+// not compared either, and distinct trees where a chunk contains itself are
+// never equal.
+func EqualContent(a, b *Chunk) bool {
+	return EqualIgnoring(a, b)
+}
+
+// Equal reports whether the trees rooted at c and other are identical: they
+// hold the same chunks, in the same order, with the same IDs, lengths, form
+// types and data. Unlike EqualContent, it compares lengths, so that a
+// tree whose lengths weren't updated after an edit doesn't equal its
+// updated copy. Offsets and Content are not compared. Distinct trees where
+// a chunk contains itself are never equal.
+func (c *Chunk) Equal(other *Chunk) bool {
+	if c == other {
+		return true
+	}
+	if _, err := c.MaxDepth(); err != nil {
+		return false
+	}
+	if _, err := other.MaxDepth(); err != nil {
+		return false
+	}
+	return c.equal(other)
+}
+
+func (c *Chunk) equal(other *Chunk) bool {
+	if c == other {
+		return true
+	}
+	if c.ID != other.ID || c.Len != other.Len || c.ListID != other.ListID || len(c.Chunks) != len(other.Chunks) {
+		return false
+	}
+	if !c.IsContainer() && !sameData(c, other) {
+		return false
+	}
+	for i, sc := range c.Chunks {
+		if !sc.equal(other.Chunks[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualIgnoring is like EqualContent, but skips the subchunks whose ID, or
+// form type for containers, is one of ignore, as when comparing files whose
+// audio must match but whose metadata, such as their "ISFT" or "bext"
+// chunks, legitimately differ.
+func EqualIgnoring(a, b *Chunk, ignore ...ID) bool {
+	if a == b {
+		return true
+	}
+	if _, err := a.MaxDepth(); err != nil {
+		return false
+	}
+	if _, err := b.MaxDepth(); err != nil {
+		return false
+	}
+	skip := make(map[ID]bool, len(ignore))
+	for _, id := range ignore {
+		skip[id] = true
+	}
+	return equal(a, b, skip)
+}
+
+func equal(a, b *Chunk, skip map[ID]bool) bool {
+	if a == b {
+		return true
+	}
+	if a.ID != b.ID || a.IsContainer() && a.ListID != b.ListID {
+		return false
+	}
+	if !a.IsContainer() {
+		return sameData(a, b)
+	}
+	keep := func(cs []*Chunk) []*Chunk {
+		var out []*Chunk
+		for _, c := range cs {
+			if !skip[c.ID] && !(c.IsContainer() && skip[c.ListID]) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	ac, bc := keep(a.Chunks), keep(b.Chunks)
+	if len(ac) != len(bc) {
+		return false
+	}
+	for i := range ac {
+		if !equal(ac[i], bc[i], skip) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameData reports whether the leaves a and b hold the same data, reading
+// it from their sections if they have one. Sections of the same bytes of
+// the same ReaderAt are the same without being read.
+func sameData(a, b *Chunk) bool {
+	if a.section == nil && b.section == nil {
+		return bytes.Equal(a.Data, b.Data)
+	}
+	if a.dataLen() != b.dataLen() {
+		return false
+	}
+	if a.section != nil && b.section != nil {
+		ar, aoff, _ := a.section.Outer()
+		br, boff, _ := b.section.Outer()
+		if reflect.TypeOf(ar) == reflect.TypeOf(br) && reflect.TypeOf(ar).Comparable() && ar == br && aoff == boff {
+			return true
+		}
+	}
+	ad, bd := make([]byte, a.dataLen()), make([]byte, b.dataLen())
+	if _, err := a.ReadDataInto(ad); err != nil {
+		return false
+	}
+	if _, err := b.ReadDataInto(bd); err != nil {
+		return false
+	}
+	return bytes.Equal(ad, bd)
+}
+
+// Walk calls f for every chunk in the tree rooted at c, c included, in
+// depth-first pre-order, as FindAll visits them, and stops at the first
+// error f returns, which Walk then returns. As MaxDepth, it doesn't descend
+// again into a container found among its own descendants.
+func (c *Chunk) Walk(f func(*Chunk) error) error {
+	return c.walkErr(f, map[*Chunk]bool{})
+}
+
+func (c *Chunk) walkErr(f func(*Chunk) error, path map[*Chunk]bool) error {
+	if err := f(c); err != nil || path[c] {
+		return err
+	}
+	path[c] = true
+	defer delete(path, c)
+	for _, sc := range c.Chunks {
+		if err := sc.walkErr(f, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls f for every chunk in the tree rooted at c, in depth-first
+// order. A subchunk that is also one of its own ancestors is visited once
+// but not descended into again, so that cyclic trees don't loop forever.
+func (c *Chunk) walk(f func(*Chunk)) {
+	c.walkPath(f, map[*Chunk]bool{})
+}
+
+func (c *Chunk) walkPath(f func(*Chunk), path map[*Chunk]bool) {
+	f(c)
+	if path[c] {
+		return
+	}
+	path[c] = true
+	for _, sc := range c.Chunks {
+		sc.walkPath(f, path)
+	}
+	delete(path, c)
+}
+
+// MaxDepth returns the number of containers around the deepest chunk of the
+// tree rooted at c, 0 for a leaf. Since Chunks holds pointers, a tree built
+// in memory may hold a container among its own descendants; MaxDepth then
+// returns an error naming it instead of recursing forever. The same chunk
+// may appear several times in a tree, as long as it's not its own ancestor.
+func (c *Chunk) MaxDepth() (int, error) {
+	return c.maxDepth(map[*Chunk]bool{})
+}
+
+func (c *Chunk) maxDepth(path map[*Chunk]bool) (int, error) {
+	if path[c] {
+		return 0, fmt.Errorf("chunk %q contains itself", c.name())
+	}
+	if len(c.Chunks) == 0 {
+		return 0, nil
+	}
+	path[c] = true
+	defer delete(path, c)
+	max := 0
+	for _, sc := range c.Chunks {
+		d, err := sc.maxDepth(path)
+		if err != nil {
+			return 0, err
+		}
+		if d+1 > max {
+			max = d + 1
+		}
+	}
+	return max, nil
+}
+
+// Stats returns, in a single traversal of the tree rooted at c, its number
+// of chunks, c included, its depth as returned by MaxDepth, and the sum of
+// the lengths of its leaves, which doesn't need their Data to be read. Like
+// walk, chunks that are their own ancestors are counted but not descended
+// into again.
+func (c *Chunk) Stats() (count int, maxDepth int, totalDataBytes int64) {
+	c.stats(map[*Chunk]bool{}, 0, &count, &maxDepth, &totalDataBytes)
+	return count, maxDepth, totalDataBytes
+}
+
+func (c *Chunk) stats(path map[*Chunk]bool, depth int, count, maxDepth *int, total *int64) {
+	*count++
+	if depth > *maxDepth {
+		*maxDepth = depth
+	}
+	if !c.IsContainer() {
+		*total += int64(c.Len)
+	}
+	if path[c] {
+		return
+	}
+	path[c] = true
+	for _, sc := range c.Chunks {
+		sc.stats(path, depth+1, count, maxDepth, total)
+	}
+	delete(path, c)
+}
+
+// name returns the form type of c if it's a container, its ID otherwise.
+func (c *Chunk) name() ID {
+	if c.IsContainer() {
+		return c.ListID
+	}
+	return c.ID
+}
+
+// Dump writes a description of the tree rooted at c to w, one chunk per
+// line indented by depth, with the length of every chunk in bytes followed
+// by the same length in human readable units. A last line gives the total
+// size of the tree as written by WriteTo. If raw is true only lengths in
+// bytes are written and the total is omitted, which is easier to parse. A
+// chunk containing itself is an error, and nothing is written.
+func (c *Chunk) Dump(w io.Writer, raw bool) error {
+	if _, err := c.MaxDepth(); err != nil {
+		return err
+	}
+	wr := &writer{w: w}
+	c.dump(wr, "", raw)
+	if !raw {
+		var total int64
+		c.walk(func(c *Chunk) {
+			if c.IsContainer() {
+				total += 12
+			} else {
+				total += 8 + c.dataLen() + int64(c.Len%2)
+			}
+		})
+		fmt.Fprintf(wr, "total %v (%v)\n", total, humanSize(total))
+	}
+	return wr.err
+}
+
+func (c *Chunk) dump(w io.Writer, indent string, raw bool) {
+	fmt.Fprintf(w, "%v%q", indent, c.ID)
+	if c.IsContainer() {
+		fmt.Fprintf(w, " %q", c.ListID)
+	}
+	fmt.Fprintf(w, " %v", c.Len)
+	if !raw {
+		fmt.Fprintf(w, " (%v)", humanSize(int64(c.Len)))
+	}
+	fmt.Fprintln(w)
+	for _, sc := range c.Chunks {
+		sc.dump(w, indent+"  ", raw)
+	}
+}
+
+// humanSize formats n bytes using the largest binary unit that keeps the
+// value at least 1.
+func humanSize(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%v B", n)
+	}
+	v, i := float64(n)/1024, 0
+	for ; v >= 1024 && i < len(units)-1; i++ {
+		v /= 1024
+	}
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
+
+// GoSource returns the tree rooted at c as a Go expression building it, in
+// the style of the expected values of this package's tests, to turn a
+// decoded file into a test fixture. Only IDs, lengths, form types and
+// subchunks are written; see GoSourceWithData to include the data of leaves.
+// A chunk found again among its own subchunks is written as nil, with a
+// comment, since a literal can't build it.
+func (c *Chunk) GoSource() string {
+	var b strings.Builder
+	b.WriteString("&Chunk")
+	c.goSource(&b, "", false, map[*Chunk]bool{})
+	return b.String()
+}
+
+// GoSourceWithData is like GoSource, but also writes the Data of leaves, as
+// byte slices in hexadecimal.
+func (c *Chunk) GoSourceWithData() string {
+	var b strings.Builder
+	b.WriteString("&Chunk")
+	c.goSource(&b, "", true, map[*Chunk]bool{})
+	return b.String()
+}
+
+func (c *Chunk) goSource(b *strings.Builder, indent string, data bool, path map[*Chunk]bool) {
+	fmt.Fprintf(b, "{ID: NewID(%q), Len: %v", c.ID[:], c.Len)
+	if !c.IsContainer() {
+		if data && c.Data != nil {
+			b.WriteString(", Data: []byte{")
+			for i, v := range c.Data {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(b, "0x%02x", v)
+			}
+			b.WriteString("}")
+		}
+		b.WriteString("}")
+		return
+	}
+	fmt.Fprintf(b, ",\n%v\tListID: NewID(%q),\n%v\tChunks: []*Chunk{\n", indent, c.ListID[:], indent)
+	path[c] = true
+	defer delete(path, c)
+	for _, sc := range c.Chunks {
+		b.WriteString(indent + "\t\t")
+		if path[sc] {
+			fmt.Fprintf(b, "nil /* %q %q, which contains itself */,\n", sc.ID[:], sc.ListID[:])
+			continue
+		}
+		sc.goSource(b, indent+"\t\t", data, path)
+		b.WriteString(",\n")
+	}
+	fmt.Fprintf(b, "%v\t},\n%v}", indent, indent)
+}
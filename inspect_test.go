@@ -0,0 +1,338 @@
+package riff
+
+import (
+	"bytes"
+	"errors"
+	"go/format"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIDSet(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	exp := map[ID]int{
+		NewID("RIFF"): 1,
+		NewID("fmt "): 1,
+		NewID("fact"): 1,
+		NewID("data"): 1,
+		NewID("LIST"): 1,
+		NewID("ISFT"): 1,
+	}
+	if got := c.IDSet(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("IDSet: got %v, expected %v", got, exp)
+	}
+	exp = map[ID]int{NewID("WAVE"): 1, NewID("INFO"): 1}
+	if got := c.FormSet(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("FormSet: got %v, expected %v", got, exp)
+	}
+
+	c.Chunks = append(c.Chunks, c.Chunks[3])
+	if got := c.IDSet(); got[NewID("LIST")] != 2 || got[NewID("ISFT")] != 2 {
+		t.Errorf("IDSet after duplicating LIST: got %v", got)
+	}
+}
+
+func TestDump(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	tests := []struct {
+		raw bool
+		exp string
+	}{
+		{false, `"RIFF" "WAVE" 7944 (7.8 KiB)
+  "fmt " 30 (30 B)
+  "fact" 4 (4 B)
+  "data" 7800 (7.6 KiB)
+  "LIST" "INFO" 74 (74 B)
+    "ISFT" 62 (62 B)
+total 7952 (7.8 KiB)
+`},
+		{true, `"RIFF" "WAVE" 7944
+  "fmt " 30
+  "fact" 4
+  "data" 7800
+  "LIST" "INFO" 74
+    "ISFT" 62
+`},
+	}
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		if err := c.Dump(buf, test.raw); err != nil {
+			t.Fatalf("Dump: %v", err)
+		}
+		if got := buf.String(); got != test.exp {
+			t.Errorf("raw %v: got\n%v\nexpected\n%v", test.raw, got, test.exp)
+		}
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := map[int64]string{
+		0:         "0 B",
+		1023:      "1023 B",
+		1024:      "1.0 KiB",
+		1536:      "1.5 KiB",
+		5 << 20:   "5.0 MiB",
+		3 << 30:   "3.0 GiB",
+		1<<40 + 1: "1.0 TiB",
+	}
+	for n, exp := range tests {
+		if got := humanSize(n); got != exp {
+			t.Errorf("humanSize(%v) = %q, expected %q", n, got, exp)
+		}
+	}
+}
+
+func TestStructureHash(t *testing.T) {
+	wav := func(data []byte, children ...[]byte) *Chunk {
+		b := listBytes("RIFF", "WAVE", append([][]byte{
+			leafBytes("fmt ", make([]byte, 16)),
+			leafBytes("data", data),
+		}, children...)...)
+		c, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return c
+	}
+	info := listBytes("LIST", "INFO", leafBytes("ISFT", []byte("riff")))
+	base := wav([]byte{1, 2}, info).StructureHash()
+
+	if got := wav(make([]byte, 1001), info).StructureHash(); got != base {
+		t.Errorf("different data changed the hash from %x to %x", base, got)
+	}
+	for name, c := range map[string]*Chunk{
+		"no INFO":     wav([]byte{1, 2}),
+		"other form":  wav([]byte{1, 2}, listBytes("LIST", "adtl", leafBytes("ISFT", []byte("riff")))),
+		"flattened":   wav([]byte{1, 2}, listBytes("LIST", "INFO"), leafBytes("ISFT", []byte("riff"))),
+		"other leaf":  wav([]byte{1, 2}, listBytes("LIST", "INFO", leafBytes("INAM", []byte("riff")))),
+		"more leaves": wav([]byte{1, 2}, listBytes("LIST", "INFO", leafBytes("ISFT", nil), leafBytes("ISFT", nil))),
+	} {
+		if got := c.StructureHash(); got == base {
+			t.Errorf("%v: got the same hash %x", name, got)
+		}
+	}
+	if got, exp := decodeFile(t, "data/hand.wav").StructureHash(), decodeFile(t, "data/hand.wav").StructureHash(); got != exp {
+		t.Errorf("hash isn't deterministic: %x and %x", got, exp)
+	}
+}
+
+func TestSizeByID(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	exp := map[ID]int64{
+		NewID("RIFF"): 12,
+		NewID("fmt "): 38,
+		NewID("fact"): 12,
+		NewID("data"): 7808,
+		NewID("LIST"): 12,
+		NewID("ISFT"): 70,
+	}
+	got := c.SizeByID()
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+	var total int64
+	for _, n := range got {
+		total += n
+	}
+	if total != 7952 {
+		t.Errorf("sizes add up to %v, expected the file size 7952", total)
+	}
+}
+
+func TestStats(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	count, depth, total := c.Stats()
+	if count != 6 || depth != 2 || total != 30+4+7800+62 {
+		t.Errorf("got %v chunks, depth %v and %v data bytes; expected 6, 2 and %v", count, depth, total, 30+4+7800+62)
+	}
+	if d, _ := c.MaxDepth(); d != depth {
+		t.Errorf("got depth %v, MaxDepth returns %v", depth, d)
+	}
+
+	inner := &Chunk{ID: list, ListID: NewID("INNR")}
+	root := &Chunk{ID: riff, ListID: NewID("TEST"), Chunks: []*Chunk{inner}}
+	inner.Chunks = []*Chunk{{ID: NewID("data"), Len: 3}, root}
+	if count, depth, total := root.Stats(); count != 4 || depth != 2 || total != 3 {
+		t.Errorf("cyclic tree: got %v chunks, depth %v and %v data bytes; expected 4, 2 and 3", count, depth, total)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	shared := &Chunk{ID: NewID("data"), Len: 2, Data: []byte("ab")}
+	inner := &Chunk{ID: list, ListID: NewID("INNR"), Chunks: []*Chunk{shared}}
+	root := &Chunk{ID: riff, ListID: NewID("TEST"), Chunks: []*Chunk{shared, inner}}
+	if err := root.UpdateLengths(); err != nil {
+		t.Fatalf("shared chunk: %v", err)
+	}
+	if d, err := root.MaxDepth(); err != nil || d != 2 {
+		t.Fatalf("got depth %v, %v; expected 2", d, err)
+	}
+
+	inner.Chunks = append(inner.Chunks, root)
+	if _, err := root.MaxDepth(); err == nil {
+		t.Errorf("expected cycle error from MaxDepth")
+	}
+	if err := root.UpdateLengths(); err == nil {
+		t.Errorf("expected cycle error from UpdateLengths")
+	}
+	var buf bytes.Buffer
+	if n, err := root.WriteTo(&buf); err == nil || n != 0 {
+		t.Errorf("got %v bytes written, %v; expected cycle error", n, err)
+	}
+	if got := root.IDSet()[riff]; got != 2 {
+		t.Errorf("cyclic tree IDSet got %v RIFF, expected 2", got)
+	}
+}
+
+func TestGoSource(t *testing.T) {
+	exp := `&Chunk{ID: NewID("RIFF"), Len: 7944,
+	ListID: NewID("WAVE"),
+	Chunks: []*Chunk{
+		{ID: NewID("fmt "), Len: 30},
+		{ID: NewID("fact"), Len: 4},
+		{ID: NewID("data"), Len: 7800},
+		{ID: NewID("LIST"), Len: 74,
+			ListID: NewID("INFO"),
+			Chunks: []*Chunk{
+				{ID: NewID("ISFT"), Len: 62},
+			},
+		},
+	},
+}`
+	if got := decodeFile(t, "data/hand.wav").GoSource(); got != exp {
+		t.Errorf("got\n%v\nexpected\n%v", got, exp)
+	}
+
+	c := &Chunk{ID: riff, Len: 14, ListID: NewID("TEST"), Chunks: []*Chunk{
+		{ID: NewID("a\x00\"b"), Len: 2, Data: []byte{0, 0xff}},
+	}}
+	exp = `&Chunk{ID: NewID("RIFF"), Len: 14,
+	ListID: NewID("TEST"),
+	Chunks: []*Chunk{
+		{ID: NewID("a\x00\"b"), Len: 2, Data: []byte{0x00, 0xff}},
+	},
+}`
+	got := c.GoSourceWithData()
+	if got != exp {
+		t.Errorf("got\n%v\nexpected\n%v", got, exp)
+	}
+	src, err := format.Source([]byte("package riff\n\nvar fixture = " + got + "\n"))
+	if err != nil {
+		t.Fatalf("not valid Go: %v", err)
+	}
+	if !strings.Contains(string(src), got) {
+		t.Errorf("not formatted as gofmt does:\n%s", src)
+	}
+}
+
+func TestEqualIgnoring(t *testing.T) {
+	build := func(software string, samples []byte) *Chunk {
+		c, err := NewDecoder(bytes.NewReader(BuildRIFF(NewID("WAVE"),
+			ChunkSpec{ID: "fmt ", Data: make([]byte, 16)},
+			ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "ISFT", Data: []byte(software)}}},
+			ChunkSpec{ID: "data", Data: samples},
+		))).Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return c
+	}
+	a := build("riff", []byte("samples"))
+	if !EqualContent(a, build("riff", []byte("samples"))) {
+		t.Errorf("identical trees are not EqualContent")
+	}
+	b := build("other tool", []byte("samples"))
+	if EqualContent(a, b) {
+		t.Errorf("trees with different ISFT chunks are EqualContent")
+	}
+	if !EqualIgnoring(a, b, NewID("ISFT")) || !EqualIgnoring(a, b, NewID("INFO")) {
+		t.Errorf("trees differing only by ISFT are not equal ignoring it")
+	}
+	c := build("other tool", []byte("SAMPLES"))
+	if EqualIgnoring(a, c, NewID("ISFT")) {
+		t.Errorf("trees with different data are equal ignoring ISFT")
+	}
+
+	section := build("riff", nil)
+	section.Chunks[2] = SectionChunk(NewID("data"), strings.NewReader("xsamples"), 1, 7)
+	if !EqualContent(a, section) || EqualContent(c, section) {
+		t.Errorf("data read from a section not compared")
+	}
+
+	cyclic := build("riff", []byte("samples"))
+	cyclic.Chunks[1].Chunks = append(cyclic.Chunks[1].Chunks, cyclic.Chunks[1])
+	other := build("riff", []byte("samples"))
+	other.Chunks[1].Chunks = append(other.Chunks[1].Chunks, other.Chunks[1])
+	if EqualContent(cyclic, other) || !EqualContent(cyclic, cyclic) {
+		t.Errorf("distinct cyclic trees are EqualContent, or a tree doesn't equal itself")
+	}
+}
+
+func TestChunkEqual(t *testing.T) {
+	a := decodeFile(t, "data/hand.wav")
+	b := decodeFile(t, "data/hand.wav")
+	if !a.Equal(b) {
+		t.Errorf("identical trees are not Equal")
+	}
+	if err := b.FindChunk(NewID("data")).Truncate(100); err != nil {
+		t.Fatalf("Truncate: %v", err)
+	}
+	if a.Equal(b) {
+		t.Errorf("trees with different data are Equal")
+	}
+	b = decodeFile(t, "data/hand.wav")
+	b.Len++
+	if a.Equal(b) || !EqualContent(a, b) {
+		t.Errorf("lengths compared by EqualContent, or not by Chunk.Equal")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	var ids []string
+	if err := c.Walk(func(c *Chunk) error {
+		ids = append(ids, c.ID.String())
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if exp := []string{"RIFF", "fmt ", "fact", "data", "LIST", "ISFT"}; !reflect.DeepEqual(ids, exp) {
+		t.Errorf("visited %q, expected %q", ids, exp)
+	}
+
+	stop := errors.New("stop")
+	ids = nil
+	err := c.Walk(func(c *Chunk) error {
+		ids = append(ids, c.ID.String())
+		if c.ID == NewID("fact") {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(ids) != 3 {
+		t.Errorf("got %v after visiting %q, expected to stop at fact", err, ids)
+	}
+
+	cyclic := &Chunk{ID: list, ListID: info}
+	cyclic.Chunks = []*Chunk{cyclic}
+	n := 0
+	cyclic.Walk(func(*Chunk) error { n++; return nil })
+	if n != 2 {
+		t.Errorf("visited %v chunks of a cyclic tree, expected 2", n)
+	}
+}
+
+func TestInspectCyclic(t *testing.T) {
+	c := cyclicTree()
+	if c.Equal(cyclicTree()) || !c.Equal(c) {
+		t.Errorf("cyclic trees compared as equal, or a tree not equal to itself")
+	}
+	buf := new(bytes.Buffer)
+	if err := c.Dump(buf, false); err == nil || buf.Len() > 0 {
+		t.Errorf("Dump of a cyclic tree wrote %q, %v", buf, err)
+	}
+	if s := c.GoSourceWithData(); !strings.Contains(s, `nil /* "LIST" "INFO", which contains itself */`) {
+		t.Errorf("cyclic tree written as %v", s)
+	}
+}
@@ -0,0 +1,55 @@
+package riff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DefaultMagicLimit is the number of bytes SeekToMagic scans when no limit
+// is given.
+const DefaultMagicLimit = 1 << 20
+
+// ErrMagicNotFound is returned by SeekToMagic when no RIFF signature starts
+// within the scanned bytes.
+var ErrMagicNotFound = errors.New("riff: RIFF signature not found")
+
+// SeekToMagic discards bytes from r until it is positioned at the start of
+// a "RIFF" or "RIFX" signature, so that a Decoder reading from r can decode
+// files with leading garbage. It returns the number of bytes discarded.
+// At most limit bytes are discarded, or DefaultMagicLimit if limit is not
+// positive, so a signature may start at offset limit but not after it;
+// ErrMagicNotFound is returned, with those bytes discarded, if no signature
+// starts within them or before the end of the stream.
+func SeekToMagic(r *bufio.Reader, limit int64) (int64, error) {
+	if limit <= 0 {
+		limit = DefaultMagicLimit
+	}
+	var skipped int64
+	for {
+		b, err := r.Peek(r.Size())
+		if len(b) < 4 && err != io.EOF {
+			return skipped, err
+		}
+		for i := 0; i+4 <= len(b); i++ {
+			if skipped+int64(i) > limit {
+				// A signature may start at offset limit, not past it.
+				r.Discard(i - 1)
+				return limit, ErrMagicNotFound
+			}
+			if bytes.Equal(b[i:i+4], riff[:]) || bytes.Equal(b[i:i+4], rifx[:]) {
+				r.Discard(i)
+				return skipped + int64(i), nil
+			}
+		}
+		if err == io.EOF {
+			// The last bytes of the stream are too few to hold a signature.
+			n, _ := r.Discard(int(min(int64(len(b)), limit-skipped)))
+			return skipped + int64(n), ErrMagicNotFound
+		}
+		// Keep the last 3 bytes, they might start a signature.
+		n, _ := r.Discard(int(min(int64(len(b)-3), limit-skipped)))
+		skipped += int64(n)
+	}
+}
@@ -0,0 +1,66 @@
+package riff
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSeekToMagic(t *testing.T) {
+	wav, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+
+	tests := []struct {
+		garbage int
+		limit   int64
+		err     error
+	}{
+		{0, 0, nil},
+		{3, 0, nil},
+		{5000, 0, nil},
+		{5000, 5000, nil},
+		{5000, 4999, ErrMagicNotFound},
+		{DefaultMagicLimit + 1, 0, ErrMagicNotFound},
+	}
+	for _, test := range tests {
+		b := append(bytes.Repeat([]byte("RIF"), test.garbage/3+1)[:test.garbage], wav...)
+		r := bufio.NewReader(bytes.NewReader(b))
+		n, err := SeekToMagic(r, test.limit)
+		if err != test.err {
+			t.Errorf("%v bytes with limit %v: got error %v, expected %v", test.garbage, test.limit, err, test.err)
+			continue
+		}
+		if err != nil {
+			limit := test.limit
+			if limit <= 0 {
+				limit = DefaultMagicLimit
+			}
+			if n != limit {
+				t.Errorf("%v bytes with limit %v: discarded %v bytes before failing", test.garbage, test.limit, n)
+			}
+			continue
+		}
+		if n != int64(test.garbage) {
+			t.Errorf("%v bytes with limit %v: skipped %v bytes", test.garbage, test.limit, n)
+		}
+		if _, err := NewDecoder(r).Decode(); err != nil {
+			t.Errorf("%v bytes with limit %v: Decode: %v", test.garbage, test.limit, err)
+		}
+	}
+
+	// The bytes left at the end of a stream without a signature are
+	// discarded too, even those that might have started one.
+	for _, s := range []string{"no signature here", "ends with RIF", "RI"} {
+		r := bufio.NewReader(bytes.NewReader([]byte(s)))
+		if n, err := SeekToMagic(r, 0); err != ErrMagicNotFound || n != int64(len(s)) || r.Buffered() != 0 {
+			t.Errorf("stream %q: got %v, %v with %v bytes left, expected all bytes discarded and %v", s, n, err, r.Buffered(), ErrMagicNotFound)
+		}
+	}
+	r := bufio.NewReader(bytes.NewReader([]byte("no signature here")))
+	if n, err := SeekToMagic(r, 5); err != ErrMagicNotFound || n != 5 || r.Buffered() != len("no signature here")-5 {
+		t.Errorf("limit 5: got %v, %v with %v bytes left", n, err, r.Buffered())
+	}
+}
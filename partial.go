@@ -0,0 +1,153 @@
+package riff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// DecodePartial decodes the next chunk from input that is still arriving,
+// such as an upload in progress. Every call reads from the decoder's reader
+// until it returns io.EOF, appending what it reads to the bytes retained by
+// previous calls, so a reader returning io.EOF means "nothing more for now"
+// rather than the end of the stream.
+//
+// If the retained bytes hold a complete chunk, pad byte included, it is
+// decoded and returned with false, and its bytes are dropped. Otherwise
+// DecodePartial returns the tree received so far, holding the subchunks
+// read completely, and true to ask for more input. The bytes are retained
+// and decoded again by the next call, so DecoderFuncs, verifiers and
+// Progress may run several times for the same chunk, and every call returns
+// a new tree. The returned tree is nil if not even the header and form type
+// of the next chunk have been received. Errors other than io.EOF returned by
+// the reader, as well as malformed chunks, are returned as errors.
+//
+// No more input than the next chunk is retained: the rest is left in the
+// reader for the following calls. Leaves longer than MaxChunkSize are
+// errors as soon as their header is received, as they are for Decode.
+//
+// DecodePartial must not be mixed with the other decoding methods.
+func (d *Decoder) DecodePartial() (*Chunk, bool, error) {
+	if err := d.fillPending(); err != nil {
+		return nil, false, err
+	}
+	base := d.r
+	defer func() { d.r = base }()
+
+	b := d.pending.Bytes()
+	_, l, err := d.readHeader(bytes.NewReader(b))
+	if err != nil {
+		return nil, true, nil
+	}
+	if size := 8 + int64(l) + int64(l%2); int64(len(b)) >= size {
+		d.r = &reader{r: bytes.NewReader(b[:size]), n: d.pendingOff}
+		c, err := d.Decode()
+		if err != nil {
+			return nil, false, err
+		}
+		d.pending.Next(int(size))
+		d.pendingOff += size
+		return c, false, nil
+	}
+	c, err := d.decodePartial(b, 0, d.pendingOff)
+	if err != nil {
+		return nil, false, err
+	}
+	return c, true, nil
+}
+
+// fillPending reads from the decoder's reader into the retained bytes until
+// they hold the whole next chunk, pad byte included, or the reader returns
+// io.EOF.
+func (d *Decoder) fillPending() error {
+	for {
+		want := int64(8)
+		if b := d.pending.Bytes(); len(b) >= 8 {
+			c := &Chunk{Offset: d.pendingOff}
+			c.ID, c.Len, _ = d.readHeader(bytes.NewReader(b))
+			if !c.IsContainer() {
+				if err := d.checkSize(c); err != nil {
+					return &DecodeError{Offset: c.Offset, ID: c.ID, Err: err}
+				}
+			}
+			want = 8 + int64(c.Len) + int64(c.Len%2)
+		}
+		n := want - int64(d.pending.Len())
+		if n <= 0 {
+			return nil
+		}
+		m, err := d.pending.ReadFrom(io.LimitReader(d.r, n))
+		if err != nil {
+			return err
+		}
+		if m < n {
+			return nil // nothing more for now
+		}
+	}
+}
+
+// decodePartial decodes the incomplete chunk at the start of b, found at
+// offset off of the stream, keeping only its completely received
+// subchunks. It returns nil if the chunk is a leaf or if its header and form
+// type are incomplete.
+func (d *Decoder) decodePartial(b []byte, depth int, off int64) (*Chunk, error) {
+	if depth == 0 {
+		d.form = ID{}
+	}
+	c := &Chunk{Offset: off}
+	var err error
+	if c.ID, c.Len, err = d.readHeader(bytes.NewReader(b)); err != nil {
+		return nil, nil
+	}
+	if !c.IsContainer() {
+		return nil, d.checkSize(c)
+	}
+	if c.Len < 4 {
+		return nil, fmt.Errorf("container of length %v has no room for a form type", c.Len)
+	}
+	if err := d.checkDepth(depth); err != nil {
+		return nil, err
+	}
+	if len(b) < 12 {
+		return nil, nil
+	}
+	copy(c.ListID[:], b[8:12])
+	if depth == 0 {
+		if c.ID == riff && !d.knownForm(c.ListID) {
+			return nil, fmt.Errorf("unknown form type %q", c.ListID)
+		}
+		d.form = c.ListID
+	}
+
+	left := int64(c.Len) - 4
+	b, off = b[12:], off+12
+	if int64(len(b)) > left {
+		b = b[:left]
+	}
+	for len(b) >= 8 {
+		_, l, _ := d.readHeader(bytes.NewReader(b))
+		size := 8 + int64(l) + int64(l%2)
+		if size > left {
+			size = left
+		}
+		if int64(len(b)) < size {
+			sc, err := d.decodePartial(b, depth+1, off)
+			if err != nil {
+				return nil, fmt.Errorf("decode subchunk #%v: %w", len(c.Chunks), err)
+			}
+			if sc != nil {
+				c.Chunks = append(c.Chunks, sc)
+			}
+			break
+		}
+		d.r = &reader{r: bytes.NewReader(b[:size]), n: off}
+		d.parent = c.ListID
+		sc, err := d.decode(&io.LimitedReader{R: d.r, N: size}, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("decode subchunk #%v: %w", len(c.Chunks), err)
+		}
+		c.Chunks = append(c.Chunks, sc)
+		b, off, left = b[size:], off+size, left-size
+	}
+	return c, nil
+}
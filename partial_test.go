@@ -0,0 +1,118 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestDecodePartial(t *testing.T) {
+	first := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("name"))),
+		leafBytes("data", []byte("odd")),
+	)
+	second := listBytes("RIFF", "AVI ", leafBytes("avih", make([]byte, 4)))
+	all := append(append([]byte{}, first...), second...)
+
+	in := new(bytes.Buffer)
+	d := NewDecoder(in)
+	feed := func(n int) {
+		in.Write(all[:n])
+		all = all[n:]
+	}
+	check := func(step string, wantMore bool, wantChunks ...int) *Chunk {
+		t.Helper()
+		c, more, err := d.DecodePartial()
+		if err != nil {
+			t.Fatalf("%v: DecodePartial: %v", step, err)
+		}
+		if more != wantMore {
+			t.Fatalf("%v: got more %v, expected %v", step, more, wantMore)
+		}
+		if wantChunks == nil {
+			if c != nil {
+				t.Fatalf("%v: got %v, expected no chunk", step, c)
+			}
+			return nil
+		}
+		if c == nil {
+			t.Fatalf("%v: got no chunk", step)
+		}
+		for i, sc := 0, c; i < len(wantChunks); i++ {
+			if len(sc.Chunks) != wantChunks[i] {
+				t.Fatalf("%v: got %v subchunks at depth %v, expected %v", step, len(sc.Chunks), i, wantChunks[i])
+			}
+			if i+1 < len(wantChunks) {
+				sc = sc.Chunks[len(sc.Chunks)-1]
+			}
+		}
+		return c
+	}
+
+	check("nothing", true)
+	feed(10)
+	check("header", true)
+	feed(10)
+	check("form type", true, 0)
+	feed(16)
+	check("fmt", true, 1)
+	feed(12 + 8 + 2)
+	check("LIST started", true, 2, 0)
+	feed(2)
+	c := check("LIST complete", true, 2, 1)
+	if got := c.Chunks[1].Chunks[0]; got.Offset != 48 || string(got.Data) != "name" {
+		t.Errorf("INAM: got %v at offset %v", got, got.Offset)
+	}
+	feed(8 + 3)
+	check("pad missing", true, 2)
+	feed(1)
+	c = check("RIFF complete", false, 3)
+	exp, err := NewDecoder(bytes.NewReader(first)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got, exp := c.String(), exp.String(); got != exp {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+
+	check("second nothing", true)
+	feed(len(all))
+	c = check("second", false, 1)
+	if c.Offset != int64(len(first)) || c.ListID != NewID("AVI ") {
+		t.Errorf("second chunk: got %v at offset %v", c, c.Offset)
+	}
+	check("end", true)
+
+	bad := NewDecoder(bytes.NewReader(listBytes("RIFF", "WAVE", leafBytes("data", make([]byte, 40)))[:30]))
+	bad.KnownForms = []ID{NewID("AVI ")}
+	if _, _, err := bad.DecodePartial(); err == nil {
+		t.Errorf("expected error for an unknown form type")
+	}
+}
+
+func TestDecodePartialLimits(t *testing.T) {
+	// Only the next chunk is retained, the rest is left in the reader.
+	first := listBytes("RIFF", "WAVE", leafBytes("data", []byte("ab")))
+	in := bytes.NewBuffer(append(append([]byte{}, first...), listBytes("RIFF", "WAVE")...))
+	d := NewDecoder(in)
+	if c, more, err := d.DecodePartial(); err != nil || more || c == nil {
+		t.Fatalf("DecodePartial: %v, %v, %v", c, more, err)
+	}
+	if d.pending.Len() != 0 || in.Len() != 12 {
+		t.Errorf("%v bytes retained and %v left in the reader, expected 0 and 12", d.pending.Len(), in.Len())
+	}
+
+	for name, b := range map[string][]byte{
+		"leaf":     leafBytes("data", nil),
+		"subchunk": withRIFFLen(listBytes("RIFF", "WAVE", leafBytes("data", nil)), 0xfffffff8),
+	} {
+		binary.LittleEndian.PutUint32(b[len(b)-4:], 0xfffffff0)
+		d := NewDecoder(bytes.NewReader(b))
+		d.MaxChunkSize = 1 << 20
+		if _, _, err := d.DecodePartial(); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+			t.Errorf("%v: got error %v, expected the length to exceed MaxChunkSize", name, err)
+		}
+	}
+}
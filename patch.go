@@ -0,0 +1,170 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Operations of a patch, each describing one chunk of the target tree.
+const (
+	patchKeep  = 'k' // a base chunk, unchanged
+	patchEdit  = 'e' // a base container with the same IDs, with new subchunks
+	patchChunk = 'c' // a new chunk, as written by WriteTo
+)
+
+// Patch returns a compact description of target in terms of base, from
+// which Apply rebuilds target. Chunks of target found unchanged in base,
+// such as the samples of an audio file whose metadata was edited, are
+// referred to by position instead of being copied, so the patch is about
+// the size of the chunks added or modified.
+func Patch(base, target *Chunk) ([]byte, error) {
+	if _, err := base.MaxDepth(); err != nil {
+		return nil, fmt.Errorf("base: %v", err)
+	}
+	if _, err := target.MaxDepth(); err != nil {
+		return nil, fmt.Errorf("target: %v", err)
+	}
+	return appendPatch(nil, []*Chunk{base}, make([]bool, 1), target)
+}
+
+// appendPatch appends to p the operation describing target in terms of the
+// chunks of base not used yet, and marks the one it uses, if any.
+func appendPatch(p []byte, base []*Chunk, used []bool, target *Chunk) ([]byte, error) {
+	edit := -1
+	for i, c := range base {
+		if used[i] {
+			continue
+		}
+		if sameChunk(c, target) {
+			used[i] = true
+			p = append(p, patchKeep)
+			return binary.AppendUvarint(p, uint64(i)), nil
+		}
+		if edit < 0 && c.IsContainer() && c.ID == target.ID && c.ListID == target.ListID {
+			edit = i
+		}
+	}
+
+	if edit >= 0 {
+		used[edit] = true
+		p = append(p, patchEdit)
+		p = binary.AppendUvarint(p, uint64(edit))
+		p = binary.AppendUvarint(p, uint64(len(target.Chunks)))
+		children := base[edit].Chunks
+		usedChildren := make([]bool, len(children))
+		for _, sc := range target.Chunks {
+			var err error
+			if p, err = appendPatch(p, children, usedChildren, sc); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := target.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	p = append(p, patchChunk)
+	p = binary.AppendUvarint(p, uint64(buf.Len()))
+	return append(p, buf.Bytes()...), nil
+}
+
+// sameChunk reports whether a and b are written identically by WriteTo,
+// pad bytes aside. The data of leaves read from sections is compared as
+// sameData does.
+func sameChunk(a, b *Chunk) bool {
+	if a == b {
+		return true
+	}
+	if a.ID != b.ID || a.Len != b.Len || a.ListID != b.ListID || len(a.Chunks) != len(b.Chunks) {
+		return false
+	}
+	if !a.IsContainer() && !sameData(a, b) {
+		return false
+	}
+	for i := range a.Chunks {
+		if !sameChunk(a.Chunks[i], b.Chunks[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply rebuilds the tree described by patch, as returned by Patch, from
+// base. The result shares the chunks kept unchanged with base, so base
+// shouldn't be modified while it's in use. New chunks are decoded without
+// any DecoderFunc, so they have no Content.
+func Apply(base *Chunk, patch []byte) (*Chunk, error) {
+	r := bytes.NewReader(patch)
+	c, err := applyPatch(r, []*Chunk{base})
+	if err != nil {
+		return nil, fmt.Errorf("offset %v of patch: %v", len(patch)-r.Len(), err)
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%v bytes left after the end of the patch", r.Len())
+	}
+	return c, nil
+}
+
+// applyPatch reads from r an operation and returns the chunk it describes
+// in terms of base.
+func applyPatch(r *bytes.Reader, base []*Chunk) (*Chunk, error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch op {
+	case patchKeep, patchEdit:
+		if n >= uint64(len(base)) {
+			return nil, fmt.Errorf("no base chunk #%v, there are %v", n, len(base))
+		}
+		c := base[n]
+		if op == patchKeep {
+			return c, nil
+		}
+		if !c.IsContainer() {
+			return nil, fmt.Errorf("base chunk #%v %q is not a container", n, c.ID)
+		}
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if count > uint64(r.Len()) {
+			return nil, fmt.Errorf("%v subchunks don't fit in the rest of the patch", count)
+		}
+		edited := &Chunk{ID: c.ID, ListID: c.ListID, Chunks: make([]*Chunk, 0, count)}
+		for i := uint64(0); i < count; i++ {
+			sc, err := applyPatch(r, c.Chunks)
+			if err != nil {
+				return nil, err
+			}
+			edited.Chunks = append(edited.Chunks, sc)
+		}
+		edited.updateLen()
+		return edited, nil
+
+	case patchChunk:
+		if n > uint64(r.Len()) {
+			return nil, fmt.Errorf("chunk of %v bytes doesn't fit in the rest of the patch", n)
+		}
+		b := make([]byte, n)
+		io.ReadFull(r, b)
+		c, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode new chunk: %v", err)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op)
+}
@@ -0,0 +1,76 @@
+package riff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	samples := bytes.Repeat([]byte{1, 2, 3, 4}, 1024)
+	decode := func(b []byte) *Chunk {
+		c, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	base := decode(BuildRIFF(NewID("WAVE"),
+		ChunkSpec{ID: "fmt ", Data: make([]byte, 16)},
+		ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("old")}, {ID: "IART", Data: []byte("me")}}},
+		ChunkSpec{ID: "data", Data: samples},
+	))
+	want := BuildRIFF(NewID("WAVE"),
+		ChunkSpec{ID: "fmt ", Data: make([]byte, 16)},
+		ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "IART", Data: []byte("me")}, {ID: "INAM", Data: []byte("new title")}}},
+		ChunkSpec{ID: "data", Data: samples},
+		ChunkSpec{ID: "JUNK", Data: []byte{0}},
+	)
+	target := decode(want)
+
+	p, err := Patch(base, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) > 64 {
+		t.Errorf("patch of %v bytes for small metadata changes: %q", len(p), p)
+	}
+	got, err := Apply(base, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := got.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("applied patch got %q, expected %q", buf.Bytes(), want)
+	}
+
+	// Leaves read from sections are kept when their data is unchanged.
+	lazy := func(b []byte) *Chunk {
+		c, err := NewReaderAtDecoder(bytes.NewReader(b), int64(len(b))).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	lazyBase := lazy(want)
+	for _, target := range []*Chunk{lazyBase.Clone(), lazy(want), decode(want)} {
+		p, err := Patch(lazyBase, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := []byte{patchKeep, 0}; !bytes.Equal(p, exp) {
+			t.Errorf("patch of identical trees got %q, expected %q", p, exp)
+		}
+	}
+
+	if got, err := Apply(base, []byte{patchKeep, 0}); err != nil || got != base {
+		t.Errorf("identity patch got %v, %v", got, err)
+	}
+	for _, p := range [][]byte{nil, {patchKeep, 1}, {patchEdit, 0, 5}, {patchChunk, 20, 'a'}, {'x', 0}, {patchKeep, 0, 0}} {
+		if _, err := Apply(base, p); err == nil {
+			t.Errorf("patch %q: expected error", p)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package riff
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// BufferPool provides the buffers holding the Data of decoded chunks, so
+// that servers decoding many files can reuse them instead of leaving them
+// to the garbage collector.
+type BufferPool interface {
+	// Get returns a slice of length n.
+	Get(n int) []byte
+	// Put gives back a slice returned by Get. The slice must not be used
+	// afterwards.
+	Put([]byte)
+}
+
+// NewBufferPool returns a BufferPool backed by sync.Pools, one per power of
+// two size class.
+func NewBufferPool() BufferPool {
+	return new(syncPool)
+}
+
+type syncPool struct {
+	classes [bits.UintSize]sync.Pool
+}
+
+func (p *syncPool) Get(n int) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	class := bits.Len(uint(n - 1))
+	if b, ok := p.classes[class].Get().(*[]byte); ok {
+		return (*b)[:n]
+	}
+	return make([]byte, n, 1<<class)
+}
+
+func (p *syncPool) Put(b []byte) {
+	c := cap(b)
+	if c == 0 || c&(c-1) != 0 {
+		return // not allocated by Get
+	}
+	b = b[:c]
+	p.classes[bits.Len(uint(c-1))].Put(&b)
+}
+
+// Release gives the Data of every chunk in the tree rooted at c back to p,
+// which should be the BufferPool used by the Decoder that decoded it, and
+// clears it. Neither the Data nor any Content decoded from it can be used
+// after calling Release.
+func (c *Chunk) Release(p BufferPool) {
+	c.walk(func(c *Chunk) {
+		if c.Data != nil {
+			p.Put(c.Data)
+			c.Data = nil
+		}
+	})
+}
+
+// Close closes the Content of every chunk in the tree rooted at c that
+// implements io.Closer, as returned by DecoderFuncs holding resources such
+// as open files. Every such Content is closed even if some fail, and the
+// first error is returned.
+func (c *Chunk) Close() error {
+	var first error
+	c.walk(func(c *Chunk) {
+		if cl, ok := c.Content.(io.Closer); ok {
+			if err := cl.Close(); err != nil && first == nil {
+				first = fmt.Errorf("close %q: %v", c.ID, err)
+			}
+		}
+	})
+	return first
+}
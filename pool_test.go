@@ -0,0 +1,124 @@
+package riff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	p := NewBufferPool()
+	for _, n := range []int{0, 1, 2, 3, 1000, 1024, 1025} {
+		b := p.Get(n)
+		if len(b) != n {
+			t.Errorf("Get(%v) returned %v bytes", n, len(b))
+		}
+		p.Put(b)
+	}
+	p.Put(make([]byte, 10)) // not from the pool, ignored
+	if b := p.Get(10); len(b) != 10 || cap(b) != 16 {
+		t.Errorf("Get(10) returned len %v cap %v", len(b), cap(b))
+	}
+
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		d := NewDecoder(bytes.NewReader(b))
+		d.BufferPool = p
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		buf := new(bytes.Buffer)
+		c.WriteTo(buf)
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Fatalf("round trip %v with pooled buffers changed the file", i)
+		}
+		c.Release(p)
+		if d := c.FindChunk(NewID("data")).Data; d != nil {
+			t.Errorf("data not cleared by Release")
+		}
+	}
+}
+
+func benchmarkPool(b *testing.B, p BufferPool) {
+	data, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		b.Fatal(err)
+	}
+	data = manyChunksOf(data[70:7870], 100)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(bytes.NewReader(data))
+		d.BufferPool = p
+		c, err := d.Decode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if p != nil {
+			c.Release(p)
+		}
+	}
+}
+
+// manyChunksOf returns a RIFF file holding n data chunks with the given
+// payload.
+func manyChunksOf(payload []byte, n int) []byte {
+	var chunks [][]byte
+	for i := 0; i < n; i++ {
+		chunks = append(chunks, leafBytes("data", payload))
+	}
+	return listBytes("RIFF", "TEST", chunks...)
+}
+
+func BenchmarkDecodeNoPool(b *testing.B) { benchmarkPool(b, nil) }
+func BenchmarkDecodePool(b *testing.B)   { benchmarkPool(b, NewBufferPool()) }
+
+// closer is a Content counting how many times it is closed.
+type closer struct {
+	closed int
+	err    error
+}
+
+func (c *closer) Close() error {
+	c.closed++
+	return c.err
+}
+
+func TestClose(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("name"))),
+		leafBytes("data", []byte{1, 2}),
+	)
+	var closers []*closer
+	d := NewDecoder(bytes.NewReader(b))
+	for _, id := range []string{"INAM", "data"} {
+		d.Map(NewID(id), func(io.Reader) (interface{}, error) {
+			c := &closer{}
+			closers = append(closers, c)
+			return c, nil
+		})
+	}
+	d.Map(NewID("fmt "), WaveFmtDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	closers[0].err = errors.New("busy")
+	closers[1].err = errors.New("gone")
+	if err := c.Close(); err == nil || !strings.Contains(err.Error(), "busy") {
+		t.Errorf("got error %v, expected the first one", err)
+	}
+	for i, cl := range closers {
+		if cl.closed != 1 {
+			t.Errorf("content #%v closed %v times, expected once", i, cl.closed)
+		}
+	}
+}
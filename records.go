@@ -0,0 +1,66 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// DecodeRecords decodes data as a sequence of fixed-size records of type T,
+// such as the entries of an index chunk, in the given byte order. T must
+// have a fixed size as defined by binary.Size, and the length of data must
+// be a multiple of it.
+func DecodeRecords[T any](data []byte, order binary.ByteOrder) ([]T, error) {
+	var zero T
+	size := binary.Size(zero)
+	if size <= 0 {
+		return nil, fmt.Errorf("records of type %T don't have a fixed size", zero)
+	}
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("length %v isn't a multiple of the %v byte record size", len(data), size)
+	}
+	rs := make([]T, len(data)/size)
+	if err := binary.Read(bytes.NewReader(data), order, rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// DecodeInto fills v, a pointer to a fixed-size value such as a struct, from
+// the data of the leaf chunk c in the given byte order. It's a quick way to
+// parse simple header chunks without writing a DecoderFunc. The size of v,
+// as defined by binary.Size, must be the length of the chunk.
+func (c *Chunk) DecodeInto(v interface{}, order binary.ByteOrder) error {
+	size := binary.Size(v)
+	if size < 0 {
+		return fmt.Errorf("values of type %T don't have a fixed size", v)
+	}
+	if uint32(size) != c.Len || len(c.Data) != size {
+		return fmt.Errorf("can't decode %q of length %v into %v bytes of %T", c.ID, c.Len, size, v)
+	}
+	return binary.Read(bytes.NewReader(c.Data), order, v)
+}
+
+// AsInt24LE returns the data of the leaf chunk c as 24 bit little endian
+// signed samples, the packed 3 byte format of 24 bit PCM audio, each sign
+// extended to an int32. The length of the data must be a multiple of 3.
+func (c *Chunk) AsInt24LE() ([]int32, error) {
+	data, err := c.loadedData()
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%3 != 0 {
+		return nil, fmt.Errorf("length %v of %q isn't a multiple of 3 bytes", len(data), c.ID)
+	}
+	s := make([]int32, len(data)/3)
+	for i := range s {
+		s[i] = int24LE(data[3*i:])
+	}
+	return s, nil
+}
+
+// int24LE returns the 24 bit little endian signed integer at the start of
+// b, sign extended.
+func int24LE(b []byte) int32 {
+	return int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+}
@@ -0,0 +1,94 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRecords(t *testing.T) {
+	type pair struct {
+		A uint16
+		B int16
+	}
+	got, err := DecodeRecords[pair]([]byte{1, 0, 0xff, 0xff, 0, 2, 0, 3}, binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("DecodeRecords: %v", err)
+	}
+	if exp := []pair{{1, -1}, {512, 768}}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("little endian: got %v, expected %v", got, exp)
+	}
+	got, err = DecodeRecords[pair]([]byte{1, 0, 0xff, 0xff}, binary.BigEndian)
+	if err != nil {
+		t.Fatalf("DecodeRecords: %v", err)
+	}
+	if exp := []pair{{256, -1}}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("big endian: got %v, expected %v", got, exp)
+	}
+
+	ids, err := DecodeRecords[ID]([]byte("fmt data"), binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("DecodeRecords: %v", err)
+	}
+	if exp := []ID{NewID("fmt "), NewID("data")}; !reflect.DeepEqual(ids, exp) {
+		t.Errorf("ids: got %q, expected %q", ids, exp)
+	}
+
+	if got, err := DecodeRecords[pair](nil, binary.LittleEndian); err != nil || len(got) != 0 {
+		t.Errorf("no data: got %v, %v", got, err)
+	}
+	if _, err := DecodeRecords[pair](make([]byte, 6), binary.LittleEndian); err == nil {
+		t.Errorf("expected error for a partial record")
+	}
+	if _, err := DecodeRecords[[]byte](make([]byte, 6), binary.LittleEndian); err == nil {
+		t.Errorf("expected error for a record type without fixed size")
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	c := decodeFile(t, "data/odd.wav")
+	var f struct {
+		FormatTag, Channels    uint16
+		SampleRate, ByteRate   uint32
+		BlockAlign, SampleBits uint16
+	}
+	if err := c.FindChunk(NewID("fmt ")).DecodeInto(&f, binary.LittleEndian); err != nil {
+		t.Fatalf("DecodeInto: %v", err)
+	}
+	if f.FormatTag != WaveFormatPCM || f.Channels != 1 || f.SampleRate != 8000 || f.SampleBits != 8 {
+		t.Errorf("got %+v", f)
+	}
+
+	var short struct{ FormatTag, Channels uint16 }
+	if err := c.FindChunk(NewID("fmt ")).DecodeInto(&short, binary.LittleEndian); err == nil {
+		t.Errorf("expected error decoding into a smaller struct")
+	}
+	var s []byte
+	if err := c.FindChunk(NewID("fmt ")).DecodeInto(&s, binary.LittleEndian); err == nil {
+		t.Errorf("expected error decoding into a slice pointer")
+	}
+}
+
+func TestAsInt24LE(t *testing.T) {
+	c := &Chunk{ID: NewID("data"), Data: []byte{0xff, 0xff, 0x7f, 0x00, 0x00, 0x80, 0xff, 0xff, 0xff, 0x01, 0x02, 0x03}}
+	got, err := c.AsInt24LE()
+	if err != nil {
+		t.Fatalf("AsInt24LE: %v", err)
+	}
+	if exp := []int32{8388607, -8388608, -1, 0x030201}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+	c.Data = c.Data[:4]
+	if _, err := c.AsInt24LE(); err == nil {
+		t.Errorf("expected error for a partial sample")
+	}
+
+	section := SectionChunk(dataID, bytes.NewReader([]byte{0, 1, 2, 3}), 1, 3)
+	if got, err := section.AsInt24LE(); err != nil || !reflect.DeepEqual(got, []int32{0x030201}) {
+		t.Errorf("section chunk: got %v, %v", got, err)
+	}
+	if _, err := (&Chunk{ID: dataID, Len: 3}).AsInt24LE(); err == nil {
+		t.Errorf("expected error for a chunk without data")
+	}
+}
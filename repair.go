@@ -0,0 +1,79 @@
+package riff
+
+import "fmt"
+
+// junkIDs are the IDs of the chunks used as padding in RIFF files.
+var junkIDs = map[ID]bool{NewID("JUNK"): true, NewID("junk"): true, NewID("PAD "): true, NewID("FLLR"): true}
+
+// Repair fixes the structural problems of the tree rooted at c and returns
+// a description of every repair made, or nil if there was nothing to fix.
+// It removes padding chunks without data and containers found among their
+// own descendants, moves the "fmt " chunk of WAVE files before their
+// "data" chunk, and recomputes lengths as UpdateLengths does. Only the structure of the tree is changed: chunk data, audio
+// included, is never modified. The data of leaves read by DecodeStructure
+// or skipped because of ReadOnly isn't loaded, so their lengths are kept.
+//
+// A top-level chunk whose length alone is exactly 8 bytes off, a common
+// encoder bug, is reported distinctly.
+func (c *Chunk) Repair() []string {
+	old := c.Len
+	var fixes []string
+	c.repair(&fixes, map[*Chunk]bool{})
+	if d := int64(old) - int64(c.Len); len(fixes) == 1 && c.IsContainer() && (d == 8 || d == -8) {
+		fixes[len(fixes)-1] = fmt.Sprintf("fixed length of %q from %v to %v, off by 8 as written by encoders that miscount the chunk header", c.ID, old, c.Len)
+	}
+	return fixes
+}
+
+func (c *Chunk) repair(fixes *[]string, path map[*Chunk]bool) {
+	if !c.IsContainer() {
+		if l := uint32(c.dataLen()); c.loaded() && c.Len != l {
+			*fixes = append(*fixes, fmt.Sprintf("fixed length of %q at offset %v from %v to %v", c.ID, c.Offset, c.Len, l))
+			c.Len = l
+		}
+		return
+	}
+
+	path[c] = true
+	chunks := c.Chunks[:0]
+	for _, sc := range c.Chunks {
+		if junkIDs[sc.ID] && sc.loaded() && sc.dataLen() == 0 {
+			*fixes = append(*fixes, fmt.Sprintf("removed empty %q at offset %v", sc.ID, sc.Offset))
+			continue
+		}
+		if path[sc] {
+			*fixes = append(*fixes, fmt.Sprintf("removed %q from %q, which it contains", sc.name(), c.name()))
+			continue
+		}
+		sc.repair(fixes, path)
+		chunks = append(chunks, sc)
+	}
+	c.Chunks = chunks
+	delete(path, c)
+
+	if c.ID == riff && c.ListID == wave {
+		if d, f := c.index(dataID), c.index(fmtID); d >= 0 && f > d {
+			fc := c.Chunks[f]
+			copy(c.Chunks[d+1:f+1], c.Chunks[d:f])
+			c.Chunks[d] = fc
+			*fixes = append(*fixes, fmt.Sprintf("moved %q before %q", fmtID, dataID))
+		}
+	}
+
+	old := c.Len
+	c.updateLen()
+	if c.Len != old {
+		*fixes = append(*fixes, fmt.Sprintf("fixed length of %q at offset %v from %v to %v", c.ID, c.Offset, old, c.Len))
+	}
+}
+
+// index returns the index of the first subchunk of c with the given id, or
+// -1 if there is none.
+func (c *Chunk) index(id ID) int {
+	for i, sc := range c.Chunks {
+		if sc.ID == id {
+			return i
+		}
+	}
+	return -1
+}
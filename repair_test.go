@@ -0,0 +1,92 @@
+package riff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	c := &Chunk{ID: riff, Len: 1000, ListID: wave, Chunks: []*Chunk{
+		{ID: NewID("JUNK")},
+		{ID: dataID, Len: 2, Data: []byte{1, 2, 3}},
+		{ID: list, Len: 4, ListID: info, Chunks: []*Chunk{
+			{ID: NewID("INAM"), Len: 4, Data: []byte("name")},
+		}},
+		{ID: fmtID, Len: 16, Data: make([]byte, 16)},
+		{ID: NewID("JUNK"), Len: 4, Data: make([]byte, 4)},
+	}}
+	fixes := c.Repair()
+	if len(fixes) != 5 {
+		t.Errorf("got %v repairs, expected 5: %q", len(fixes), fixes)
+	}
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		leafBytes("data", []byte{1, 2, 3}),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("name"))),
+		leafBytes("JUNK", make([]byte, 4)),
+	)
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), exp)
+	}
+
+	if fixes := c.Repair(); fixes != nil {
+		t.Errorf("repaired tree needs repairs: %q", fixes)
+	}
+	if fixes := decodeFile(t, "data/hand.wav").Repair(); fixes != nil {
+		t.Errorf("valid file needs repairs: %q", fixes)
+	}
+}
+
+func TestRepairOffBy8(t *testing.T) {
+	c := decodeFile(t, "data/odd.wav")
+	c.Len += 8
+	fixes := c.Repair()
+	if len(fixes) != 1 || !strings.Contains(fixes[0], "off by 8") {
+		t.Errorf("got repairs %q, expected an off by 8 one", fixes)
+	}
+	c.Chunks[0].Data = append(c.Chunks[0].Data, 1, 2, 3, 4, 5, 6, 7, 8)
+	fixes = c.Repair()
+	if len(fixes) != 2 || strings.Contains(fixes[1], "off by 8") {
+		t.Errorf("got repairs %q for grown data", fixes)
+	}
+}
+
+func TestRepairUnloaded(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		leafBytes("JUNK", make([]byte, 4)),
+		leafBytes("data", []byte{1, 2, 3}),
+	)
+	lazy, err := NewReaderAtDecoder(bytes.NewReader(b), int64(len(b))).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	structure, err := NewDecoder(bytes.NewReader(b)).DecodeStructure()
+	if err != nil {
+		t.Fatalf("DecodeStructure: %v", err)
+	}
+	for name, c := range map[string]*Chunk{"lazy": lazy, "structure": structure} {
+		if fixes := c.Repair(); fixes != nil {
+			t.Errorf("%v: valid file needs repairs: %q", name, fixes)
+		}
+		if len(c.Chunks) != 3 || c.Chunks[2].Len != 3 {
+			t.Errorf("%v: repair changed the tree to %v", name, c)
+		}
+	}
+}
+
+func TestRepairCyclic(t *testing.T) {
+	c := cyclicTree()
+	fixes := c.Repair()
+	if len(fixes) == 0 || !strings.Contains(strings.Join(fixes, "\n"), "which it contains") {
+		t.Errorf("got repairs %q, expected the cycle to be removed", fixes)
+	}
+	if _, err := c.MaxDepth(); err != nil {
+		t.Errorf("repaired tree: %v", err)
+	}
+}
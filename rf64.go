@@ -0,0 +1,159 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	rf64ID = ID{'R', 'F', '6', '4'}
+	ds64ID = ID{'d', 's', '6', '4'}
+)
+
+// rf64Limit is the largest size a chunk length can hold. It is a variable
+// so tests can lower it.
+var rf64Limit int64 = math.MaxUint32
+
+// size64 returns the number of bytes taken by c once written, header and
+// pad bytes included, with the sizes of leaves taken from their Data.
+func (c *Chunk) size64() int64 {
+	if !c.IsContainer() {
+		return 8 + c.dataLen() + c.dataLen()%2
+	}
+	n := int64(12)
+	for _, sc := range c.Chunks {
+		n += sc.size64()
+	}
+	return n
+}
+
+// needsRF64 reports whether the RIFF chunk c, or its data chunk, is too
+// large for its length to fit in a chunk header.
+func (c *Chunk) needsRF64() bool {
+	if c.size64()-8 > rf64Limit {
+		return true
+	}
+	for _, sc := range c.Chunks {
+		if sc.ID == dataID && sc.dataLen() > rf64Limit {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRF64 writes the RIFF chunk c as an RF64 chunk, replacing any ds64
+// chunk it holds with one giving its actual sizes. As with WriteTo, the
+// leaves whose length is written must hold as many bytes as it declares.
+func (c *Chunk) writeRF64(w *writer) {
+	for _, sc := range c.Chunks {
+		if sc.ID == ds64ID || sc.ID == dataID {
+			continue
+		}
+		if w.err = sc.checkLeafLengths(); w.err != nil {
+			return
+		}
+	}
+	var fmtc, fact, data *Chunk
+	size := int64(4 + 8 + 28)
+	for _, sc := range c.Chunks {
+		switch sc.ID {
+		case ds64ID:
+			continue
+		case fmtID:
+			fmtc = sc
+		case factID:
+			fact = sc
+		case dataID:
+			data = sc
+		}
+		size += sc.size64()
+	}
+	var dataSize, samples uint64
+	if data != nil {
+		dataSize = uint64(data.dataLen())
+	}
+	var fmtData, factData []byte
+	if fmtc != nil {
+		fmtData, _ = fmtc.loadedData()
+	}
+	if fact != nil {
+		factData, _ = fact.loadedData()
+	}
+	if len(fmtData) >= 16 && binary.LittleEndian.Uint16(fmtData) == WaveFormatPCM {
+		if align := binary.LittleEndian.Uint16(fmtData[12:]); align > 0 {
+			samples = dataSize / uint64(align)
+		}
+	} else if len(factData) >= 4 {
+		samples = uint64(binary.LittleEndian.Uint32(factData))
+	}
+
+	w.Write(rf64ID[:])
+	w.writeUint32(math.MaxUint32)
+	w.Write(c.ListID[:])
+
+	var ds64 [8 + 28]byte
+	copy(ds64[:], ds64ID[:])
+	binary.LittleEndian.PutUint32(ds64[4:], 28)
+	binary.LittleEndian.PutUint64(ds64[8:], uint64(size))
+	binary.LittleEndian.PutUint64(ds64[16:], dataSize)
+	binary.LittleEndian.PutUint64(ds64[24:], samples)
+	w.Write(ds64[:]) // no table entries
+
+	for i := 0; w.err == nil && i < len(c.Chunks); i++ {
+		switch sc := c.Chunks[i]; sc.ID {
+		case ds64ID:
+		case dataID:
+			w.Write(sc.ID[:])
+			w.writeUint32(math.MaxUint32)
+			sc.writeData(w)
+			if sc.dataLen()%2 != 0 {
+				w.Write([]byte{sc.padByte})
+			}
+		default:
+			sc.writeTo(w)
+		}
+	}
+}
+
+// applyDS64 reads the sizes held by the ds64 chunk ds, the first subchunk of
+// the RF64 chunk c whose remaining subchunks are read from lr. They replace
+// the lengths set to 0xFFFFFFFF: that of c, along with what is left to read
+// in lr, and that of its data chunk. Sizes too large for the Len of a Chunk
+// can't be decoded.
+func (d *Decoder) applyDS64(c, ds *Chunk, lr *io.LimitedReader) error {
+	b, err := ds.loadedData()
+	if err != nil {
+		return err
+	}
+	if len(b) < 16 {
+		return fmt.Errorf("%q chunk of %v bytes has no room for the RF64 and data sizes", ds.ID, len(b))
+	}
+	size, data := binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint64(b[8:])
+	if c.Len == math.MaxUint32 {
+		read := int64(c.Len) - 4 - lr.N
+		if size >= math.MaxUint32 {
+			return fmt.Errorf("%q chunk of %v bytes is too large to decode", c.ID, size)
+		}
+		if int64(size) < 4+read {
+			return fmt.Errorf("%q chunk of %v bytes is shorter than its form type and %q chunk", c.ID, size, ds.ID)
+		}
+		c.Len, lr.N = uint32(size), int64(size)-4-read
+	}
+	d.rf64Data = &data
+	return nil
+}
+
+// rf64Len sets the length of the data chunk c of an RF64 chunk to the size
+// held by its ds64 chunk, if its length is 0xFFFFFFFF.
+func (d *Decoder) rf64Len(c *Chunk) error {
+	if d.rf64Data == nil || c.ID != dataID || c.Len != math.MaxUint32 {
+		return nil
+	}
+	if n := *d.rf64Data; n >= math.MaxUint32 {
+		return fmt.Errorf("%q chunk of %v bytes is too large to decode", c.ID, n)
+	}
+	c.Len = uint32(*d.rf64Data)
+	return nil
+}
@@ -0,0 +1,106 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRF64(t *testing.T) {
+	c := decodeFile(t, "data/odd.wav")
+	defer func(l int64) { rf64Limit = l }(rf64Limit)
+	for _, tt := range []struct {
+		name  string
+		force bool
+		limit int64
+	}{
+		{"forced", true, 1 << 32},
+		{"promoted", false, 50},
+		{"data promoted", false, 6},
+	} {
+		rf64Limit = tt.limit
+		buf := new(bytes.Buffer)
+		e := NewEncoder(buf)
+		e.RF64 = tt.force
+		if err := e.Encode(c); err != nil {
+			t.Fatalf("%v: Encode: %v", tt.name, err)
+		}
+		b := buf.Bytes()
+		if string(b[:4]) != "RF64" || binary.LittleEndian.Uint32(b[4:]) != 0xffffffff || string(b[8:16]) != "WAVEds64" {
+			t.Fatalf("%v: got header %q", tt.name, b[:16])
+		}
+		riffSize := binary.LittleEndian.Uint64(b[20:])
+		dataSize := binary.LittleEndian.Uint64(b[28:])
+		samples := binary.LittleEndian.Uint64(b[36:])
+		if riffSize != uint64(len(b)-8) || dataSize != 7 || samples != 7 {
+			t.Errorf("%v: ds64 holds sizes %v, %v and %v samples, expected %v, 7 and 7", tt.name, riffSize, dataSize, samples, len(b)-8)
+		}
+
+		// Rewriting the remaining chunks as a RIFF must give back the file.
+		rest := append([]byte("RIFF\x00\x00\x00\x00WAVE"), b[48:]...)
+		binary.LittleEndian.PutUint32(rest[4:], c.Len)
+		i := bytes.Index(rest, []byte("data"))
+		binary.LittleEndian.PutUint32(rest[i+4:], 7)
+		exp := new(bytes.Buffer)
+		c.WriteTo(exp)
+		if !bytes.Equal(rest, exp.Bytes()) {
+			t.Errorf("%v: got chunks %q, expected %q", tt.name, rest, exp.Bytes())
+		}
+
+		// Decode reads the file back, and Encode writes it as it was.
+		for _, d := range []*Decoder{NewDecoder(bytes.NewReader(b)), NewReaderAtDecoder(bytes.NewReader(b), int64(len(b)))} {
+			got, err := d.Decode()
+			if err != nil {
+				t.Fatalf("%v: Decode: %v", tt.name, err)
+			}
+			if got.ID != rf64ID || got.Len != uint32(riffSize) || got.Chunks[0].ID != ds64ID {
+				t.Fatalf("%v: decoded %v", tt.name, got)
+			}
+			if data := got.FindChunk(dataID); data.Len != 7 || !EqualContent(&Chunk{ID: riff, ListID: wave, Chunks: got.Chunks[1:]}, c) {
+				t.Errorf("%v: decoded %v, expected the chunks of %v", tt.name, got, c)
+			}
+			again := new(bytes.Buffer)
+			if err := NewEncoder(again).Encode(got); err != nil {
+				t.Fatalf("%v: Encode decoded RF64: %v", tt.name, err)
+			}
+			if !bytes.Equal(again.Bytes(), b) {
+				t.Errorf("%v: encoded the decoded file as %q, expected %q", tt.name, again.Bytes(), b)
+			}
+		}
+	}
+
+	bad := c.Clone()
+	bad.FindChunk(NewID("INFO"), NewID("INAM")).Data = []byte("x")
+	e := NewEncoder(new(bytes.Buffer))
+	e.RF64 = true
+	if err := e.Encode(bad); err == nil {
+		t.Errorf("expected error writing a leaf whose length doesn't match its data as RF64")
+	}
+
+	big := append([]byte(nil), encodeRF64(t, c)...)
+	binary.LittleEndian.PutUint64(big[28:], 1<<32)
+	if _, err := NewDecoder(bytes.NewReader(big)).Decode(); err == nil {
+		t.Errorf("expected error decoding a data chunk of 4GiB")
+	}
+
+	rf64Limit = 1000
+	buf := new(bytes.Buffer)
+	if err := NewEncoder(buf).Encode(c); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if string(buf.Bytes()[:4]) != "RIFF" {
+		t.Errorf("small file was written as %q", buf.Bytes()[:4])
+	}
+}
+
+// encodeRF64 returns c encoded as an RF64 file.
+func encodeRF64(t *testing.T, c *Chunk) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf)
+	e.RF64 = true
+	if err := e.Encode(c); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -4,15 +4,22 @@
 package riff
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"sync"
+	"time"
 )
 
 var (
 	riff = NewID("RIFF")
+	rifx = NewID("RIFX")
 	list = NewID("LIST")
 )
 
@@ -24,30 +31,363 @@ type Chunk struct {
 	ListID  ID          // Identifier for this RIFF or LIST Chunk
 	Chunks  []*Chunk    // SubChunks
 	Content interface{} // Decoded data content
+	Offset  int64       // Offset of the chunk in the decoded stream
+
+	padByte byte              // Pad byte read after odd-length data, written back by WriteTo
+	section *io.SectionReader // Data of chunks created by SectionChunk, used instead of Data
+	decoded bool              // Content was set by a DecoderFunc registered for the chunk, or by SetContent
+	clamped uint32            // Declared length of a chunk cut while decoding, 0 if it wasn't
 }
 
 func (c *Chunk) String() string {
 	s := fmt.Sprintf("%q[len:%v|%v]", c.ID, c.Len, c.Content)
+	if _, err := c.MaxDepth(); err != nil {
+		return s + fmt.Sprintf("{%q: %v}", c.ListID, err)
+	}
 	if len(c.Chunks) > 0 {
 		s += fmt.Sprintf("{%q: %v}", c.ListID, c.Chunks)
 	}
 	return s
 }
 
+// Clamped reports whether c was cut while decoding because its declared
+// length overran its container or the stream, in Lenient or Tolerant mode,
+// and returns the declared length. The Len of c is then the number of
+// bytes actually read.
+func (c *Chunk) Clamped() (declared uint32, ok bool) {
+	return c.clamped, c.clamped != 0
+}
+
+// clamp sets the length of c, as declared in its header, to the shorter
+// length n actually read.
+func (c *Chunk) clamp(n uint32) {
+	if c.clamped == 0 {
+		c.clamped = c.Len
+	}
+	c.Len = n
+}
+
+// IsContainer reports whether c is a RIFF, RIFX or LIST chunk, holding a
+// form type and subchunks rather than data.
+func (c *Chunk) IsContainer() bool {
+	return isContainer(c.ID)
+}
+
+func isContainer(id ID) bool {
+	return id == riff || id == rifx || id == list || id == rf64ID
+}
+
+// FindChunk returns the chunk found by following path from c, or nil if
+// there is none. Each element of the path selects the first subchunk whose
+// ID, or ListID for containers, matches it, so for a WAV file
+// FindChunk(NewID("INFO"), NewID("ISFT")) finds the software name.
+func (c *Chunk) FindChunk(path ...ID) *Chunk {
+	for _, id := range path {
+		var next *Chunk
+		for _, sc := range c.Chunks {
+			if sc.ID == id || (sc.IsContainer() && sc.ListID == id) {
+				next = sc
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		c = next
+	}
+	return c
+}
+
+// At returns the chunk found by following path from c, each index selecting
+// a subchunk by its position, as needed when siblings share their ID, as the
+// stream lists of AVI files do: c.At(1, 0) is the first subchunk of the
+// second subchunk of c. An index out of range is an error naming the chunk
+// it was applied to.
+func (c *Chunk) At(indices ...int) (*Chunk, error) {
+	for depth, i := range indices {
+		if i < 0 || i >= len(c.Chunks) {
+			return nil, fmt.Errorf("index #%v: %q has no subchunk #%v, it has %v", depth, c.name(), i, len(c.Chunks))
+		}
+		c = c.Chunks[i]
+	}
+	return c, nil
+}
+
+// FindAll returns every chunk of the tree rooted at c, c included, whose ID,
+// or ListID for containers, is id, in depth-first order.
+func (c *Chunk) FindAll(id ID) []*Chunk {
+	var cs []*Chunk
+	c.walk(func(c *Chunk) {
+		if c.ID == id || (c.IsContainer() && c.ListID == id) {
+			cs = append(cs, c)
+		}
+	})
+	return cs
+}
+
+// Find returns an iterator over the chunks of the tree rooted at c, c
+// included, for which pred returns true. Every call returns the next match
+// in depth-first pre-order, as FindAll, or nil once there are no more. The
+// tree is only traversed as far as needed to find the next match, so
+// stopping early skips the rest of it.
+func (c *Chunk) Find(pred func(*Chunk) bool) func() *Chunk {
+	stack := []*Chunk{c}
+	return func() *Chunk {
+		for len(stack) > 0 {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for i := len(n.Chunks) - 1; i >= 0; i-- {
+				stack = append(stack, n.Chunks[i])
+			}
+			if pred(n) {
+				return n
+			}
+		}
+		return nil
+	}
+}
+
+// FindFirst returns the first chunk of the tree rooted at c, c included,
+// whose ID, or ListID for containers, is id, in depth-first order, or nil
+// if there is none: the first chunk FindAll would return. Unlike
+// FindChunk, which follows a path of subchunks, it searches the whole tree.
+func (c *Chunk) FindFirst(id ID) *Chunk {
+	return c.first(func(c *Chunk) bool {
+		return c.ID == id || (c.IsContainer() && c.ListID == id)
+	})
+}
+
+// first returns the first chunk in the tree rooted at c, in depth-first
+// order, for which match returns true, or nil if there is none. As walk, it
+// doesn't descend again into a container found among its own descendants.
+func (c *Chunk) first(match func(*Chunk) bool) *Chunk {
+	return c.firstIn(match, map[*Chunk]bool{})
+}
+
+func (c *Chunk) firstIn(match func(*Chunk) bool, path map[*Chunk]bool) *Chunk {
+	if match(c) {
+		return c
+	}
+	if path[c] {
+		return nil
+	}
+	path[c] = true
+	defer delete(path, c)
+	for _, sc := range c.Chunks {
+		if f := sc.firstIn(match, path); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
 type DecoderFunc func(io.Reader) (interface{}, error)
 
+// ChunkInfo describes the chunk whose data a function registered with
+// MapFunc decodes.
+type ChunkInfo struct {
+	ID     ID
+	Len    uint32
+	ListID ID // Form type of the container holding the chunk
+}
+
+// Decoder reads chunk trees from an input stream.
+//
+// Only RIFF, RIFX and LIST chunks, as reported by Chunk.IsContainer, are
+// decoded as containers. Every other chunk is a leaf whose payload is kept
+// as Data, even if it happens to look like a form type followed by
+// subchunks, so the structure of untrusted input can't make the decoder
+// recurse into chunks it doesn't understand.
 type Decoder struct {
-	r     io.Reader
-	funcs map[ID]DecoderFunc
-	m     sync.RWMutex
+	// KnownForms, if not empty, lists the form types accepted for a
+	// top-level RIFF chunk. Decoding a RIFF chunk with any other form type
+	// fails before any of its subchunks is read.
+	KnownForms []ID
+
+	// Progress, if not nil, is called every time a chunk has been read
+	// completely, subchunks included, with its ID and the number of bytes
+	// read so far. If it returns an error decoding stops and Decode returns
+	// that error.
+	Progress func(id ID, n int64) error
+
+	// BufferPool, if not nil, provides the buffers holding the Data of the
+	// decoded chunks. See Chunk.Release.
+	BufferPool BufferPool
+
+	// ContentTimeout, if positive, bounds the time a DecoderFunc may spend
+	// on a chunk, protecting against functions looping on crafted input.
+	// Decoding fails when the limit is exceeded. Go can't stop the function,
+	// which keeps running in the background with its result discarded. A
+	// panic in a function guarded this way is returned as an error too.
+	ContentTimeout time.Duration
+
+	// MaxContentDecodes, if positive, bounds the number of DecoderFunc
+	// calls made by every call to Decode, bounding the work an untrusted
+	// file holding many mapped chunks can cause. Decode fails, even in
+	// Tolerant mode, when a chunk would need one more call.
+	MaxContentDecodes int
+
+	// MaxChunkSize, set to DefaultMaxChunkSize by NewDecoder, bounds the
+	// length of the leaves whose data Decode reads, so that a corrupt or
+	// crafted length can't make it allocate gigabytes before failing to
+	// read them. Decode fails, even in Tolerant mode, on a longer leaf.
+	// Zero means no limit. Whatever the limit, if the reader is an
+	// io.Seeker no more is allocated for a leaf than is left in the stream.
+	MaxChunkSize uint32
+
+	// MaxDepth, set to DefaultMaxDepth by NewDecoder, bounds the number of
+	// containers nested in one another, the top-level chunk included, so
+	// that a crafted file of deeply nested LISTs can't exhaust the stack.
+	// A deeper container is an error, which in Tolerant mode drops it along
+	// with the rest of its container. Zero means no limit.
+	MaxDepth int
+
+	// CaseInsensitiveLookup makes chunks without a DecoderFunc registered
+	// for their exact ID use one registered for the same ID in a different
+	// case, so that "FMT " chunks are decoded by the function for "fmt ".
+	// The IDs of the decoded chunks are kept as read.
+	CaseInsensitiveLookup bool
+
+	// Tolerant makes Decode record recoverable errors, returned by Errors,
+	// instead of failing, to salvage what can be read of a corrupt file.
+	// A chunk overrunning its container is cut at the container's end, a
+	// truncated leaf keeps the data read, and a subchunk that can't be
+	// decoded is dropped along with the rest of its container. Lengths of
+	// the containers holding such chunks are recomputed, so the tree can be
+	// written back. Failing DecoderFuncs, rewrites and verifiers leave the
+	// chunk as read. Errors in the header of the top-level chunk, and errors
+	// returned by Progress, still make Decode fail.
+	Tolerant bool
+
+	// Lenient makes Decode cut a leaf whose length overruns its container
+	// at the end of the container, as written by recorders miscounting the
+	// length of their "data" chunk, rather than failing. Unlike Tolerant,
+	// no error is recorded and any other problem still makes Decode fail.
+	// Cut chunks are reported by Chunk.Clamped, and the lengths of their
+	// containers are recomputed so the tree can be written back.
+	Lenient bool
+
+	// StrictFuncConsumption makes a DecoderFunc that returns without
+	// reading all the data of its chunk an error, to catch functions that
+	// ignore part of it. In Tolerant mode the error is only recorded, and
+	// Content is set to what the function returned.
+	StrictFuncConsumption bool
+
+	// StrictIDs makes Decode fail on a chunk whose ID, or form type for
+	// containers, isn't printable ASCII, as TryNewID does, which almost
+	// always means the decoder lost track of the chunk boundaries, rather
+	// than decoding garbage. In Tolerant mode the chunk is dropped along
+	// with the rest of its container.
+	StrictIDs bool
+
+	// Logger, if set, is called with a description of every chunk read,
+	// of every DecoderFunc run and of every error recovered in Tolerant
+	// mode, to trace how a file is decoded. log.Printf can be used.
+	Logger func(format string, args ...interface{})
+
+	// DataToEOF makes Decode read the data of the last leaf of the stream
+	// until the end of the stream if its length is 0 or overruns its
+	// containers, as written by recorders that never went back to fix the
+	// lengths of their files. The length of the leaf is set to the number
+	// of bytes read, and those of its containers are recomputed. A leaf is
+	// only considered last if no chunk of any of its containers is declared
+	// to follow it.
+	DataToEOF bool
+
+	// ReadOnly, if not empty, lists the IDs of the only leaves whose data
+	// Decode reads, such as the metadata chunks of a file whose samples
+	// aren't needed. The data of other leaves is skipped, seeking past it if
+	// the reader is an io.Seeker, and they are kept in the tree with their
+	// ID, length and offset, but no Data nor Content.
+	ReadOnly []ID
+
+	// RecoverTrailing makes Decode go on reading chunks past the declared
+	// end of the top-level chunk until the end of the stream, and append
+	// them to it, to rescue files whose encoder wrote a RIFF length too
+	// short. Recovery stops without error at a header whose ID isn't
+	// printable ASCII or is RIFF or RIFX, as found in files padded with
+	// zeros or concatenating several RIFF chunks, after which the position
+	// in the reader is undefined. The length of the top-level chunk is
+	// recomputed, and Recovered reports how many chunks were appended.
+	RecoverTrailing bool
+
+	// Unpadded makes Decode expect no pad byte after odd-length chunks,
+	// and container lengths that don't count them, as written by an
+	// Encoder with PadOddChunks unset and by some nonconformant tools.
+	Unpadded bool
+
+	r         *reader
+	funcs     map[ID]DecoderFunc
+	fallback  DecoderFunc
+	formFuncs map[formID]DecoderFunc
+	verify    map[ID]func(*Chunk) error
+	rewrite   map[ID]func([]byte) ([]byte, error)
+	transform map[ID]func(io.Reader) (io.Reader, error)
+	listPost  map[ID]func(*Chunk) error
+	rewrites  int // number of chunks whose length was changed by rewrite
+	clamps    int // number of chunks cut at the end of their container
+	errs      []error
+	decodes   int // DecoderFunc calls made by the current Decode
+	recovered int // chunks appended by RecoverTrailing
+	m         sync.RWMutex
+	form      ID // form type of the top-level chunk being decoded
+	parent    ID // form type of the container being decoded
+	hint      int
+	stop      error // error stopping decoding even in Tolerant mode
+	buf       [4]byte
+	bigEndian bool    // lengths are big endian, as in RIFX files
+	structure bool    // skip leaf payloads, see DecodeStructure
+	path      []ID    // path of the chunk decoded by DecodePath
+	src       []byte  // input of NewBytesDecoder, which Data slices point into
+	want      *ID     // the next chunk is skipped unless it matches want
+	rf64Data  *uint64 // data length in the ds64 chunk of the RF64 chunk being decoded
+
+	pending    bytes.Buffer // input retained by DecodePartial
+	pendingOff int64        // offset of the first pending byte
+
+	next *ChunkScanner // subchunks read by Next
+	at   io.ReaderAt   // input of NewReaderAtDecoder, which leaves are sections of
+
+	ctx context.Context // checked before every chunk, if not nil
 }
 
+// DefaultMaxChunkSize is the default MaxChunkSize of decoders.
+const DefaultMaxChunkSize = 1 << 30
+
+// DefaultMaxDepth is the default MaxDepth of decoders.
+const DefaultMaxDepth = 1000
+
 func NewDecoder(r io.Reader) *Decoder {
-	return &Decoder{r: r, funcs: make(map[ID]DecoderFunc)}
+	return &Decoder{
+		MaxChunkSize: DefaultMaxChunkSize,
+		MaxDepth:     DefaultMaxDepth,
+
+		r:         &reader{r: r},
+		funcs:     make(map[ID]DecoderFunc),
+		formFuncs: make(map[formID]DecoderFunc),
+		verify:    make(map[ID]func(*Chunk) error),
+		rewrite:   make(map[ID]func([]byte) ([]byte, error)),
+		transform: make(map[ID]func(io.Reader) (io.Reader, error)),
+		listPost:  make(map[ID]func(*Chunk) error),
+	}
+}
+
+// Reset makes d read from r, as if it had been returned by NewDecoder(r),
+// but keeping its options and the functions registered with it, so a
+// single configured decoder can decode many files in turn. BytesRead, the
+// errors returned by Errors and the input retained by DecodePartial are
+// reset. Reset must not be called while d is decoding.
+func (d *Decoder) Reset(r io.Reader) {
+	d.r = &reader{r: r}
+	d.errs, d.decodes, d.rewrites, d.stop, d.recovered = nil, 0, 0, nil, 0
+	d.form, d.bigEndian, d.src, d.want, d.next = ID{}, false, nil, nil, nil
+	d.at = nil
+	d.pending.Reset()
+	d.pendingOff = 0
 }
 
 func (d *Decoder) Map(id ID, f DecoderFunc) error {
-	if id == riff || id == list {
+	if isContainer(id) {
 		return fmt.Errorf("id %v is reserved", id)
 	}
 	d.m.Lock()
@@ -56,105 +396,1408 @@ func (d *Decoder) Map(id ID, f DecoderFunc) error {
 	return nil
 }
 
-// ReadFrom reads a Chunk from the given reader.
+// MapFunc registers f like Map, but f is also given the ID and length of
+// every chunk it decodes, and the form type of the container holding it,
+// so that a single function can serve related IDs, or decode chunks
+// differently in an "INFO" and an "adtl" list.
+func (d *Decoder) MapFunc(id ID, f func(ChunkInfo, io.Reader) (interface{}, error)) error {
+	return d.Map(id, func(r io.Reader) (interface{}, error) {
+		ir := r.(*infoReader)
+		return f(ir.info, ir)
+	})
+}
+
+// infoReader is the reader of the data of a chunk passed to DecoderFuncs,
+// carrying the ChunkInfo of the chunk for functions registered with
+// MapFunc.
+type infoReader struct {
+	*bytes.Reader
+	info ChunkInfo
+}
+
+// MapIn registers f like Map, but only for chunks found in a top-level RIFF
+// chunk of the given form type. It takes precedence over functions
+// registered with Map, so that identically named chunks of different
+// formats can be decoded differently.
+func (d *Decoder) MapIn(form, id ID, f DecoderFunc) error {
+	if isContainer(id) {
+		return fmt.Errorf("id %v is reserved", id)
+	}
+	d.m.Lock()
+	d.formFuncs[formID{form, id}] = f
+	d.m.Unlock()
+	return nil
+}
+
+// MapDefault registers f to decode the leaf chunks for which no DecoderFunc
+// was registered with Map or MapIn, such as vendor specific chunks. RawDecoder
+// can be used to keep their data in Content as it is. Chunks decoded by f
+// are still reported as unknown by Chunk.Unknown.
+func (d *Decoder) MapDefault(f DecoderFunc) {
+	d.m.Lock()
+	d.fallback = f
+	d.m.Unlock()
+}
+
+// RawDecoder is a DecoderFunc that sets Content to a copy of the data of the
+// chunk, as a []byte.
+func RawDecoder(r io.Reader) (interface{}, error) {
+	return ioutil.ReadAll(r)
+}
+
+// Unknown reports whether the leaf c was not understood by the decoder that
+// read it: no DecoderFunc was registered with Map or MapIn for its ID, or it
+// failed in Tolerant mode. Chunks whose Content was set by SetContent are
+// known, and containers are never unknown.
+func (c *Chunk) Unknown() bool {
+	return !c.IsContainer() && !c.decoded
+}
+
+// formID identifies a chunk ID within a form type.
+type formID struct{ form, id ID }
+
+// funcFor returns the DecoderFunc registered for the chunks with the given
+// id in the current form, if any.
+func (d *Decoder) funcFor(id ID) (DecoderFunc, bool) {
+	d.m.RLock()
+	defer d.m.RUnlock()
+	if f, ok := d.formFuncs[formID{d.form, id}]; ok {
+		return f, true
+	}
+	if f, ok := d.funcs[id]; ok || !d.CaseInsensitiveLookup {
+		return f, ok
+	}
+	up := upperID(id)
+	for k, f := range d.formFuncs {
+		if k.form == d.form && upperID(k.id) == up {
+			return f, true
+		}
+	}
+	for k, f := range d.funcs {
+		if upperID(k) == up {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// upperID returns id with its ASCII letters in upper case.
+func upperID(id ID) ID {
+	for i, b := range id {
+		if 'a' <= b && b <= 'z' {
+			id[i] = b - 'a' + 'A'
+		}
+	}
+	return id
+}
+
+// MapVerify registers f to be called once every chunk with the given id
+// has been completely decoded, its Content and subchunks included. An error
+// returned by f makes Decode fail. Containers can be verified too, which
+// makes it possible to check chunks against their siblings; for instance a
+// verifier for a LIST can compare a checksum chunk with the data chunk
+// preceding it.
+func (d *Decoder) MapVerify(id ID, f func(c *Chunk) error) {
+	d.m.Lock()
+	d.verify[id] = f
+	d.m.Unlock()
+}
+
+// MapListPost registers f to be called with every container of the given
+// form type once its subchunks have been decoded, Content included, and
+// before any verifier registered for it with MapVerify. It makes it
+// possible to correlate sibling chunks, such as the labels of an "adtl"
+// list with cue points, for instance by setting the Content of the
+// container. An error returned by f makes Decode fail, or is recorded in
+// Tolerant mode.
+func (d *Decoder) MapListPost(formType ID, f func(*Chunk) error) {
+	d.m.Lock()
+	d.listPost[formType] = f
+	d.m.Unlock()
+}
+
+// MapRewrite registers f to replace the data of every leaf chunk with the
+// given id as soon as it has been read, before its DecoderFunc runs, which
+// makes it possible to clean files while decoding them. The Len of the
+// chunk is set to the length of the new data, and those of the containers
+// holding it are updated accordingly.
+func (d *Decoder) MapRewrite(id ID, f func([]byte) ([]byte, error)) error {
+	if isContainer(id) {
+		return fmt.Errorf("id %v is reserved", id)
+	}
+	d.m.Lock()
+	d.rewrite[id] = f
+	d.m.Unlock()
+	return nil
+}
+
+// MapListTransform registers t to transform the body of every container of
+// the given form type, such as the zlib compressed LISTs of some game
+// assets, before its subchunks are decoded. t is called with a reader over
+// the body, form type excluded, and the subchunks are decoded from the
+// reader it returns, which is read until io.EOF. The Offset of these
+// subchunks, and BytesRead and Progress while they are decoded, count the
+// bytes of the transformed body.
+//
+// The Len of the container remains the stored length, which differs from
+// that of its transformed subchunks: WriteTo doesn't reverse t, so the
+// lengths of the tree must be updated with UpdateLengths before writing it
+// back, uncompressed.
+func (d *Decoder) MapListTransform(formType ID, t func(io.Reader) (io.Reader, error)) {
+	d.m.Lock()
+	d.transform[formType] = t
+	d.m.Unlock()
+}
+
+// transformBody reads the whole body lr of the container c through t, and
+// returns a reader over the transformed body, from which d then reads,
+// and a function making d read from its previous reader again.
+func (d *Decoder) transformBody(t func(io.Reader) (io.Reader, error), lr *io.LimitedReader, c *Chunk) (*io.LimitedReader, func(), error) {
+	tr, err := t(lr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transform %q: %v", c.ListID, err)
+	}
+	b, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transform %q: %v", c.ListID, err)
+	}
+	if err := skip(lr, lr.N); err != nil {
+		return nil, nil, fmt.Errorf("skip %q body: %w", c.ListID, err)
+	}
+	base, src, at := d.r, d.src, d.at
+	d.r = &reader{r: bytes.NewReader(b), size: int64(len(b))}
+	if d.src != nil {
+		d.src = b
+	}
+	if d.at != nil {
+		d.at = bytes.NewReader(b)
+	}
+	restore := func() { d.r, d.src, d.at = base, src, at }
+	return &io.LimitedReader{R: d.r, N: int64(len(b))}, restore, nil
+}
+
+// HintChunks tells the decoder to expect about n subchunks per container,
+// so it can allocate the Chunks slices up front instead of growing them as
+// subchunks are decoded. The capacity is never larger than the number of
+// subchunks that fit in the container's length.
+func (d *Decoder) HintChunks(n int) {
+	d.hint = n
+}
+
+// Decode reads a Chunk from the decoder's reader. It returns io.EOF if the
+// reader has no more data. Errors met reading a chunk hold a DecodeError
+// telling which one. RF64 files, as written by Encoder, are read as an RF64
+// container whose length and that of its data chunk, set to 0xFFFFFFFF, are
+// taken from the ds64 chunk it starts with, as long as they fit in 32 bits.
+//
+// After a successful Decode, the reader is positioned right after the chunk
+// and its pad byte, if any, whatever chunks were skipped or tolerated on
+// the way, so the next Decode reads the chunk following it. Unless
+// DataToEOF or RecoverTrailing is set, which both read past the declared
+// end of the chunk as they document, nothing past the chunk is ever read.
+// After an error, the position is undefined.
 func (d *Decoder) Decode() (*Chunk, error) {
-	c := new(Chunk)
-	// ID
-	if err := c.ID.ReadFrom(d.r); err != nil {
-		return nil, fmt.Errorf("read id: %v", err)
+	d.errs, d.decodes, d.recovered = nil, 0, 0
+	if s, ok := d.r.r.(io.Seeker); ok && d.r.size == 0 {
+		d.r.setSize(s) // the size stays unknown if s can't seek
+	}
+	c, err := d.decode(d.r, 0)
+	if err == nil && d.RecoverTrailing && c.IsContainer() {
+		if err = d.recoverTrailing(c); err != nil {
+			c = nil
+		}
+	}
+	if d.stop != nil {
+		err, d.stop = d.stop, nil
+	}
+	return c, err
+}
+
+// DecodeContext is like Decode, but stops with the error of ctx, even in
+// Tolerant mode, if it is done before a chunk is read, however deeply
+// nested. A read that blocks is not interrupted, so the reader should
+// itself fail once ctx is done, as a network connection with a deadline
+// does.
+func (d *Decoder) DecodeContext(ctx context.Context) (*Chunk, error) {
+	d.ctx = ctx
+	defer func() { d.ctx = nil }()
+	return d.Decode()
+}
+
+// recoverTrailing appends to the top-level chunk c the chunks read after
+// its declared end, until the end of the stream.
+func (d *Decoder) recoverTrailing(c *Chunk) error {
+	for {
+		start := d.r.n
+		var h [8]byte
+		if n, err := io.ReadFull(d.r, h[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			d.logf("offset %v: stopped recovering at %v stray bytes", start, n)
+			break
+		}
+		var id ID
+		copy(id[:], h[:4])
+		if !printable(id) || id == riff || id == rifx {
+			d.logf("offset %v: stopped recovering at id %q", start, id)
+			break
+		}
+
+		// Decode the chunk as if its header hadn't been read yet.
+		src := d.r.r
+		d.r.r, d.r.n = io.MultiReader(bytes.NewReader(h[:]), src), start
+		d.parent = c.ListID
+		sc, err := d.decode(d.r, 1)
+		d.r.r = src
+		if err != nil {
+			err = fmt.Errorf("recover chunk #%v past the end of %q: %w", len(c.Chunks), c.ListID, err)
+			if d.stop != nil || !d.tolerate(start, err) {
+				return err
+			}
+			break
+		}
+		d.logf("offset %v: recovered chunk %q past the end of %q", start, sc.ID, c.ListID)
+		c.Chunks = append(c.Chunks, sc)
+		d.recovered++
+	}
+	if d.recovered > 0 {
+		c.updateLen()
+	}
+	return nil
+}
+
+// Recovered returns the number of chunks appended to the top-level chunk by
+// the last call to Decode, with RecoverTrailing set.
+func (d *Decoder) Recovered() int {
+	return d.recovered
+}
+
+// Errors returns the errors recorded in Tolerant mode by the last call to
+// Decode, each prefixed with the offset at which it was found.
+func (d *Decoder) Errors() []error {
+	return d.errs
+}
+
+// tolerate records err, found at offset off, and reports whether decoding
+// can go on, which is only the case in Tolerant mode.
+func (d *Decoder) tolerate(off int64, err error) bool {
+	if !d.Tolerant {
+		return false
 	}
+	d.errs = append(d.errs, fmt.Errorf("offset %v: %w", off, err))
+	d.logf("offset %v: recovered from error: %v", off, err)
+	return true
+}
+
+// logf calls d.Logger, if set.
+func (d *Decoder) logf(format string, args ...interface{}) {
+	if d.Logger != nil {
+		d.Logger(format, args...)
+	}
+}
+
+// BytesRead returns the number of bytes read so far from the decoder's
+// reader, which after Decode is the offset right after the last chunk
+// decoded, pad byte included. Comparing it to the size of the input detects
+// trailing data.
+func (d *Decoder) BytesRead() int64 {
+	return d.r.n
+}
+
+// DecodeAll reads chunks from the decoder's reader until its end, as found
+// in files concatenating several RIFF chunks.
+func (d *Decoder) DecodeAll() ([]*Chunk, error) {
+	var cs []*Chunk
+	for {
+		c, err := d.Decode()
+		if err == io.EOF {
+			return cs, nil
+		}
+		if err != nil {
+			return cs, fmt.Errorf("decode chunk #%v: %w", len(cs), err)
+		}
+		cs = append(cs, c)
+	}
+}
+
+// DecodeStructure reads a Chunk like Decode, but without reading the data
+// of leaf chunks: the decoder's reader, which must be an io.Seeker, seeks
+// past them instead. The returned tree holds the IDs, lengths and offsets
+// of every chunk, but leaves have no Data nor Content.
+func (d *Decoder) DecodeStructure() (*Chunk, error) {
+	s, ok := d.r.r.(io.Seeker)
+	if !ok {
+		return nil, fmt.Errorf("DecodeStructure needs an io.Seeker, got %T", d.r.r)
+	}
+	defer func(size int64) { d.structure, d.r.size = false, size }(d.r.size)
+	if err := d.r.setSize(s); err != nil {
+		return nil, err
+	}
+	d.structure = true
+	return d.Decode()
+}
 
-	// Len
-	err := binary.Read(d.r, binary.LittleEndian, &c.Len)
+// DecodePath decodes the next chunk of the decoder's reader like Decode,
+// but only returns the chunk found by following path, as in
+// Chunk.FindChunk, with its whole subtree. The chunks leading to it are
+// read, but the payloads of all others are skipped, by seeking if the
+// decoder's reader is an io.Seeker, and no DecoderFunc is run for them.
+// The reader is left after the next chunk, as with Decode. It is an error
+// if there is no chunk at path.
+func (d *Decoder) DecodePath(path ...ID) (*Chunk, error) {
+	defer func(size int64) { d.path, d.r.size = nil, size }(d.r.size)
+	if s, ok := d.r.r.(io.Seeker); ok {
+		if err := d.r.setSize(s); err != nil {
+			return nil, err
+		}
+	}
+	d.path = path
+	root, err := d.Decode()
 	if err != nil {
-		return nil, fmt.Errorf("read length: %v", err)
+		return nil, err
+	}
+	c := root.FindChunk(path...)
+	if c == nil {
+		return nil, fmt.Errorf("no chunk found at %q", path)
+	}
+	return c, nil
+}
+
+// CountChildren returns the number of subchunks of the container found by
+// following path, as in Chunk.FindChunk, from the next chunk of the
+// decoder's reader. Like DecodeStructure, which it uses, it needs an
+// io.Seeker and only reads chunk headers.
+func (d *Decoder) CountChildren(path ...ID) (int, error) {
+	root, err := d.DecodeStructure()
+	if err != nil {
+		return 0, err
+	}
+	c := root.FindChunk(path...)
+	if c == nil {
+		return 0, fmt.Errorf("no chunk found at %q", path)
+	}
+	if !c.IsContainer() {
+		return 0, fmt.Errorf("chunk %q at %q is not a container", c.ID, path)
+	}
+	return len(c.Chunks), nil
+}
+
+// decode reads from r a Chunk nested depth containers deep. The subchunks
+// of a container are read through an io.LimitedReader bounded by the
+// container's length, so no subchunk can claim bytes beyond its parent.
+func (d *Decoder) decode(r io.Reader, depth int) (_ *Chunk, err error) {
+	if depth == 0 {
+		d.form, d.parent, d.rf64Data = ID{}, ID{}, nil
+	}
+	c := &Chunk{Offset: d.r.n}
+	defer func() {
+		if err != nil {
+			err = d.decodeError(c, depth, err)
+		}
+	}()
+	want := d.want
+	d.want = nil
+	if err := d.chunkHeader(r, c); err != nil {
+		return nil, err
+	}
+	if err := d.rf64Len(c); err != nil {
+		return nil, err
+	}
+	if !c.IsContainer() {
+		d.logf("offset %v: chunk %q of length %v", c.Offset, c.ID, c.Len)
+	}
+	if want != nil && !c.IsContainer() && c.ID != *want {
+		return nil, d.skipChunk(r, c, 0)
+	}
+	var eof io.Reader // source to read the data of c from until EOF
+	skipData := !c.IsContainer() && c.ID != ds64ID && (d.structure || d.skipData(c.ID))
+	if d.DataToEOF && !skipData && !c.IsContainer() {
+		eof = untilEOF(r, c.Len)
+	}
+	if err := overrun(r, c); err != nil && eof == nil {
+		lr := r.(*io.LimitedReader)
+		if d.Lenient && !c.IsContainer() {
+			d.logf("offset %v: clamping: %v", c.Offset, err)
+		} else if !d.tolerate(c.Offset, err) {
+			return nil, err
+		}
+		c.clamp(uint32(lr.N))
+		d.clamps++
 	}
 
 	// LIST and RIFF contain subChunks
-	if c.ID == riff || c.ID == list {
-		if err := c.ListID.ReadFrom(d.r); err != nil {
+	if c.IsContainer() {
+		if err := d.formType(r, c, depth); err != nil {
 			return nil, err
 		}
+		d.logf("offset %v: container %q of form type %q and length %v", c.Offset, c.ID, c.ListID, c.Len)
+		if want != nil && c.ID != *want && c.ListID != *want {
+			return nil, d.skipChunk(r, c, 4)
+		}
+		if depth == 0 {
+			if (c.ID == riff || c.ID == rf64ID) && !d.knownForm(c.ListID) {
+				return nil, fmt.Errorf("unknown form type %q", c.ListID)
+			}
+			d.form = c.ListID
+		}
 
-		l := c.Len - 4
-		for l > 0 {
-			sc, err := d.Decode()
+		lr := &io.LimitedReader{R: r, N: int64(c.Len) - 4}
+		d.m.RLock()
+		t, ok := d.transform[c.ListID]
+		d.m.RUnlock()
+		var restore func()
+		if ok {
+			if lr, restore, err = d.transformBody(t, lr, c); err != nil {
+				return nil, err
+			}
+			defer restore()
+		}
+		if d.hint > 0 {
+			n := d.hint
+			if max := int(lr.N / 8); n > max {
+				n = max
+			}
+			c.Chunks = make([]*Chunk, 0, n)
+		}
+		rewrites, clamps, errs := d.rewrites, d.clamps, len(d.errs)
+		filter := d.path != nil && depth < len(d.path)
+		for lr.N > 0 {
+			start := d.r.n
+			if lr.N < 8 {
+				err := fmt.Errorf("%v stray bytes after subchunk #%v", lr.N, len(c.Chunks)-1)
+				if !d.tolerate(start, err) {
+					return nil, err
+				}
+				skip(lr, lr.N)
+				break
+			}
+			if filter {
+				d.want = &d.path[depth]
+			}
+			d.parent = c.ListID
+			sc, err := d.decode(lr, depth+1)
 			if err != nil {
-				return nil, fmt.Errorf("decode subchunk #%v: %v", len(c.Chunks), err)
+				err = fmt.Errorf("decode subchunk #%v: %w", len(c.Chunks), err)
+				if d.stop != nil || !d.tolerate(start, err) {
+					return nil, err
+				}
+				skip(lr, lr.N)
+				break
+			}
+			if sc == nil {
+				continue // skipped by DecodePath
 			}
 			c.Chunks = append(c.Chunks, sc)
-			l = l - 8 - uint32(sc.Len)
+			if c.ID == rf64ID && sc.ID == ds64ID && len(c.Chunks) == 1 {
+				if err := d.applyDS64(c, sc, lr); err != nil {
+					return nil, err
+				}
+			}
+			if filter {
+				// The rest of the container is off the path.
+				if err := skip(lr, lr.N); err != nil {
+					return nil, fmt.Errorf("skip after subchunk #%v: %w", len(c.Chunks)-1, err)
+				}
+			}
+		}
+		if restore != nil {
+			restore()
+		}
+		if c.ID == rf64ID {
+			d.rf64Data = nil
+		}
+		if _, err := d.pad(r, c); err != nil && !d.tolerate(d.r.n, err) {
+			return nil, err
+		}
+		if d.rewrites != rewrites || d.clamps != clamps || len(d.errs) != errs {
+			c.updateLen()
+		}
+
+		d.m.RLock()
+		post, ok := d.listPost[c.ListID]
+		d.m.RUnlock()
+		if ok {
+			if err := post(c); err != nil {
+				err = fmt.Errorf("post-process %q: %v", c.ListID, err)
+				if !d.tolerate(c.Offset, err) {
+					return nil, err
+				}
+			}
+		}
+		if err := d.done(c); err != nil {
+			return nil, err
 		}
+		return c, nil
+	}
 
+	if skipData {
+		if err := skip(r, int64(c.Len)); err != nil {
+			return nil, fmt.Errorf("skip data: %w", err)
+		}
+		if _, err := d.pad(r, c); err != nil {
+			return nil, err
+		}
+		if err := d.done(c); err != nil {
+			return nil, err
+		}
 		return c, nil
 	}
 
 	// Data
-	c.Data = make([]byte, c.Len)
-	n, err := d.r.Read(c.Data)
+	if eof != nil {
+		err = d.readToEOF(r, eof, c)
+	} else {
+		err = d.readData(r, c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.m.RLock()
+	rw, ok := d.rewrite[c.ID]
+	d.m.RUnlock()
+	if ok {
+		data, err := rw(c.Data)
+		if err != nil {
+			err = fmt.Errorf("rewrite %q: %v", c.ID, err)
+			if !d.tolerate(c.Offset, err) {
+				return nil, err
+			}
+			data = c.Data
+		}
+		if l := uint32(len(data)); l != c.Len {
+			c.Len, c.padByte = l, 0
+			d.rewrites++
+		}
+		c.Data = data
+	}
+
+	f, known := d.funcFor(c.ID)
+	if !known {
+		d.m.RLock()
+		f = d.fallback
+		d.m.RUnlock()
+	}
+	if f != nil {
+		if d.MaxContentDecodes > 0 && d.decodes >= d.MaxContentDecodes {
+			d.stop = fmt.Errorf("chunk %q would exceed the limit of %v content decodes", c.ID, d.MaxContentDecodes)
+			return nil, d.stop
+		}
+		d.decodes++
+		d.logf("offset %v: running the DecoderFunc for %q", c.Offset, c.ID)
+		ct, err := d.content(f, c)
+		if err != nil {
+			err = fmt.Errorf("read content: %v", err)
+			if !d.tolerate(c.Offset, err) {
+				return nil, err
+			}
+		}
+		c.Content, c.decoded = ct, known && err == nil
+	}
+	if err := d.done(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DecodeError is an error met by Decode while decoding a chunk, which can
+// be found with errors.As in the errors it returns. When it is met in a
+// subchunk, it is the error of the innermost chunk involved.
+type DecodeError struct {
+	Offset int64 // Offset of the chunk header, as counted by BytesRead
+	ID     ID    // ID of the chunk, zero if its header couldn't be read
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.ID == (ID{}) {
+		return fmt.Sprintf("offset %v: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("offset %v: chunk %q: %v", e.Offset, e.ID, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError returns err, met decoding c nested depth containers deep, as
+// a DecodeError, unless it is the end of the input before a top-level
+// chunk, an error stopping decoding, or already holds a DecodeError for a
+// subchunk of c.
+func (d *Decoder) decodeError(c *Chunk, depth int, err error) error {
+	var de *DecodeError
+	if depth == 0 && err == io.EOF || err == d.stop || errors.As(err, &de) {
+		return err
+	}
+	return &DecodeError{Offset: c.Offset, ID: c.ID, Err: err}
+}
+
+// skipData reports whether the data of leaves with the given ID is skipped
+// because of ReadOnly.
+func (d *Decoder) skipData(id ID) bool {
+	if len(d.ReadOnly) == 0 {
+		return false
+	}
+	for _, o := range d.ReadOnly {
+		if o == id {
+			return false
+		}
+	}
+	return true
+}
+
+// skipChunk skips the rest of the chunk c, of which read bytes following
+// the header have been read from r, and its pad byte.
+func (d *Decoder) skipChunk(r io.Reader, c *Chunk, read int64) error {
+	d.logf("offset %v: skipping %q, off the path decoded", c.Offset, c.ID)
+	if err := skip(r, int64(c.Len)-read); err != nil {
+		return fmt.Errorf("skip %q: %w", c.ID, err)
+	}
+	_, err := d.pad(r, c)
+	return err
+}
+
+// readData reads the data of the leaf c, and the pad byte following it,
+// from r.
+func (d *Decoder) readData(r io.Reader, c *Chunk) error {
+	if d.at != nil && !d.needsData(c.ID) {
+		return d.sectionData(r, c)
+	}
+	if err := d.checkSize(c); err != nil {
+		return fmt.Errorf("read data: %v", err)
+	}
+	if d.src != nil && d.BufferPool == nil {
+		return d.sliceData(r, c)
+	}
+	l := int64(c.Len)
+	if d.r.size > 0 {
+		l = max(min(l, d.r.size-d.r.n), 0)
+	}
+	var n int
+	var err error
+	if d.BufferPool != nil {
+		c.Data = d.BufferPool.Get(int(l))
+		n, err = io.ReadFull(r, c.Data)
+	} else {
+		c.Data, err = d.readFull(r, l)
+		n = len(c.Data)
+	}
+	if err == nil && l < int64(c.Len) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err := fmt.Errorf("read data: chunk %q truncated after %v of %v bytes: %w", c.ID, n, c.Len, io.ErrUnexpectedEOF)
+		if !d.tolerate(c.Offset, err) {
+			return err
+		}
+		c.Data = c.Data[:n]
+		c.clamp(uint32(n))
+	} else if err != nil {
+		return fmt.Errorf("read data: short read of chunk %q, %v of %v bytes: %w", c.ID, n, c.Len, err)
+	} else if c.padByte, err = d.pad(r, c); err != nil {
+		return err
+	}
+	return nil
+}
+
+// chunkHeader reads the header of the chunk c from r, once checked that
+// the context of DecodeContext isn't done.
+func (d *Decoder) chunkHeader(r io.Reader, c *Chunk) (err error) {
+	if d.ctx != nil {
+		if d.stop = d.ctx.Err(); d.stop != nil {
+			return d.stop
+		}
+	}
+	if c.ID, c.Len, err = d.readHeader(r); err != nil {
+		return err
+	}
+	if d.StrictIDs && !printable(c.ID) {
+		return fmt.Errorf("id %q is not printable ASCII", c.ID)
+	}
+	return nil
+}
+
+// overrun returns an error if the data of the chunk c, read from r, goes
+// past the end of the container r reads. The pad byte doesn't count, as it
+// can be left out at the end of a container.
+func overrun(r io.Reader, c *Chunk) error {
+	if lr, ok := r.(*io.LimitedReader); ok && int64(c.Len) > lr.N {
+		return fmt.Errorf("chunk %q of length %v overruns its container by %v bytes", c.ID, c.Len, int64(c.Len)-lr.N)
+	}
+	return nil
+}
+
+// formType reads from r the form type of the container c, nested depth
+// containers deep.
+func (d *Decoder) formType(r io.Reader, c *Chunk, depth int) error {
+	if c.Len < 4 {
+		return fmt.Errorf("container of length %v has no room for a form type", c.Len)
+	}
+	if err := d.checkDepth(depth); err != nil {
+		return err
+	}
+	if _, err := c.ListID.ReadFrom(r); err != nil {
+		return err
+	}
+	if d.StrictIDs && !printable(c.ListID) {
+		return fmt.Errorf("form type %q is not printable ASCII", c.ListID)
+	}
+	return nil
+}
+
+// readStep is the size of the buffers readFull starts with when the size of
+// the stream is unknown.
+const readStep = 64 << 10
+
+// readFull reads n bytes from r as io.ReadFull does, and returns those read
+// before an error. Unless the size of the stream is known, which bounds n,
+// the buffer grows as data arrives instead of being allocated up front, so
+// that the length of a corrupt or truncated chunk only costs the bytes
+// actually there.
+func (d *Decoder) readFull(r io.Reader, n int64) ([]byte, error) {
+	if d.r.size > 0 || n <= readStep {
+		b := make([]byte, n)
+		m, err := io.ReadFull(r, b)
+		return b[:m], err
+	}
+	var buf bytes.Buffer
+	buf.Grow(readStep)
+	m, err := io.CopyN(&buf, r, n)
+	if err == io.EOF && m > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
+// checkDepth checks that a container nested depth containers deep doesn't
+// exceed MaxDepth.
+func (d *Decoder) checkDepth(depth int) error {
+	if d.MaxDepth > 0 && depth >= d.MaxDepth {
+		return fmt.Errorf("nesting depth exceeded: more than %v containers nested in one another", d.MaxDepth)
+	}
+	return nil
+}
+
+// checkSize checks the length of the leaf c against MaxChunkSize.
+func (d *Decoder) checkSize(c *Chunk) error {
+	if d.MaxChunkSize > 0 && c.Len > d.MaxChunkSize {
+		return fmt.Errorf("chunk %q of length %v exceeds the limit of %v bytes", c.ID, c.Len, d.MaxChunkSize)
+	}
+	return nil
+}
+
+// untilEOF returns the reader the containers read by r are read from, if a
+// leaf of length l read from r is the last chunk of all of them and its
+// length is 0 or overruns them, so that its data can be read until the end
+// of the stream. It returns nil otherwise.
+func untilEOF(r io.Reader, l uint32) io.Reader {
+	var outer *io.LimitedReader
+	for {
+		lr, ok := r.(*io.LimitedReader)
+		if !ok {
+			break
+		}
+		outer, r = lr, lr.R
+	}
+	if outer != nil && (l == 0 && outer.N == 0 || int64(l) > outer.N) {
+		return r
+	}
+	return nil
+}
+
+// readToEOF reads the data of the leaf c, read from r, until the end of
+// src, as returned by untilEOF, and sets its length accordingly. The
+// containers read by r are left with nothing to read. No more than
+// MaxChunkSize bytes are read, nor more than a chunk length can hold.
+func (d *Decoder) readToEOF(r, src io.Reader, c *Chunk) error {
+	limit := int64(math.MaxUint32)
+	if d.MaxChunkSize > 0 {
+		limit = int64(d.MaxChunkSize)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(src, limit+1))
 	if err != nil {
-		return nil, fmt.Errorf("read data: %v", err)
+		return fmt.Errorf("read data of %q until EOF: %w", c.ID, err)
 	}
-	if n != int(c.Len) {
-		return nil, fmt.Errorf("couldn't read all data, read %v bytes of %v", n, c.Len)
+	if int64(len(data)) > limit {
+		return fmt.Errorf("data of %q read until EOF exceeds the limit of %v bytes", c.ID, limit)
 	}
+	for lr, ok := r.(*io.LimitedReader); ok; lr, ok = lr.R.(*io.LimitedReader) {
+		lr.N = 0
+	}
+	if l := uint32(len(data)); l != c.Len {
+		c.Len = l
+		d.rewrites++
+	}
+	c.Data = data
+	return nil
+}
 
-	// Pad
-	if c.Len%2 != 0 {
-		b := make([]byte, 1)
-		d.r.Read(b)
+// content runs f on the data of c, within d.ContentTimeout if set.
+func (d *Decoder) content(f DecoderFunc, c *Chunk) (interface{}, error) {
+	info := ChunkInfo{ID: c.ID, Len: c.Len, ListID: d.parent}
+	if d.ContentTimeout <= 0 {
+		return d.call(f, c, info)
 	}
+	type result struct {
+		v   interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("DecoderFunc panicked: %v", r)}
+			}
+		}()
+		v, err := d.call(f, c, info)
+		done <- result{v, err}
+	}()
+	t := time.NewTimer(d.ContentTimeout)
+	defer t.Stop()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-t.C:
+		return nil, fmt.Errorf("DecoderFunc for %q didn't return within %v", c.ID, d.ContentTimeout)
+	}
+}
+
+// call runs f on the data of c, described by info, checking that it read
+// all of it if d.StrictFuncConsumption is set.
+func (d *Decoder) call(f DecoderFunc, c *Chunk, info ChunkInfo) (interface{}, error) {
+	r := &infoReader{bytes.NewReader(c.Data), info}
+	v, err := f(r)
+	if err == nil && d.StrictFuncConsumption && r.Len() > 0 {
+		return v, fmt.Errorf("DecoderFunc for %q left %v of its %v bytes unread", c.ID, r.Len(), len(c.Data))
+	}
+	return v, err
+}
+
+// ReadHeader reads the ID and length of the next chunk, leaving the reader
+// positioned at its payload, or at its form type for containers. It is the
+// building block for custom parsers that don't need Decode to read the
+// whole chunk. It returns io.EOF if the reader has no more data.
+func (d *Decoder) ReadHeader() (id ID, length uint32, err error) {
+	return d.readHeader(d.r)
+}
+
+func (d *Decoder) readHeader(r io.Reader) (id ID, length uint32, err error) {
+	if n, err := id.ReadFrom(r); err != nil {
+		if n == 0 && err == io.EOF {
+			return id, 0, io.EOF
+		}
+		return id, 0, fmt.Errorf("read id: %w", err)
+	}
+	if id == riff || id == rifx {
+		d.bigEndian = id == rifx
+	}
+	if length, err = d.readUint32(r); err != nil {
+		return id, 0, fmt.Errorf("read length: %w", err)
+	}
+	return id, length, nil
+}
+
+// readUint32 reads a little endian uint32 from r.
+func (d *Decoder) readUint32(r io.Reader) (uint32, error) {
+	if _, err := io.ReadFull(r, d.buf[:]); err != nil {
+		return 0, err
+	}
+	if d.bigEndian {
+		return binary.BigEndian.Uint32(d.buf[:]), nil
+	}
+	return binary.LittleEndian.Uint32(d.buf[:]), nil
+}
 
+// done runs the verifier registered for c, if any, and reports to
+// d.Progress that c has been read.
+func (d *Decoder) done(c *Chunk) error {
 	d.m.RLock()
-	f, ok := d.funcs[c.ID]
+	f, ok := d.verify[c.ID]
 	d.m.RUnlock()
 	if ok {
-		ct, err := f(bytes.NewReader(c.Data))
-		if err != nil {
-			return nil, fmt.Errorf("read content: %v", err)
+		if err := f(c); err != nil {
+			err = fmt.Errorf("verify %q: %v", c.ID, err)
+			if !d.tolerate(c.Offset, err) {
+				return err
+			}
 		}
-		c.Content = ct
 	}
-	return c, nil
+
+	if d.Progress == nil {
+		return nil
+	}
+	if err := d.Progress(c.ID, d.r.n); err != nil {
+		d.stop = err
+		return err
+	}
+	return nil
+}
+
+// pad reads the pad byte following the odd-length chunk c from r and
+// returns it. An odd-length chunk ending its container doesn't need to be
+// followed by a pad byte when the container itself is padded instead, so
+// nothing is read if there is no room left for it in the container, nor if
+// the stream ends right after a top-level chunk.
+func (d *Decoder) pad(r io.Reader, c *Chunk) (byte, error) {
+	if c.Len%2 == 0 || d.Unpadded {
+		return 0, nil
+	}
+	if lr, ok := r.(*io.LimitedReader); ok && lr.N == 0 {
+		return 0, nil
+	}
+	if _, err := io.ReadFull(r, d.buf[:1]); err != nil {
+		if err == io.EOF && r == io.Reader(d.r) {
+			return 0, nil // the stream ends with an unpadded chunk
+		}
+		return 0, fmt.Errorf("read pad: %w", err)
+	}
+	return d.buf[0], nil
+}
+
+// knownForm reports whether form is accepted as a top-level form type.
+func (d *Decoder) knownForm(form ID) bool {
+	if len(d.KnownForms) == 0 {
+		return true
+	}
+	for _, f := range d.KnownForms {
+		if f == form {
+			return true
+		}
+	}
+	return false
+}
+
+// reader counts the bytes read from r.
+type reader struct {
+	r    io.Reader
+	n    int64
+	size int64 // size of the stream, if known, which lets skip seek
+}
+
+// setSize sets the size of the stream from s, the reader of r.
+func (r *reader) setSize(s io.Seeker) error {
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return err
+	}
+	r.size = r.n + end - cur
+	return nil
+}
+
+// maxEmptyReads is the number of consecutive reads returning neither data
+// nor an error after which the underlying reader is considered broken.
+const maxEmptyReads = 100
+
+// Read reads from the underlying reader, failing with io.ErrNoProgress
+// rather than spinning forever if it keeps returning (0, nil).
+func (r *reader) Read(p []byte) (int, error) {
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := r.r.Read(p)
+		r.n += int64(n)
+		if n > 0 || err != nil || len(p) == 0 {
+			return n, err
+		}
+	}
+	return 0, io.ErrNoProgress
+}
+
+// skip discards the next n bytes of r, seeking past them if the reader
+// underlying r is an io.Seeker. The limits of any io.LimitedReader in
+// between are honored.
+func skip(r io.Reader, n int64) error {
+	switch r := r.(type) {
+	case *io.LimitedReader:
+		if n > r.N {
+			if err := skip(r.R, r.N); err != nil {
+				return err
+			}
+			r.N = 0
+			return io.ErrUnexpectedEOF
+		}
+		r.N -= n
+		return skip(r.R, n)
+	case *reader:
+		if s, ok := r.r.(io.Seeker); ok && r.size > 0 {
+			if r.n+n > r.size {
+				return io.ErrUnexpectedEOF
+			}
+			if _, err := s.Seek(n, io.SeekCurrent); err != nil {
+				return err
+			}
+			r.n += n
+			return nil
+		}
+	}
+	m, err := io.CopyN(io.Discard, r, n)
+	if err == io.EOF && m < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
 }
 
 type writer struct {
-	w   io.Writer
-	err error
-	n   int64
+	w         io.Writer
+	ctx       context.Context // checked before every chunk, if not nil
+	err       error
+	n         int64
+	buf       [4]byte
+	bigEndian bool // write lengths in big endian, in RIFX trees
+	unpadded  bool // write no pad bytes
 }
 
+// Write writes all of p to the underlying writer, calling it again as long
+// as it makes progress without failing if it accepts only part of p.
 func (w *writer) Write(p []byte) (int, error) {
 	if w.err != nil {
 		return 0, w.err
 	}
-	n, err := w.w.Write(p)
-	w.n, w.err = w.n+int64(n), err
-	return n, err
+	total := 0
+	for total < len(p) {
+		n, err := w.w.Write(p[total:])
+		total += n
+		w.n += int64(n)
+		if err == nil && n == 0 {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			w.err = err
+			break
+		}
+	}
+	return total, w.err
 }
 
-// WriteTo writes the content of the Chunk into the given writer.
+// writeUint32 writes v in little endian byte order, or big endian in RIFX
+// trees.
+func (w *writer) writeUint32(v uint32) {
+	if w.bigEndian {
+		binary.BigEndian.PutUint32(w.buf[:], v)
+	} else {
+		binary.LittleEndian.PutUint32(w.buf[:], v)
+	}
+	w.Write(w.buf[:])
+}
+
+// WriteTo writes the content of the Chunk into the given writer. The output
+// only depends on the IDs, lengths and form types of the chunks, the order
+// of the Chunks slices and the Data of leaves, never on their Content, so
+// the same tree is always written identically. Pad bytes are written back
+// as decoded, and as zero for chunks built in memory. A tree where a chunk
+// contains itself, or where the Len of a leaf isn't the length of its data,
+// as when its data was edited without calling UpdateLengths, is an error,
+// and nothing is written.
+//
+// Unless w is already buffered, like a bufio.Writer or a bytes.Buffer, or
+// has a Flush method, writes are buffered so that w isn't called for every
+// ID and length. The count returned is that of the bytes accepted by w.
 func (c *Chunk) WriteTo(w io.Writer) (int64, error) {
-	wr := &writer{w: w}
+	return c.write(nil, w, true)
+}
 
-	wr.Write(c.ID[:])
-	binary.Write(wr, binary.LittleEndian, c.Len)
+// WriteToExpecting is like WriteTo, but fails unless exactly expected bytes
+// are written, as a safety net for code writing back a file of known size.
+// The size of the tree is checked before anything is written, and the
+// count of bytes written once they are.
+func (c *Chunk) WriteToExpecting(w io.Writer, expected int64) (int64, error) {
+	if _, err := c.MaxDepth(); err != nil {
+		return 0, err
+	}
+	if n := c.size(); n != expected {
+		return 0, fmt.Errorf("tree of %v bytes, expected %v", n, expected)
+	}
+	n, err := c.WriteTo(w)
+	if err == nil && n != expected {
+		err = fmt.Errorf("wrote %v bytes, expected %v", n, expected)
+	}
+	return n, err
+}
 
-	if c.ID == riff || c.ID == list {
-		wr.Write(c.ListID[:])
-		for i := 0; wr.err == nil && i < len(c.Chunks); i++ {
-			c.Chunks[i].WriteTo(wr)
-		}
+// Bytes returns the tree rooted at c as written by WriteTo, in a slice
+// allocated at its final size.
+func (c *Chunk) Bytes() ([]byte, error) {
+	if _, err := c.MaxDepth(); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, c.size()))
+	if _, err := c.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Size returns the number of bytes WriteTo writes for c, without writing
+// anything: its header, the form type and subchunks of containers, or the
+// data and pad byte of leaves, so that a buffer can be allocated up front.
+// A tree where a chunk contains itself can't be written, and its size is
+// -1.
+func (c *Chunk) Size() int64 {
+	if _, err := c.MaxDepth(); err != nil {
+		return -1
+	}
+	return c.size()
+}
+
+func (c *Chunk) size() int64 {
+	if !c.IsContainer() {
+		return 8 + c.dataLen() + int64(c.Len%2)
+	}
+	n := int64(12)
+	for _, sc := range c.Chunks {
+		n += sc.size()
+	}
+	return n
+}
+
+// WriteToContext is like WriteTo, but stops with the error of ctx if it is
+// done before a chunk is written. A write to w that blocks is not
+// interrupted, so w should itself fail once ctx is done, as the response
+// writer of a disconnected HTTP client does.
+func (c *Chunk) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	return c.write(ctx, w, true)
+}
+
+// writeBufferSize is the size of the buffer used by WriteTo for unbuffered
+// writers.
+const writeBufferSize = 32 << 10
+
+// write writes c to w, checking ctx before every chunk if it isn't nil, and
+// writing pad bytes if pad is set.
+func (c *Chunk) write(ctx context.Context, w io.Writer, pad bool) (int64, error) {
+	if _, err := c.MaxDepth(); err != nil {
+		return 0, err
+	}
+	if err := c.checkLeafLengths(); err != nil {
+		return 0, err
+	}
+	if buffered(w) {
+		wr := &writer{w: w, ctx: ctx, unpadded: !pad}
+		c.writeTo(wr)
 		return wr.n, wr.err
 	}
+	out := &writer{w: w}
+	bw := bufio.NewWriterSize(out, writeBufferSize)
+	wr := &writer{w: bw, ctx: ctx, unpadded: !pad}
+	c.writeTo(wr)
+	if err := bw.Flush(); wr.err == nil {
+		wr.err = err
+	}
+	return out.n, wr.err
+}
+
+// checkLeafLengths checks that every leaf of the tree rooted at c holds as
+// many bytes of data as its Len declares.
+func (c *Chunk) checkLeafLengths() error {
+	if !c.IsContainer() {
+		if n := c.dataLen(); n != int64(c.Len) {
+			return fmt.Errorf("chunk %q of length %v holds %v bytes of data", c.ID, c.Len, n)
+		}
+		return nil
+	}
+	for _, sc := range c.Chunks {
+		if err := sc.checkLeafLengths(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buffered reports whether w buffers what is written to it.
+func buffered(w io.Writer) bool {
+	switch w.(type) {
+	case interface{ Available() int }, interface{ Flush() error }, interface{ Flush() }:
+		return true
+	}
+	return false
+}
+
+func (c *Chunk) writeTo(w *writer) {
+	if w.ctx != nil && w.err == nil {
+		w.err = w.ctx.Err()
+	}
+	if c.ID == riff || c.ID == rifx {
+		w.bigEndian = c.ID == rifx
+	}
+	w.Write(c.ID[:])
+	w.writeUint32(c.Len)
 
-	wr.Write(c.Data)
-	if c.Len%2 != 0 {
-		w.Write([]byte{'0'})
+	if c.IsContainer() {
+		w.Write(c.ListID[:])
+		for i := 0; w.err == nil && i < len(c.Chunks); i++ {
+			c.Chunks[i].writeTo(w)
+		}
+		return
+	}
+
+	c.writeData(w)
+	if c.Len%2 != 0 && !w.unpadded {
+		w.buf[0] = c.padByte
+		w.Write(w.buf[:1])
+	}
+}
+
+// writeData writes the data of the leaf c, read from its section if it has
+// one.
+func (c *Chunk) writeData(w *writer) {
+	if c.section == nil {
+		w.Write(c.Data)
+		return
+	}
+	if w.err != nil {
+		return
+	}
+	n, err := io.Copy(w, io.NewSectionReader(c.section, 0, c.section.Size()))
+	if err == nil && n < c.section.Size() {
+		err = fmt.Errorf("section of chunk %q ended after %v of %v bytes: %w", c.ID, n, c.section.Size(), io.ErrUnexpectedEOF)
+	}
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// dataLen returns the length of the data of the leaf c.
+func (c *Chunk) dataLen() int64 {
+	if c.section != nil {
+		return c.section.Size()
+	}
+	return int64(len(c.Data))
+}
+
+// loadedData returns the data of the leaf c, read into a new slice from
+// its section if it has one, or an error if its data isn't loaded.
+func (c *Chunk) loadedData() ([]byte, error) {
+	if c.section == nil && c.loaded() {
+		return c.Data, nil
 	}
+	b := make([]byte, c.dataLen())
+	if _, err := c.ReadDataInto(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// loaded reports whether the data of the leaf c is held in Data or in a
+// section, unlike that of leaves decoded by DecodeStructure or skipped
+// because of ReadOnly.
+func (c *Chunk) loaded() bool {
+	return c.Data != nil || c.section != nil || c.Len == 0
+}
+
+// SectionChunk returns a leaf chunk whose data is the n bytes at offset off
+// of r, such as the samples of another file, which WriteTo and CopyData
+// then copy from r instead of holding them in memory. The chunk has no
+// Data, and its Len is n.
+func SectionChunk(id ID, r io.ReaderAt, off, n int64) *Chunk {
+	return &Chunk{ID: id, Len: uint32(n), section: io.NewSectionReader(r, off, n)}
+}
+
+// Open returns a reader over the data of the leaf chunk c, read on demand
+// from its section for chunks decoded by a decoder returned by
+// NewReaderAtDecoder or created by SectionChunk.
+func (c *Chunk) Open() (*io.SectionReader, error) {
+	if c.IsContainer() {
+		return nil, fmt.Errorf("container %q has no data of its own", c.ID)
+	}
+	if c.section != nil {
+		return io.NewSectionReader(c.section, 0, c.section.Size()), nil
+	}
+	if !c.loaded() {
+		return nil, fmt.Errorf("chunk %q has no data loaded", c.ID)
+	}
+	return io.NewSectionReader(bytes.NewReader(c.Data), 0, int64(len(c.Data))), nil
+}
+
+// CopyData writes the data of the leaf chunk c to w, without its header nor
+// pad byte, as when extracting the samples of a WAV file to a raw file.
+func (c *Chunk) CopyData(w io.Writer) (int64, error) {
+	if c.IsContainer() {
+		return 0, fmt.Errorf("container %q has no data of its own", c.ID)
+	}
+	wr := &writer{w: w}
+	c.writeData(wr)
 	return wr.n, wr.err
 }
 
+// ReadDataInto copies the data of the leaf chunk c into dst, reading it from
+// its section for chunks created by SectionChunk, and returns its length.
+// It allocates nothing, so that a single buffer can be reused through a
+// loop over many chunks whose data is consumed right away. dst must be at
+// least c.Len bytes long.
+func (c *Chunk) ReadDataInto(dst []byte) (int, error) {
+	if c.IsContainer() {
+		return 0, fmt.Errorf("container %q has no data of its own", c.ID)
+	}
+	n := c.dataLen()
+	if !c.loaded() {
+		return 0, fmt.Errorf("chunk %q has no data loaded", c.ID)
+	}
+	if int64(len(dst)) < n {
+		return 0, fmt.Errorf("buffer of %v bytes too small for the %v bytes of chunk %q", len(dst), n, c.ID)
+	}
+	if c.section == nil {
+		return copy(dst, c.Data), nil
+	}
+	m, err := c.section.ReadAt(dst[:n], 0)
+	if err == io.EOF && int64(m) < n {
+		err = fmt.Errorf("section of chunk %q ended after %v of %v bytes: %w", c.ID, m, n, io.ErrUnexpectedEOF)
+	} else if int64(m) == n {
+		err = nil
+	}
+	return m, err
+}
+
+// Frames returns an iterator over the data of the leaf chunk c in frames of
+// size bytes, such as blocks of samples to feed to an audio encoder. Every
+// call returns the next frame, the last one being shorter if the data isn't
+// a whole number of frames, and then io.EOF. Frames are slices of Data, or
+// for chunks created by SectionChunk are read from their section into a
+// buffer reused by every call, so that the data is never held in memory at
+// once, in which case a frame is only valid until the next call.
+func (c *Chunk) Frames(size int) func() ([]byte, error) {
+	var err error
+	if c.IsContainer() {
+		err = fmt.Errorf("container %q has no data of its own", c.ID)
+	} else if size <= 0 {
+		err = fmt.Errorf("invalid frame size %v", size)
+	}
+	var off int64
+	var buf []byte
+	return func() ([]byte, error) {
+		if err != nil {
+			return nil, err
+		}
+		n := c.dataLen() - off
+		if n <= 0 {
+			return nil, io.EOF
+		}
+		n = min(n, int64(size))
+		if c.section == nil {
+			b := c.Data[off : off+n]
+			off += n
+			return b, nil
+		}
+		if buf == nil {
+			buf = make([]byte, size)
+		}
+		m, rerr := c.section.ReadAt(buf[:n], off)
+		if int64(m) < n {
+			if rerr == nil || rerr == io.EOF {
+				rerr = io.ErrUnexpectedEOF
+			}
+			err = fmt.Errorf("section of chunk %q ended after %v of %v bytes: %w", c.ID, off+int64(m), c.dataLen(), rerr)
+			return nil, err
+		}
+		off += n
+		return buf[:n], nil
+	}
+}
+
 // ID represents a RIFF identifier
 type ID [4]byte
 
@@ -166,19 +1809,36 @@ func NewID(s string) ID {
 	return [4]byte{s[0], s[1], s[2], s[3]}
 }
 
+// TryNewID returns the ID given by the 4 characters of s, like NewID, but
+// returns an error instead of panicking if s doesn't have 4 bytes, or if
+// any of them is not printable ASCII, from 0x20 to 0x7e, as required by
+// the RIFF spec.
+func TryNewID(s string) (ID, error) {
+	if len(s) != 4 {
+		return ID{}, fmt.Errorf("id %q has %v bytes, expected 4", s, len(s))
+	}
+	id := NewID(s)
+	if !printable(id) {
+		return ID{}, fmt.Errorf("id %q is not printable ASCII", s)
+	}
+	return id, nil
+}
+
 // String returns the string representation of the ID.
-func (id *ID) String() string {
-	return fmt.Sprintf("%s", id)
+func (id ID) String() string {
+	return string(id[:])
+}
+
+// Compare returns -1, 0 or 1 as id sorts before, equal to or after o,
+// comparing their bytes as unsigned values from first to last. It doesn't
+// depend on the bytes being printable, so "LIST" sorts before "data" and
+// both sort before IDs holding bytes above 0x7f.
+func (id ID) Compare(o ID) int {
+	return bytes.Compare(id[:], o[:])
 }
 
 // ReadFrom reads an ID from the given reader.
-func (id *ID) ReadFrom(r io.Reader) error {
-	n, err := r.Read(id[:])
-	if err != nil {
-		return err
-	}
-	if n != 4 {
-		return fmt.Errorf("couldn't read identifier, read %v bytes", n)
-	}
-	return nil
+func (id *ID) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.ReadFull(r, id[:])
+	return int64(n), err
 }
@@ -2,10 +2,18 @@ package riff
 
 import (
 	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func compare(t *testing.T, a, b *Chunk) {
@@ -77,7 +85,7 @@ func TestWriter(t *testing.T) {
 	buf := new(bytes.Buffer)
 	_, err = c.WriteTo(buf)
 	if err != nil {
-		t.Errorf("WriteTo: ", err)
+		t.Errorf("WriteTo: %v", err)
 	}
 
 	fAll, err := ioutil.ReadAll(f)
@@ -117,3 +125,2044 @@ func TestFuncs(t *testing.T) {
 		t.Errorf("The function was not called")
 	}
 }
+
+// leafBytes returns the serialized form of a leaf chunk, including its pad byte.
+func leafBytes(id string, data []byte) []byte {
+	b := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// listBytes returns the serialized form of a container chunk holding the
+// given serialized children.
+func listBytes(id, form string, children ...[]byte) []byte {
+	body := []byte(form)
+	for _, c := range children {
+		body = append(body, c...)
+	}
+	b := append([]byte(id), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(body)))
+	return append(b, body...)
+}
+
+// assertRoundTrip decodes the file at path, encodes it back with WriteTo
+// and checks that the result is byte for byte identical to the original,
+// pad bytes included, with nothing missing or left over.
+func assertRoundTrip(t *testing.T, path string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %v: %v", path, err)
+	}
+
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("decode %v: %v", path, err)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := c.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("encode %v: %v", path, err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("%v: WriteTo reported %v bytes, wrote %v", path, n, buf.Len())
+	}
+
+	got := buf.Bytes()
+	for i := 0; i < len(b) && i < len(got); i++ {
+		if b[i] != got[i] {
+			t.Fatalf("%v: byte at offset %v is %#x, expected %#x", path, i, got[i], b[i])
+		}
+	}
+	if len(got) != len(b) {
+		t.Errorf("%v: encoded %v bytes, expected %v", path, len(got), len(b))
+	}
+
+	bs, err := c.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes %v: %v", path, err)
+	}
+	if !bytes.Equal(bs, got) || cap(bs) != len(bs) {
+		t.Errorf("%v: Bytes returned %v bytes with capacity %v, differing from WriteTo", path, len(bs), cap(bs))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, path := range []string{"data/hand.wav", "data/odd.wav"} {
+		assertRoundTrip(t, path)
+	}
+}
+
+func TestHintChunks(t *testing.T) {
+	b := manyChunks(100)
+	d := NewDecoder(bytes.NewReader(b))
+	d.HintChunks(1 << 20)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(c.Chunks) != 100 {
+		t.Errorf("decoded %v chunks, expected 100", len(c.Chunks))
+	}
+	if max := int(c.Len-4) / 8; cap(c.Chunks) > max {
+		t.Errorf("capacity %v is larger than the %v chunks that fit", cap(c.Chunks), max)
+	}
+}
+
+// manyChunks returns a RIFF file holding n small leaf chunks.
+func manyChunks(n int) []byte {
+	var chunks [][]byte
+	for i := 0; i < n; i++ {
+		chunks = append(chunks, leafBytes("00dc", []byte{byte(i), byte(i >> 8)}))
+	}
+	return listBytes("RIFF", "AVI ", chunks...)
+}
+
+func benchmarkDecode(b *testing.B, hint int) {
+	data := manyChunks(10000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(bytes.NewReader(data))
+		d.HintChunks(hint)
+		if _, err := d.Decode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeManyChunks(b *testing.B)       { benchmarkDecode(b, 0) }
+func BenchmarkDecodeManyChunksHinted(b *testing.B) { benchmarkDecode(b, 10000) }
+
+func TestKnownForms(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+
+	tests := []struct {
+		forms []ID
+		ok    bool
+	}{
+		{nil, true},
+		{[]ID{NewID("WAVE")}, true},
+		{[]ID{NewID("AVI "), NewID("WAVE")}, true},
+		{[]ID{NewID("AVI "), NewID("WEBP")}, false},
+	}
+	for _, test := range tests {
+		d := NewDecoder(bytes.NewReader(b))
+		d.KnownForms = test.forms
+		_, err := d.Decode()
+		if test.ok && err != nil {
+			t.Errorf("forms %q: unexpected error: %v", test.forms, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("forms %q: expected error", test.forms)
+		}
+	}
+}
+
+func TestIsContainer(t *testing.T) {
+	tests := map[string]bool{
+		"RIFF": true,
+		"RIFX": true,
+		"LIST": true,
+		"list": false,
+		"fmt ": false,
+		"data": false,
+	}
+	for id, exp := range tests {
+		c := &Chunk{ID: NewID(id)}
+		if got := c.IsContainer(); got != exp {
+			t.Errorf("%q.IsContainer() = %v, expected %v", id, got, exp)
+		}
+	}
+}
+
+func TestChildConfinedToParent(t *testing.T) {
+	b := listBytes("RIFF", "TEST",
+		listBytes("LIST", "INFO", leafBytes("ISFT", []byte("riff"))),
+		leafBytes("data", []byte("sibling data")),
+	)
+	// Make ISFT claim the bytes of the following data chunk.
+	b[28] = 12
+	_, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err == nil || !strings.Contains(err.Error(), "overruns its container by 8 bytes") {
+		t.Errorf("expected overrun error, got %v", err)
+	}
+}
+
+func TestFindChunk(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+	c, err := NewDecoder(f).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if got := c.FindChunk(); got != c {
+		t.Errorf("empty path: got %v, expected the root", got)
+	}
+	if got := c.FindChunk(NewID("data")); got == nil || got.Len != 7800 {
+		t.Errorf("data: got %v", got)
+	}
+	if got := c.FindChunk(NewID("INFO"), NewID("ISFT")); got == nil || got.Len != 62 {
+		t.Errorf("INFO/ISFT: got %v", got)
+	}
+	if got := c.FindChunk(NewID("LIST"), NewID("ISFT")); got == nil || got.Len != 62 {
+		t.Errorf("LIST/ISFT: got %v", got)
+	}
+	if got := c.FindChunk(NewID("INFO"), NewID("INAM")); got != nil {
+		t.Errorf("INFO/INAM: got %v, expected nil", got)
+	}
+}
+
+func TestRIFXRoundTrip(t *testing.T) {
+	b := []byte("RIFX\x00\x00\x00\x26TEST" +
+		"odd \x00\x00\x00\x03abc\x00" +
+		"LIST\x00\x00\x00\x0eINFOINAM\x00\x00\x00\x02hi")
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if c.Len != 0x26 || c.Chunks[0].Len != 3 || c.Chunks[1].Len != 14 || string(c.Chunks[1].Chunks[0].Data) != "hi" {
+		t.Errorf("got %v", c)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil || !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("written back as %q, %v; expected %q", buf.Bytes(), err, b)
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	rifx := BuildRIFX(NewID("TEST"), ChunkSpec{ID: "abcd", Data: []byte{1}})
+	d := NewDecoder(bytes.NewReader(rifx))
+	d.Tolerant = true
+	d.Map(NewID("fmt "), WaveFmtDecoder)
+	if _, err := d.Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	for _, path := range []string{"data/hand.wav", "data/odd.wav"} {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read test file: %v", err)
+		}
+		d.Reset(bytes.NewReader(b))
+		if n := d.BytesRead(); n != 0 {
+			t.Errorf("%v: read %v bytes after Reset", path, n)
+		}
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("%v: Decode: %v", path, err)
+		}
+		if _, ok := c.FindChunk(NewID("fmt ")).Content.(WaveFmt); !ok {
+			t.Errorf("%v: DecoderFunc lost by Reset", path)
+		}
+		if n := d.BytesRead(); n != int64(len(b)) {
+			t.Errorf("%v: read %v bytes, expected %v", path, n, len(b))
+		}
+		if !d.Tolerant {
+			t.Errorf("%v: option lost by Reset", path)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	if got, err := c.At(); got != c || err != nil {
+		t.Errorf("empty path: got %v, %v; expected the root", got, err)
+	}
+	if got, err := c.At(3, 0); err != nil || got.ID != NewID("ISFT") {
+		t.Errorf("3, 0: got %v, %v; expected ISFT", got, err)
+	}
+	for _, path := range [][]int{{4}, {-1}, {3, 1}, {0, 0}} {
+		if got, err := c.At(path...); err == nil {
+			t.Errorf("%v: got %v, expected error", path, got)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+
+	type event struct {
+		id ID
+		n  int64
+	}
+	var got []event
+	d := NewDecoder(f)
+	d.Progress = func(id ID, n int64) error {
+		got = append(got, event{id, n})
+		return nil
+	}
+	if _, err := d.Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	exp := []event{
+		{NewID("fmt "), 50},
+		{NewID("fact"), 62},
+		{NewID("data"), 7870},
+		{NewID("ISFT"), 7952},
+		{NewID("LIST"), 7952},
+		{NewID("RIFF"), 7952},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got events %v, expected %v", got, exp)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	d = NewDecoder(f)
+	d.Progress = func(id ID, n int64) error {
+		calls++
+		if id == NewID("fact") {
+			return stop
+		}
+		return nil
+	}
+	if _, err := d.Decode(); err != stop {
+		t.Errorf("expected Decode to return the callback error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("callback called %v times, expected 2", calls)
+	}
+}
+
+func BenchmarkWriteManyChunks(b *testing.B) {
+	c, err := NewDecoder(bytes.NewReader(manyChunks(10000))).Decode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if _, err := c.WriteTo(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMapListPost(t *testing.T) {
+	ltxtData := func(cue byte) []byte {
+		return []byte{cue, 0, 0, 0, 10, 0, 0, 0, 'r', 'g', 'n', ' ', 0, 0, 0, 0, 0, 0, 0, 0}
+	}
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("cue ", []byte{0, 0, 0, 0}),
+		listBytes("LIST", "adtl",
+			leafBytes("ltxt", ltxtData(1)),
+			leafBytes("ltxt", ltxtData(2)),
+		),
+	)
+	var events []string
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(NewID("ltxt"), LtxtDecoder)
+	d.MapListPost(NewID("adtl"), func(c *Chunk) error {
+		var cues []uint32
+		for _, sc := range c.Chunks {
+			cues = append(cues, sc.Content.(LabeledText).CuePointID)
+		}
+		c.Content = cues
+		events = append(events, "post")
+		return nil
+	})
+	d.MapVerify(NewID("LIST"), func(*Chunk) error {
+		events = append(events, "verify")
+		return nil
+	})
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := c.FindChunk(NewID("adtl")).Content; !reflect.DeepEqual(got, []uint32{1, 2}) {
+		t.Errorf("got Content %v, expected the cue points of the labels", got)
+	}
+	if exp := []string{"post", "verify"}; !reflect.DeepEqual(events, exp) {
+		t.Errorf("got calls %v, expected %v", events, exp)
+	}
+
+	d = NewDecoder(bytes.NewReader(b))
+	d.MapListPost(NewID("adtl"), func(*Chunk) error { return errors.New("bad") })
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected the post-processing error")
+	}
+	d = NewDecoder(bytes.NewReader(b))
+	d.Tolerant = true
+	d.MapListPost(NewID("adtl"), func(*Chunk) error { return errors.New("bad") })
+	if _, err := d.Decode(); err != nil || len(d.Errors()) != 1 {
+		t.Errorf("tolerant: got %v, errors %v", err, d.Errors())
+	}
+}
+
+func TestMapVerify(t *testing.T) {
+	sum := func(b []byte) byte {
+		var s byte
+		for _, v := range b {
+			s += v
+		}
+		return s
+	}
+	file := func(crc byte) []byte {
+		data := []byte("some payload")
+		return listBytes("RIFF", "TEST",
+			listBytes("LIST", "blck",
+				leafBytes("data", data),
+				leafBytes("crc ", []byte{sum(data) + crc, 0}),
+			),
+		)
+	}
+	verify := func(c *Chunk) error {
+		data, crc := c.FindChunk(NewID("data")), c.FindChunk(NewID("crc "))
+		if data == nil || crc == nil {
+			return fmt.Errorf("missing data or crc")
+		}
+		if sum(data.Data) != crc.Data[0] {
+			return fmt.Errorf("bad checksum")
+		}
+		return nil
+	}
+
+	for _, test := range []struct {
+		crc byte
+		ok  bool
+	}{{0, true}, {1, false}} {
+		d := NewDecoder(bytes.NewReader(file(test.crc)))
+		d.MapVerify(NewID("LIST"), verify)
+		_, err := d.Decode()
+		if test.ok && err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !test.ok && (err == nil || !strings.Contains(err.Error(), "bad checksum")) {
+			t.Errorf("expected checksum error, got %v", err)
+		}
+	}
+}
+
+func TestPadBytePreserved(t *testing.T) {
+	b := listBytes("RIFF", "TEST", leafBytes("odd ", []byte("abc")), leafBytes("next", nil))
+	b[12+8+3] = 0xaa
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), b)
+	}
+
+	buf.Reset()
+	c = &Chunk{ID: NewID("odd "), Len: 1, Data: []byte{'a'}}
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if exp := []byte("odd \x01\x00\x00\x00a\x00"); !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), exp)
+	}
+
+	// A writer failing on the pad byte fails WriteTo.
+	if n, err := c.WriteTo(&callWriter{limit: 9}); err == nil || n != 9 {
+		t.Errorf("got %v bytes written, %v; expected an error after 9 bytes", n, err)
+	}
+}
+
+func TestDecoderMaxDepth(t *testing.T) {
+	// nested returns n containers nested in one another.
+	nested := func(n int) []byte {
+		b := make([]byte, 0, 12*n)
+		for i := 0; i < n; i++ {
+			id := "LIST"
+			if i == 0 {
+				id = "RIFF"
+			}
+			b = append(b, id...)
+			b = binary.LittleEndian.AppendUint32(b, uint32(4+12*(n-1-i)))
+			b = append(b, "TEST"...)
+		}
+		return b
+	}
+	if _, err := NewDecoder(bytes.NewReader(nested(DefaultMaxDepth))).Decode(); err != nil {
+		t.Errorf("Decode of %v nested containers: %v", DefaultMaxDepth, err)
+	}
+	for _, n := range []int{DefaultMaxDepth + 1, 100000} {
+		_, err := NewDecoder(bytes.NewReader(nested(n))).Decode()
+		if err == nil || !strings.Contains(err.Error(), "nesting depth exceeded") {
+			t.Errorf("Decode of %v nested containers: got error %v, expected the depth to be exceeded", n, err)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(nested(3)))
+	d.MaxDepth = 2
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected error for 3 containers with MaxDepth 2")
+	}
+	d = NewDecoder(bytes.NewReader(nested(3)))
+	d.MaxDepth, d.Tolerant = 2, true
+	c, err := d.Decode()
+	if err != nil || len(c.Chunks) != 1 || len(c.Chunks[0].Chunks) != 0 || len(d.Errors()) != 1 {
+		t.Errorf("tolerant decode: got %v, %v, errors %v", c, err, d.Errors())
+	}
+}
+
+func TestMaxChunkSize(t *testing.T) {
+	b := withRIFFLen(listBytes("RIFF", "WAVE", leafBytes("data", []byte("samples"))), 0xffffffff)
+	binary.LittleEndian.PutUint32(b[16:], 0xfffffff0)
+
+	_, err := NewDecoder(bytes.NewBuffer(b)).Decode()
+	if err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("got error %v, expected the length to exceed the limit", err)
+	}
+	d := NewDecoder(bytes.NewBuffer(b))
+	d.MaxChunkSize = 4
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected error with a limit of 4 bytes")
+	}
+
+	// Without a limit, the size of a seekable stream bounds allocations.
+	d = NewDecoder(bytes.NewReader(b))
+	d.MaxChunkSize = 0
+	if _, err := d.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v, expected a truncated chunk", err)
+	}
+	d = NewDecoder(bytes.NewReader(b))
+	d.MaxChunkSize, d.Tolerant = 0, true
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Tolerant Decode: %v", err)
+	}
+	if data := c.Chunks[0].Data; string(data) != "samples\x00" {
+		t.Errorf("got data %q, expected the bytes left in the stream", data)
+	}
+
+	// On other streams, the buffer grows as data arrives.
+	d = NewDecoder(bytes.NewBuffer(b))
+	d.MaxChunkSize, d.Tolerant = 0, true
+	if c, err = d.Decode(); err != nil {
+		t.Fatalf("Tolerant Decode of a buffer: %v", err)
+	}
+	if data := c.Chunks[0].Data; string(data) != "samples\x00" || cap(data) > 1<<20 {
+		t.Errorf("got data %q with a capacity of %v, expected the bytes left in the stream", data, cap(data))
+	}
+}
+
+func TestDecodeOddChunks(t *testing.T) {
+	b := listBytes("RIFF", "TEST",
+		leafBytes("one ", []byte("abc")),
+		leafBytes("two ", []byte("defgh")),
+		leafBytes("next", []byte("xy")),
+	)
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(c.Chunks) != 3 {
+		t.Fatalf("got %v subchunks, expected 3", len(c.Chunks))
+	}
+	for i, exp := range []struct {
+		id     string
+		data   string
+		offset int64
+	}{{"one ", "abc", 12}, {"two ", "defgh", 24}, {"next", "xy", 38}} {
+		sc := c.Chunks[i]
+		if sc.ID != NewID(exp.id) || string(sc.Data) != exp.data || sc.Offset != exp.offset {
+			t.Errorf("subchunk #%v: got %q %q at %v, expected %q %q at %v", i, sc.ID, sc.Data, sc.Offset, exp.id, exp.data, exp.offset)
+		}
+	}
+}
+
+func TestDecodeStructure(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+
+	d := NewDecoder(f)
+	d.Map(NewID("data"), func(io.Reader) (interface{}, error) {
+		t.Errorf("DecoderFunc called by DecodeStructure")
+		return nil, nil
+	})
+	c, err := d.DecodeStructure()
+	if err != nil {
+		t.Fatalf("DecodeStructure: %v", err)
+	}
+	var offsets []int64
+	c.walk(func(c *Chunk) {
+		offsets = append(offsets, c.Offset)
+		if c.Data != nil {
+			t.Errorf("%q has data", c.ID)
+		}
+	})
+	if exp := []int64{0, 12, 50, 62, 7870, 7882}; !reflect.DeepEqual(offsets, exp) {
+		t.Errorf("got offsets %v, expected %v", offsets, exp)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	full, err := NewDecoder(f).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	compare(t, full, c)
+
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	if _, err := NewDecoder(bytes.NewReader(b[:5000])).DecodeStructure(); err == nil {
+		t.Errorf("expected error on truncated file")
+	}
+	if _, err := NewDecoder(bytes.NewBuffer(b)).DecodeStructure(); err == nil {
+		t.Errorf("expected error on a reader that can't seek")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	full, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for _, r := range []io.Reader{bytes.NewReader(b), bytes.NewBuffer(b)} {
+		d := NewDecoder(r)
+		d.ReadOnly = []ID{NewID("fmt "), NewID("ISFT")}
+		d.Map(NewID("data"), func(io.Reader) (interface{}, error) {
+			t.Errorf("DecoderFunc called for a skipped chunk")
+			return nil, nil
+		})
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("%T: Decode: %v", r, err)
+		}
+		var got []*Chunk
+		c.walk(func(c *Chunk) { got = append(got, c) })
+		var i int
+		full.walk(func(exp *Chunk) {
+			c := got[i]
+			i++
+			if c.ID != exp.ID || c.Len != exp.Len || c.Offset != exp.Offset {
+				t.Errorf("%T: got chunk %q of length %v at %v, expected %q of length %v at %v", r, c.ID, c.Len, c.Offset, exp.ID, exp.Len, exp.Offset)
+			}
+			if read := c.ID == NewID("fmt ") || c.ID == NewID("ISFT"); read && !bytes.Equal(c.Data, exp.Data) {
+				t.Errorf("%T: %q got data %q, expected %q", r, c.ID, c.Data, exp.Data)
+			} else if !read && c.Data != nil {
+				t.Errorf("%T: %q has data", r, c.ID)
+			}
+		})
+	}
+}
+
+func TestRecoverTrailing(t *testing.T) {
+	fmtChunk := leafBytes("fmt ", make([]byte, 16))
+	data := leafBytes("data", []byte("samples"))
+	info := listBytes("LIST", "INFO", leafBytes("INAM", []byte("odd")))
+	full, err := NewDecoder(bytes.NewReader(listBytes("RIFF", "WAVE", fmtChunk, info, data))).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	short := withRIFFLen(listBytes("RIFF", "WAVE", fmtChunk, info, data), 4+uint32(len(fmtChunk)))
+
+	for name, tt := range map[string]struct {
+		b         []byte
+		recovered int
+	}{
+		"unpadded":     {short[:len(short)-1], 2},
+		"zeros":        {append(short, make([]byte, 10)...), 2},
+		"concatenated": {append(short, listBytes("RIFF", "WAVE", fmtChunk)...), 2},
+		"stray bytes":  {append(short, "abc"...), 2},
+		"complete":     {listBytes("RIFF", "WAVE", fmtChunk, info, data), 0},
+	} {
+		d := NewDecoder(bytes.NewReader(tt.b))
+		d.RecoverTrailing = true
+		c, err := d.Decode()
+		if err != nil {
+			t.Errorf("%v: Decode: %v", name, err)
+			continue
+		}
+		compare(t, full, c)
+		if d.Recovered() != tt.recovered {
+			t.Errorf("%v: recovered %v chunks, expected %v", name, d.Recovered(), tt.recovered)
+		}
+	}
+
+	c, err := NewDecoder(bytes.NewReader(short)).Decode()
+	if err != nil || len(c.Chunks) != 1 {
+		t.Errorf("got %v, %v without RecoverTrailing; expected only the fmt chunk", c, err)
+	}
+	d := NewDecoder(bytes.NewReader(short[:len(short)-4]))
+	d.RecoverTrailing = true
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected error recovering a truncated chunk")
+	}
+}
+
+// trickleWriter accepts at most n bytes per call, without reporting an
+// error for the rest.
+type trickleWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w trickleWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	return w.w.Write(p)
+}
+
+func TestShortWrites(t *testing.T) {
+	b, err := ioutil.ReadFile("data/odd.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := c.WriteTo(trickleWriter{buf, 3})
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(len(b)) || !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("wrote %v bytes %q, expected %q", n, buf.Bytes(), b)
+	}
+
+	if _, err := c.WriteTo(trickleWriter{buf, 0}); err != io.ErrShortWrite {
+		t.Errorf("expected io.ErrShortWrite from a writer making no progress, got %v", err)
+	}
+}
+
+// callWriter is an unbuffered writer counting its calls, failing once it
+// has accepted limit bytes if limit is positive.
+type callWriter struct {
+	calls, n, limit int
+}
+
+func (w *callWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.limit > 0 && w.n+len(p) > w.limit {
+		n := w.limit - w.n
+		w.n = w.limit
+		return n, errors.New("full")
+	}
+	w.n += len(p)
+	return len(p), nil
+}
+
+func TestWriteToBuffers(t *testing.T) {
+	b := manyChunks(1000)
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	w := &callWriter{}
+	if n, err := c.WriteTo(w); err != nil || n != int64(len(b)) {
+		t.Fatalf("wrote %v bytes with error %v, expected %v", n, err, len(b))
+	}
+	if max := len(b)/writeBufferSize + 1; w.calls > max {
+		t.Errorf("wrote %v bytes in %v calls, expected at most %v", len(b), w.calls, max)
+	}
+
+	w = &callWriter{limit: 5000}
+	n, err := c.WriteTo(w)
+	if err == nil || err.Error() != "full" || n != 5000 {
+		t.Errorf("wrote %v bytes with error %v, expected 5000 bytes and the writer error", n, err)
+	}
+}
+
+func BenchmarkWriteManyChunksFile(b *testing.B) {
+	c, err := NewDecoder(bytes.NewReader(manyChunks(10000))).Decode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.WriteTo(f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+
+	d := NewDecoder(f)
+	id, l, err := d.ReadHeader()
+	if err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+	if id != NewID("RIFF") || l != 7944 {
+		t.Errorf("got %q of length %v, expected RIFF of length 7944", id, l)
+	}
+	var form ID
+	if _, err := form.ReadFrom(f); err != nil || form != NewID("WAVE") {
+		t.Errorf("reader not positioned at the form type: %q, %v", form, err)
+	}
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode after ReadHeader: %v", err)
+	}
+	if c.ID != NewID("fmt ") || c.Len != 30 {
+		t.Errorf("decoded %v, expected the fmt chunk", c)
+	}
+
+	d = NewDecoder(bytes.NewReader([]byte("RIFF\x01\x00")))
+	if _, _, err := d.ReadHeader(); err == nil {
+		t.Errorf("expected error reading a partial header")
+	}
+}
+
+func TestMapIn(t *testing.T) {
+	payload := []byte{1, 2}
+	files := map[string][]byte{
+		"WAVE": listBytes("RIFF", "WAVE", leafBytes("fmt ", payload)),
+		"TEST": listBytes("RIFF", "TEST", leafBytes("fmt ", payload)),
+		"LIST": listBytes("LIST", "INFO", leafBytes("fmt ", payload)),
+	}
+	tag := func(s string) DecoderFunc {
+		return func(io.Reader) (interface{}, error) { return s, nil }
+	}
+	exp := map[string]interface{}{"WAVE": "wave", "TEST": "any", "LIST": "any"}
+
+	for form, b := range files {
+		d := NewDecoder(bytes.NewReader(b))
+		d.Map(NewID("fmt "), tag("any"))
+		d.MapIn(NewID("WAVE"), NewID("fmt "), tag("wave"))
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode %v: %v", form, err)
+		}
+		if got := c.Chunks[0].Content; got != exp[form] {
+			t.Errorf("%v: content is %v, expected %v", form, got, exp[form])
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(files["TEST"]))
+	d.MapIn(NewID("WAVE"), NewID("fmt "), tag("wave"))
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := c.Chunks[0].Content; got != nil {
+		t.Errorf("content outside WAVE is %v, expected nil", got)
+	}
+	if err := d.MapIn(NewID("WAVE"), NewID("LIST"), tag("list")); err == nil {
+		t.Errorf("expected error mapping LIST")
+	}
+}
+
+func TestMapFunc(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		listBytes("LIST", "INFO", leafBytes("labl", []byte("abc"))),
+		listBytes("LIST", "adtl", leafBytes("labl", []byte("de"))),
+		leafBytes("labl", nil))
+	d := NewDecoder(bytes.NewReader(b))
+	err := d.MapFunc(NewID("labl"), func(info ChunkInfo, r io.Reader) (interface{}, error) {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if int(info.Len) != len(data) {
+			return nil, fmt.Errorf("length %v, read %v bytes", info.Len, len(data))
+		}
+		return fmt.Sprintf("%v in %v: %s", info.ID, info.ListID, data), nil
+	})
+	if err != nil {
+		t.Fatalf("MapFunc: %v", err)
+	}
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for i, exp := range []string{"labl in INFO: abc", "labl in adtl: de", "labl in WAVE: "} {
+		sc := c.Chunks[i]
+		if sc.IsContainer() {
+			sc = sc.Chunks[0]
+		}
+		if got := sc.Content; got != exp {
+			t.Errorf("chunk %v: content is %q, expected %q", i, got, exp)
+		}
+	}
+	if err := d.MapFunc(NewID("LIST"), nil); err == nil {
+		t.Errorf("expected error mapping LIST")
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	b := listBytes("RIFF", "TEST", leafBytes("ISFT", []byte("ab")),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("abcdef"))))
+	_, err := NewDecoder(bytes.NewReader(b[:len(b)-3])).Decode()
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("got error %v, expected a DecodeError", err)
+	}
+	if de.Offset != 34 || de.ID != NewID("INAM") {
+		t.Errorf("got error at offset %v in %q, expected offset 34 in \"INAM\"", de.Offset, de.ID)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("error %v doesn't wrap io.ErrUnexpectedEOF", err)
+	}
+	if !strings.Contains(err.Error(), `offset 34: chunk "INAM": `) {
+		t.Errorf("error %q doesn't tell the offset and ID of the chunk", err)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(nil)).Decode(); err != io.EOF {
+		t.Errorf("empty input: got %v, expected io.EOF", err)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	// The first RIFF has an odd length: its last chunk is padded after it.
+	first := listBytes("RIFF", "TEST", leafBytes("odd ", []byte("abc")))
+	first[4]--
+	second := listBytes("RIFF", "TEST", leafBytes("even", []byte("ab")))
+	b := append(first, second...)
+
+	cs, err := NewDecoder(bytes.NewReader(b)).DecodeAll()
+	if err != nil {
+		t.Fatalf("DecodeAll: %v", err)
+	}
+	if len(cs) != 2 {
+		t.Fatalf("decoded %v chunks, expected 2", len(cs))
+	}
+	if cs[0].Len != 15 || string(cs[0].Chunks[0].Data) != "abc" {
+		t.Errorf("unexpected first chunk %v", cs[0])
+	}
+	if cs[1].Len != 14 || string(cs[1].Chunks[0].Data) != "ab" {
+		t.Errorf("unexpected second chunk %v", cs[1])
+	}
+
+	// The final pad byte is optional.
+	cs, err = NewDecoder(bytes.NewReader(b[:len(first)-1])).DecodeAll()
+	if err != nil || len(cs) != 1 {
+		t.Errorf("DecodeAll without final pad: got %v chunks, %v", len(cs), err)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(b[:len(b)-1])).DecodeAll(); err == nil {
+		t.Errorf("expected error for a truncated second chunk")
+	}
+}
+
+func TestOnlyKnownContainers(t *testing.T) {
+	nested := listBytes("RIFF", "TEST", leafBytes("fake", nil))
+	copy(nested, "JUNK")
+	b := listBytes("RIFF", "TEST", nested)
+
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	junk := c.Chunks[0]
+	if junk.IsContainer() || len(junk.Chunks) != 0 || junk.ListID != (ID{}) {
+		t.Errorf("JUNK decoded as a container: %v", junk)
+	}
+	if !bytes.Equal(junk.Data, nested[8:]) {
+		t.Errorf("JUNK data is %q, expected %q", junk.Data, nested[8:])
+	}
+}
+
+func TestCountChildren(t *testing.T) {
+	b := listBytes("RIFF", "AVI ",
+		listBytes("LIST", "hdrl",
+			leafBytes("avih", make([]byte, 56)),
+			listBytes("LIST", "strl", leafBytes("strh", make([]byte, 56))),
+			listBytes("LIST", "strl", leafBytes("strh", make([]byte, 56))),
+		),
+		listBytes("LIST", "movi", leafBytes("00dc", make([]byte, 1000))),
+	)
+	for _, tt := range []struct {
+		path []ID
+		n    int
+	}{
+		{nil, 2},
+		{[]ID{NewID("hdrl")}, 3},
+		{[]ID{NewID("hdrl"), NewID("strl")}, 1},
+		{[]ID{NewID("movi")}, 1},
+	} {
+		n, err := NewDecoder(bytes.NewReader(b)).CountChildren(tt.path...)
+		if err != nil {
+			t.Errorf("%q: CountChildren: %v", tt.path, err)
+		} else if n != tt.n {
+			t.Errorf("%q: got %v children, expected %v", tt.path, n, tt.n)
+		}
+	}
+
+	for _, path := range [][]ID{{NewID("idx1")}, {NewID("hdrl"), NewID("avih")}} {
+		if _, err := NewDecoder(bytes.NewReader(b)).CountChildren(path...); err == nil {
+			t.Errorf("%q: expected error", path)
+		}
+	}
+	if _, err := NewDecoder(struct{ io.Reader }{bytes.NewReader(b)}).CountChildren(); err == nil {
+		t.Errorf("expected error for a reader that can't seek")
+	}
+}
+
+// failingReader reads from r until it is exhausted, and then returns err.
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func TestReadDataErrors(t *testing.T) {
+	b := listBytes("RIFF", "WAVE", leafBytes("data", make([]byte, 100)))[:60]
+	transient := errors.New("connection reset")
+
+	_, err := NewDecoder(failingReader{bytes.NewReader(b), io.EOF}).Decode()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated file: got %v, expected io.ErrUnexpectedEOF", err)
+	}
+	_, err = NewDecoder(failingReader{bytes.NewReader(b), transient}).Decode()
+	if !errors.Is(err, transient) || errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("failing reader: got %v, expected %v", err, transient)
+	}
+	if err != nil && !strings.Contains(err.Error(), `"data"`) {
+		t.Errorf("error doesn't name the chunk: %v", err)
+	}
+}
+
+func TestContentTimeout(t *testing.T) {
+	b := listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 16)), leafBytes("data", []byte{1, 2}))
+	release := make(chan struct{})
+	defer close(release)
+
+	d := NewDecoder(bytes.NewReader(b))
+	d.ContentTimeout = 10 * time.Millisecond
+	d.Map(NewID("fmt "), func(r io.Reader) (interface{}, error) { return "fmt", nil })
+	d.Map(NewID("data"), func(r io.Reader) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	if _, err := d.Decode(); err == nil || !strings.Contains(err.Error(), "didn't return") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(b))
+	d.ContentTimeout = time.Second
+	d.Map(NewID("data"), func(r io.Reader) (interface{}, error) { panic("bad data") })
+	if _, err := d.Decode(); err == nil || !strings.Contains(err.Error(), "bad data") {
+		t.Errorf("expected panic error, got %v", err)
+	}
+
+	d = NewDecoder(bytes.NewReader(b))
+	d.ContentTimeout = time.Second
+	d.Map(NewID("fmt "), func(r io.Reader) (interface{}, error) { return "fmt", nil })
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := c.Chunks[0].Content; got != "fmt" {
+		t.Errorf("got content %v, expected fmt", got)
+	}
+}
+
+func TestCopyData(t *testing.T) {
+	b, err := ioutil.ReadFile("data/odd.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	data := c.FindChunk(NewID("data"))
+	buf := new(bytes.Buffer)
+	n, err := data.CopyData(trickleWriter{buf, 2})
+	if err != nil {
+		t.Fatalf("CopyData: %v", err)
+	}
+	if n != 7 || !bytes.Equal(buf.Bytes(), data.Data) {
+		t.Errorf("copied %v bytes %q, expected %q", n, buf.Bytes(), data.Data)
+	}
+	if _, err := c.CopyData(buf); err == nil {
+		t.Errorf("expected error copying the data of a container")
+	}
+}
+
+func TestSectionChunk(t *testing.T) {
+	src := strings.NewReader("headerSAMPLEStrailer")
+	data := SectionChunk(NewID("data"), src, 6, 7)
+	root := &Chunk{ID: riff, ListID: NewID("WAVE"), Chunks: []*Chunk{data}}
+	if err := root.UpdateLengths(); err != nil {
+		t.Fatal(err)
+	}
+	exp := listBytes("RIFF", "WAVE", leafBytes("data", []byte("SAMPLES")))
+	for i := 0; i < 2; i++ {
+		buf := new(bytes.Buffer)
+		if n, err := root.WriteTo(buf); err != nil || n != int64(len(exp)) {
+			t.Fatalf("WriteTo #%v: %v bytes, %v", i, n, err)
+		}
+		if !bytes.Equal(buf.Bytes(), exp) {
+			t.Errorf("WriteTo #%v: got %q, expected %q", i, buf.Bytes(), exp)
+		}
+	}
+	buf := new(bytes.Buffer)
+	if _, err := data.CopyData(buf); err != nil || buf.String() != "SAMPLES" {
+		t.Errorf("CopyData: got %q, %v", buf, err)
+	}
+
+	short := SectionChunk(NewID("data"), src, 15, 10)
+	if _, err := short.WriteTo(ioutil.Discard); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("section past the end of its source: got error %v", err)
+	}
+}
+
+func TestSize(t *testing.T) {
+	for _, path := range []string{"data/hand.wav", "data/odd.wav"} {
+		c := decodeFile(t, path)
+		buf := new(bytes.Buffer)
+		n, err := c.WriteTo(buf)
+		if err != nil {
+			t.Fatalf("%v: WriteTo: %v", path, err)
+		}
+		if got := c.Size(); got != n || got != int64(buf.Len()) {
+			t.Errorf("%v: Size is %v, WriteTo wrote %v bytes", path, got, n)
+		}
+		again, err := NewDecoder(buf).Decode()
+		if err != nil {
+			t.Fatalf("%v: decode the written file: %v", path, err)
+		}
+		if again.Size() != n {
+			t.Errorf("%v: Size of the round-tripped tree is %v, expected %v", path, again.Size(), n)
+		}
+
+		data := c.FindChunk(NewID("data"))
+		data.Data = append(data.Data, 1, 2, 3)
+		c.UpdateLengths()
+		if n, err := c.WriteTo(ioutil.Discard); err != nil || n != c.Size() {
+			t.Errorf("%v: edited tree: Size is %v, WriteTo wrote %v bytes, %v", path, c.Size(), n, err)
+		}
+	}
+}
+
+func TestWriteToLengthMismatch(t *testing.T) {
+	for _, edit := range []func(*Chunk){
+		func(c *Chunk) { c.Data = c.Data[:len(c.Data)-1] },
+		func(c *Chunk) { c.Data = append(c.Data, 0) },
+		func(c *Chunk) { c.Data = []byte{} },
+	} {
+		c := decodeFile(t, "data/hand.wav")
+		edit(c.FindChunk(NewID("data")))
+		buf := new(bytes.Buffer)
+		n, err := c.WriteTo(buf)
+		if err == nil || !strings.Contains(err.Error(), `chunk "data" of length 7800`) {
+			t.Errorf("got error %v, expected a length mismatch", err)
+		}
+		if n != 0 || buf.Len() != 0 {
+			t.Errorf("wrote %v bytes, expected none", buf.Len())
+		}
+		if err := c.UpdateLengths(); err != nil {
+			t.Fatalf("UpdateLengths: %v", err)
+		}
+		if _, err := c.WriteTo(buf); err != nil {
+			t.Errorf("WriteTo after UpdateLengths: %v", err)
+		}
+	}
+
+	// Without Data, the leaf isn't loaded: UpdateLengths keeps its length.
+	c := decodeFile(t, "data/hand.wav")
+	c.FindChunk(NewID("data")).Data = nil
+	if err := c.UpdateLengths(); err != nil {
+		t.Fatalf("UpdateLengths: %v", err)
+	}
+	if _, err := c.WriteTo(ioutil.Discard); err == nil || !strings.Contains(err.Error(), `chunk "data" of length 7800`) {
+		t.Errorf("got error %v writing a leaf without data, expected a length mismatch", err)
+	}
+}
+
+func TestWriteToExpecting(t *testing.T) {
+	b, err := ioutil.ReadFile("data/odd.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if n, err := c.WriteToExpecting(buf, int64(len(b))); err != nil || n != int64(len(b)) || !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("got %v bytes, %v; expected the %v bytes of the file", n, err, len(b))
+	}
+
+	// Data edited without updating Len changes the size written.
+	data := c.FindChunk(NewID("data"))
+	data.Data = append(data.Data, 0)
+	buf.Reset()
+	if n, err := c.WriteToExpecting(buf, int64(len(b))); err == nil || n != 0 || buf.Len() != 0 {
+		t.Errorf("got %v bytes written, %v; expected an error and nothing written", n, err)
+	}
+}
+
+func TestReadDataInto(t *testing.T) {
+	src := strings.NewReader("headerSAMPLEStrailer")
+	buf := make([]byte, 8)
+	for _, c := range []*Chunk{
+		{ID: NewID("data"), Len: 7, Data: []byte("SAMPLES")},
+		SectionChunk(NewID("data"), src, 6, 7),
+	} {
+		n, err := c.ReadDataInto(buf)
+		if err != nil || string(buf[:n]) != "SAMPLES" {
+			t.Errorf("got %q, %v; expected SAMPLES", buf[:n], err)
+		}
+		if _, err := c.ReadDataInto(buf[:6]); err == nil {
+			t.Errorf("expected error reading into a too small buffer")
+		}
+		if allocs := testing.AllocsPerRun(10, func() { c.ReadDataInto(buf) }); allocs != 0 {
+			t.Errorf("ReadDataInto made %v allocations, expected none", allocs)
+		}
+	}
+	if _, err := SectionChunk(NewID("data"), src, 15, 7).ReadDataInto(buf); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("section past the end of its source: got error %v", err)
+	}
+	if _, err := (&Chunk{ID: NewID("data"), Len: 7}).ReadDataInto(buf); err == nil {
+		t.Errorf("expected error reading a chunk with no data loaded")
+	}
+	if _, err := (&Chunk{ID: list, ListID: NewID("INFO")}).ReadDataInto(buf); err == nil {
+		t.Errorf("expected error reading the data of a container")
+	}
+}
+
+func TestFrames(t *testing.T) {
+	src := strings.NewReader("headerSAMPLEStrailer")
+	for _, c := range []*Chunk{
+		{ID: NewID("data"), Len: 7, Data: []byte("SAMPLES")},
+		SectionChunk(NewID("data"), src, 6, 7),
+	} {
+		next := c.Frames(3)
+		var got []string
+		for {
+			b, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Frames: %v", err)
+			}
+			got = append(got, string(b))
+		}
+		if exp := []string{"SAM", "PLE", "S"}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("got frames %q, expected %q", got, exp)
+		}
+		if _, err := next(); err != io.EOF {
+			t.Errorf("got %v after the last frame, expected io.EOF", err)
+		}
+	}
+
+	next := SectionChunk(NewID("data"), src, 15, 7).Frames(4)
+	if b, err := next(); err != nil || string(b) != "aile" {
+		t.Errorf("got frame %q, %v; expected aile", b, err)
+	}
+	if _, err := next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("section past the end of its source: got error %v", err)
+	}
+	if _, err := (&Chunk{ID: NewID("data"), Data: []byte("x")}).Frames(0)(); err == nil {
+		t.Errorf("expected error with frames of 0 bytes")
+	}
+	if _, err := (&Chunk{ID: list, ListID: NewID("INFO")}).Frames(4)(); err == nil {
+		t.Errorf("expected error iterating over a container")
+	}
+}
+
+func BenchmarkReadDataInto(b *testing.B) {
+	src := bytes.NewReader(manyChunks(10000))
+	ix, err := ReadIndex(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var chunks []*Chunk
+	for _, e := range ix.Entries[1:] {
+		chunks = append(chunks, SectionChunk(e.ID, src, e.Offset+8, int64(e.Len)))
+	}
+	buf := make([]byte, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, c := range chunks {
+			if _, err := c.ReadDataInto(buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestDataToEOF(t *testing.T) {
+	samples := []byte("samples")
+	zero := append(listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 16)), leafBytes("data", nil)), samples...)
+	placeholder := withRIFFLen(append(listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 16)), leafBytes("data", nil)), samples...), 0xffffffff)
+	binary.LittleEndian.PutUint32(placeholder[40:], 0xffffffff)
+	exp := listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 16)), leafBytes("data", samples))
+
+	for name, b := range map[string][]byte{"zero": zero, "placeholder": placeholder} {
+		if _, err := NewDecoder(bytes.NewReader(b)).Decode(); name == "placeholder" && err == nil {
+			t.Errorf("%v: expected error without DataToEOF", name)
+		}
+		d := NewDecoder(bytes.NewReader(b))
+		d.DataToEOF = true
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if data := c.FindChunk(NewID("data")); data.Len != 7 || !bytes.Equal(data.Data, samples) {
+			t.Errorf("%v: got data chunk %v %q", name, data.Len, data.Data)
+		}
+		buf := new(bytes.Buffer)
+		c.WriteTo(buf)
+		if !bytes.Equal(buf.Bytes(), exp) {
+			t.Errorf("%v: wrote %q, expected %q", name, buf.Bytes(), exp)
+		}
+	}
+
+	// Only the last chunk of the stream is read until EOF.
+	notLast := listBytes("RIFF", "WAVE", leafBytes("data", nil), leafBytes("fmt ", make([]byte, 16)))
+	d := NewDecoder(bytes.NewReader(notLast))
+	d.DataToEOF = true
+	c, err := d.Decode()
+	if err != nil || len(c.Chunks) != 2 || c.Chunks[0].Len != 0 {
+		t.Errorf("zero length data followed by a chunk: got %v, %v", c, err)
+	}
+
+	// MaxChunkSize limits the data read until EOF.
+	zero = append(listBytes("RIFF", "WAVE", leafBytes("data", nil)), samples...)
+	d = NewDecoder(bytes.NewReader(zero))
+	d.DataToEOF, d.MaxChunkSize = true, 6
+	if _, err := d.Decode(); err == nil || !strings.Contains(err.Error(), "exceeds the limit of 6 bytes") {
+		t.Errorf("got error %v reading past MaxChunkSize until EOF", err)
+	}
+	d = NewDecoder(bytes.NewReader(zero))
+	d.DataToEOF, d.MaxChunkSize = true, 7
+	if _, err := d.Decode(); err != nil {
+		t.Errorf("data of MaxChunkSize bytes read until EOF: %v", err)
+	}
+}
+
+func TestStrictFuncConsumption(t *testing.T) {
+	b := listBytes("RIFF", "TEST", leafBytes("abcd", []byte("12345678")))
+	partial := func(r io.Reader) (interface{}, error) {
+		var v uint32
+		err := binary.Read(r, binary.LittleEndian, &v)
+		return v, err
+	}
+	for _, tt := range []struct {
+		strict, tolerant bool
+		ok               bool
+	}{
+		{false, false, true},
+		{true, false, false},
+		{true, true, true},
+	} {
+		d := NewDecoder(bytes.NewReader(b))
+		d.Map(NewID("abcd"), partial)
+		d.StrictFuncConsumption, d.Tolerant = tt.strict, tt.tolerant
+		c, err := d.Decode()
+		if tt.ok != (err == nil) {
+			t.Errorf("strict %v, tolerant %v: got error %v", tt.strict, tt.tolerant, err)
+			continue
+		}
+		if err != nil {
+			if !strings.Contains(err.Error(), "left 4 of its 8 bytes unread") {
+				t.Errorf("unexpected error %v", err)
+			}
+			continue
+		}
+		if c.Chunks[0].Content != uint32(0x34333231) {
+			t.Errorf("got content %v", c.Chunks[0].Content)
+		}
+		if tt.tolerant && len(d.Errors()) != 1 {
+			t.Errorf("got errors %v, expected one", d.Errors())
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(NewID("abcd"), func(r io.Reader) (interface{}, error) { return ioutil.ReadAll(r) })
+	d.StrictFuncConsumption = true
+	if _, err := d.Decode(); err != nil {
+		t.Errorf("func reading all its data: %v", err)
+	}
+}
+
+func TestDecodePath(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	r := bytes.NewReader(append(b, listBytes("RIFF", "NEXT")...))
+	d := NewDecoder(r)
+	decoded := map[ID]bool{}
+	for _, id := range []ID{NewID("fmt "), NewID("data"), NewID("ISFT")} {
+		id := id
+		d.Map(id, func(r io.Reader) (interface{}, error) {
+			decoded[id] = true
+			return ioutil.ReadAll(r)
+		})
+	}
+	c, err := d.DecodePath(NewID("INFO"), NewID("ISFT"))
+	if err != nil {
+		t.Fatalf("DecodePath: %v", err)
+	}
+	if c.ID != NewID("ISFT") || c.Len != 62 || !bytes.Equal(c.Data, b[7890:7890+62]) {
+		t.Errorf("got chunk %v with data %q", c, c.Data)
+	}
+	if !decoded[NewID("ISFT")] || decoded[NewID("fmt ")] || decoded[NewID("data")] {
+		t.Errorf("decoded %v, expected only ISFT", decoded)
+	}
+	if d.BytesRead() != int64(len(b)) {
+		t.Errorf("read %v bytes, expected the whole first chunk of %v", d.BytesRead(), len(b))
+	}
+
+	list, err := d.DecodePath()
+	if err != nil || list.ListID != NewID("NEXT") {
+		t.Errorf("empty path: got %v, %v", list, err)
+	}
+
+	if _, err := NewDecoder(bytes.NewReader(b)).DecodePath(NewID("INFO"), NewID("nope")); err == nil {
+		t.Errorf("expected error for a missing chunk")
+	}
+	if c, err := NewDecoder(struct{ io.Reader }{bytes.NewReader(b)}).DecodePath(NewID("INFO")); err != nil || len(c.Chunks) != 1 {
+		t.Errorf("without seeking: got %v, %v", c, err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x40, 0x1f, 0, 0, 1, 0, 8, 0}),
+		leafBytes("data", []byte{1, 2}),
+	)
+	b = b[:len(b)-1] // truncate the data chunk
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(NewID("fmt "), WaveFmtDecoder)
+	d.Tolerant = true
+	var lines []string
+	d.Logger = func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	if _, err := d.Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	exp := []string{
+		`offset 0: container "RIFF" of form type "WAVE" and length 38`,
+		`offset 12: chunk "fmt " of length 16`,
+		`offset 12: running the DecoderFunc for "fmt "`,
+		`offset 36: chunk "data" of length 2`,
+		`offset 36: recovered from error: read data: chunk "data" truncated after 1 of 2 bytes: unexpected EOF`,
+		`offset 45: recovered from error: 1 stray bytes after subchunk #1`,
+	}
+	if !reflect.DeepEqual(lines, exp) {
+		t.Errorf("got log\n%v\nexpected\n%v", strings.Join(lines, "\n"), strings.Join(exp, "\n"))
+	}
+}
+
+func TestMapListTransform(t *testing.T) {
+	body := bytes.Join([][]byte{
+		leafBytes("INAM", []byte("name")),
+		leafBytes("ISFT", []byte("odd")),
+	}, nil)
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(body)
+	zw.Close()
+	b := listBytes("RIFF", "GAME",
+		leafBytes("LIST", append([]byte("ZLIB"), z.Bytes()...)),
+		leafBytes("tail", []byte{1, 2}),
+	)
+	unzip := func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }
+
+	for name, d := range map[string]*Decoder{
+		"stream": NewDecoder(bytes.NewReader(b)),
+		"bytes":  NewBytesDecoder(b),
+	} {
+		d.MapListTransform(NewID("ZLIB"), unzip)
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("%v: Decode: %v", name, err)
+		}
+		l := c.FindChunk(NewID("ZLIB"))
+		if l == nil || len(l.Chunks) != 2 || l.Len != uint32(4+z.Len()) {
+			t.Fatalf("%v: got %v, expected the 2 compressed subchunks", name, l)
+		}
+		if sc := l.Chunks[1]; string(sc.Data) != "odd" || sc.Offset != 12 {
+			t.Errorf("%v: got %q at offset %v, expected \"odd\" at offset 12", name, sc.Data, sc.Offset)
+		}
+		if tail := c.FindChunk(NewID("tail")); tail == nil || !bytes.Equal(tail.Data, []byte{1, 2}) {
+			t.Errorf("%v: got tail %v after the compressed list", name, tail)
+		}
+		if n := d.BytesRead(); n != int64(len(b)) {
+			t.Errorf("%v: read %v bytes, expected %v", name, n, len(b))
+		}
+
+		if err := c.UpdateLengths(); err != nil {
+			t.Fatalf("%v: UpdateLengths: %v", name, err)
+		}
+		got, err := c.Bytes()
+		if err != nil {
+			t.Fatalf("%v: Bytes: %v", name, err)
+		}
+		exp := listBytes("RIFF", "GAME", leafBytes("LIST", append([]byte("ZLIB"), body...)), leafBytes("tail", []byte{1, 2}))
+		if !bytes.Equal(got, exp) {
+			t.Errorf("%v: got %q, expected the uncompressed list %q", name, got, exp)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(b))
+	d.MapListTransform(NewID("ZLIB"), func(io.Reader) (io.Reader, error) { return nil, errors.New("bad") })
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected the transform error")
+	}
+}
+
+func TestMapDefault(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", []byte{1, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x80, 0x3e, 0, 0, 2, 0, 16, 0}),
+		leafBytes("minf", []byte("vendor")),
+		listBytes("LIST", "INFO", leafBytes("elm1", []byte{1, 2, 3})),
+	)
+	d := NewDecoder(bytes.NewReader(b))
+	d.Map(NewID("fmt "), WaveFmtDecoder)
+	d.MapDefault(RawDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	unknown := map[ID]bool{}
+	c.walk(func(c *Chunk) {
+		if c.Unknown() {
+			unknown[c.ID] = true
+		}
+	})
+	if exp := map[ID]bool{NewID("minf"): true, NewID("elm1"): true}; !reflect.DeepEqual(unknown, exp) {
+		t.Errorf("got unknown chunks %v, expected %v", unknown, exp)
+	}
+	if got := c.FindChunk(NewID("minf")).Content; !reflect.DeepEqual(got, []byte("vendor")) {
+		t.Errorf("got Content %v, expected the raw data", got)
+	}
+	if _, ok := c.FindChunk(NewID("fmt ")).Content.(WaveFmt); !ok {
+		t.Errorf("the default DecoderFunc was used for a mapped chunk")
+	}
+
+	minf := c.FindChunk(NewID("minf"))
+	if err := minf.SetContent("known", func(v interface{}) ([]byte, error) { return []byte(v.(string)), nil }); err != nil {
+		t.Fatalf("SetContent: %v", err)
+	}
+	if minf.Unknown() {
+		t.Errorf("chunk still unknown after SetContent")
+	}
+
+	// Functions registered with MapIn take precedence too, and the default
+	// function reads the data of every other leaf.
+	var sizes []int
+	d = NewDecoder(bytes.NewReader(b))
+	d.MapIn(NewID("WAVE"), NewID("elm1"), func(io.Reader) (interface{}, error) { return "elm1", nil })
+	d.MapDefault(func(r io.Reader) (interface{}, error) {
+		data, err := ioutil.ReadAll(r)
+		sizes = append(sizes, len(data))
+		return len(data), err
+	})
+	if c, err = d.Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := c.FindChunk(NewID("INFO"), NewID("elm1")).Content; got != "elm1" {
+		t.Errorf("got Content %v for the chunk mapped with MapIn", got)
+	}
+	if exp := []int{16, 6}; !reflect.DeepEqual(sizes, exp) {
+		t.Errorf("default function read %v bytes, expected %v", sizes, exp)
+	}
+}
+
+func TestMapRewrite(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO",
+			leafBytes("INAM", []byte("name\x00\x00\x00")),
+			leafBytes("ISFT", []byte("riff")),
+		),
+		leafBytes("data", []byte{1, 2}),
+	)
+	d := NewDecoder(bytes.NewReader(b))
+	d.MapRewrite(NewID("INAM"), func(data []byte) ([]byte, error) {
+		return bytes.TrimRight(data, "\x00"), nil
+	})
+	d.MapRewrite(NewID("data"), func(data []byte) ([]byte, error) {
+		return []byte{data[1], data[0]}, nil
+	})
+	d.Map(NewID("INAM"), func(r io.Reader) (interface{}, error) {
+		b, err := ioutil.ReadAll(r)
+		return string(b), err
+	})
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := c.FindChunk(NewID("INFO"), NewID("INAM")).Content; got != "name" {
+		t.Errorf("DecoderFunc got %q, expected the rewritten data", got)
+	}
+	exp := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO",
+			leafBytes("INAM", []byte("name")),
+			leafBytes("ISFT", []byte("riff")),
+		),
+		leafBytes("data", []byte{2, 1}),
+	)
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), exp)
+	}
+
+	d = NewDecoder(bytes.NewReader(b))
+	d.MapRewrite(NewID("data"), func([]byte) ([]byte, error) { return nil, errors.New("bad data") })
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected error from the rewrite function")
+	}
+	if err := d.MapRewrite(NewID("LIST"), nil); err == nil {
+		t.Errorf("expected error rewriting a container")
+	}
+}
+
+func TestFindAll(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	if got := c.FindAll(NewID("ISFT")); len(got) != 1 || got[0].Len != 62 {
+		t.Errorf("ISFT: got %v", got)
+	}
+	if got := c.FindAll(NewID("INFO")); len(got) != 1 || got[0].ID != NewID("LIST") {
+		t.Errorf("INFO: got %v", got)
+	}
+	if got := c.FindAll(NewID("idx1")); got != nil {
+		t.Errorf("idx1: got %v, expected nil", got)
+	}
+}
+
+func TestFindFirst(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	if got := c.FindFirst(NewID("ISFT")); got == nil || got.Len != 62 {
+		t.Errorf("ISFT: got %v", got)
+	}
+	if got := c.FindFirst(NewID("INFO")); got == nil || got.ID != NewID("LIST") {
+		t.Errorf("INFO: got %v", got)
+	}
+	if got := c.FindFirst(riff); got != c {
+		t.Errorf("RIFF: got %v, expected the root", got)
+	}
+	if got := c.FindFirst(NewID("idx1")); got != nil {
+		t.Errorf("idx1: got %v, expected nil", got)
+	}
+	info := c.FindFirst(NewID("INFO"))
+	info.Chunks = append(info.Chunks, info)
+	if got := c.FindFirst(NewID("idx1")); got != nil {
+		t.Errorf("idx1 in a cyclic tree: got %v, expected nil", got)
+	}
+}
+
+// stalledReader reads from r until it is exhausted, and then returns (0,
+// nil) forever.
+type stalledReader struct{ r io.Reader }
+
+func (r stalledReader) Read(p []byte) (int, error) {
+	n, _ := r.r.Read(p)
+	return n, nil
+}
+
+func TestNoProgress(t *testing.T) {
+	b := listBytes("RIFF", "WAVE", leafBytes("data", make([]byte, 100)))
+	for _, n := range []int{0, 2, 6, 10, 12, 20, 60} {
+		_, err := NewDecoder(stalledReader{bytes.NewReader(b[:n])}).Decode()
+		if !errors.Is(err, io.ErrNoProgress) {
+			t.Errorf("stalled after %v bytes: got %v, expected io.ErrNoProgress", n, err)
+		}
+	}
+}
+
+func TestBytesRead(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	d := NewDecoder(bytes.NewReader(append(b, "trailing"...)))
+	if n := d.BytesRead(); n != 0 {
+		t.Errorf("read %v bytes before decoding", n)
+	}
+	if _, err := d.Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if n := d.BytesRead(); n != int64(len(b)) {
+		t.Errorf("read %v bytes, expected %v", n, len(b))
+	}
+}
+
+// cancelingWriter cancels a context once n bytes have been written.
+type cancelingWriter struct {
+	bytes.Buffer
+	n      int
+	cancel func()
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	n, err := w.Buffer.Write(p)
+	if w.Len() >= w.n {
+		w.cancel()
+	}
+	return n, err
+}
+
+func TestWriteToContext(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	buf := new(bytes.Buffer)
+	if n, err := c.WriteToContext(ctx, buf); err != nil || n != 7952 {
+		t.Errorf("wrote %v bytes with error %v, expected 7952", n, err)
+	}
+
+	// Cancel while writing the data chunk.
+	w := &cancelingWriter{n: 100, cancel: cancel}
+	n, err := c.WriteToContext(ctx, w)
+	if err != context.Canceled {
+		t.Errorf("got error %v, expected context.Canceled", err)
+	}
+	if exp := int64(7870); n != exp {
+		t.Errorf("wrote %v bytes, expected to stop before the LIST at %v", n, exp)
+	}
+	if n, err := c.WriteToContext(ctx, buf); err != context.Canceled || n != 0 {
+		t.Errorf("canceled context: wrote %v bytes with error %v", n, err)
+	}
+}
+
+func TestDecodeContext(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewDecoder(bytes.NewReader(b))
+	if _, err := d.DecodeContext(ctx); err != nil {
+		t.Fatalf("DecodeContext: %v", err)
+	}
+
+	// Cancel once the fact chunk is read, deep in the tree in Tolerant
+	// mode, which must not recover from it.
+	d.Reset(bytes.NewReader(b))
+	d.Tolerant = true
+	d.Progress = func(id ID, n int64) error {
+		if id == NewID("fact") {
+			cancel()
+		}
+		return nil
+	}
+	if _, err := d.DecodeContext(ctx); err != context.Canceled {
+		t.Errorf("got error %v, expected context.Canceled", err)
+	}
+	if n := d.BytesRead(); n != 62 {
+		t.Errorf("read %v bytes, expected to stop before the data chunk at 62", n)
+	}
+
+	d.Reset(bytes.NewReader(b))
+	d.Progress = nil
+	if _, err := d.Decode(); err != nil {
+		t.Errorf("Decode after a canceled DecodeContext: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	d.Reset(bytes.NewReader(b))
+	if _, err := d.DecodeContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got error %v, expected context.DeadlineExceeded", err)
+	}
+}
+
+// cyclicTree returns a RIFF chunk holding a LIST that contains itself.
+func cyclicTree() *Chunk {
+	l := &Chunk{ID: list, ListID: info, Chunks: []*Chunk{{ID: NewID("INAM"), Len: 1, Data: []byte("a")}}}
+	l.Chunks = append(l.Chunks, l)
+	return &Chunk{ID: riff, ListID: wave, Chunks: []*Chunk{{ID: NewID("JUNK")}, l}}
+}
+
+func TestCyclicTree(t *testing.T) {
+	c := cyclicTree()
+	if n := c.Size(); n != -1 {
+		t.Errorf("Size of a cyclic tree is %v, expected -1", n)
+	}
+	if s := c.String(); !strings.Contains(s, "contains itself") {
+		t.Errorf("cyclic tree formatted as %q", s)
+	}
+}
+
+func TestIDString(t *testing.T) {
+	id := NewID("fmt ")
+	if got := id.String(); got != "fmt " {
+		t.Errorf("String: got %q, expected \"fmt \"", got)
+	}
+	if got := fmt.Sprintf("%v %s %v", id, id, &id); got != "fmt  fmt  fmt " {
+		t.Errorf("formatted as %q", got)
+	}
+	c := &Chunk{ID: id, Len: 16}
+	if got := fmt.Sprint(c); !strings.HasPrefix(got, `"fmt "`) {
+		t.Errorf("chunk formatted as %q", got)
+	}
+}
+
+func TestTryNewID(t *testing.T) {
+	for _, tt := range []struct {
+		s  string
+		ok bool
+	}{
+		{"fmt ", true},
+		{"ISFT", true},
+		{"fmt", false},
+		{"fmt  ", false},
+		{"da\x00a", false},
+		{"dat\x7f", false},
+	} {
+		id, err := TryNewID(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("TryNewID(%q): got error %v, expected ok %v", tt.s, err, tt.ok)
+		} else if tt.ok && id != NewID(tt.s) {
+			t.Errorf("TryNewID(%q) = %q", tt.s, id)
+		}
+	}
+}
+
+func TestStrictIDs(t *testing.T) {
+	for _, b := range [][]byte{
+		listBytes("RIFF", "TEST", leafBytes("ab\x00\x01", []byte("data"))),
+		listBytes("RIFF", "TEST", listBytes("LIST", "\x00\x00\x00\x00")),
+	} {
+		if _, err := NewDecoder(bytes.NewReader(b)).Decode(); err != nil {
+			t.Errorf("Decode: %v", err)
+		}
+		d := NewDecoder(bytes.NewReader(b))
+		d.StrictIDs = true
+		if _, err := d.Decode(); err == nil || !strings.Contains(err.Error(), "not printable ASCII") {
+			t.Errorf("got error %v, expected an error for an ID that isn't printable", err)
+		}
+	}
+}
+
+func TestIDCompare(t *testing.T) {
+	for _, tt := range []struct {
+		a, b ID
+		exp  int
+	}{
+		{NewID("data"), NewID("data"), 0},
+		{NewID("LIST"), NewID("data"), -1},
+		{NewID("data"), NewID("LIST"), 1},
+		{NewID("fmt "), NewID("fmt\x00"), 1},
+		{NewID("abc\x7f"), NewID("abc\x80"), -1},
+		{ID{0xff, 0, 0, 0}, ID{0, 0xff, 0xff, 0xff}, 1},
+		{ID{}, NewID("    "), -1},
+	} {
+		if got := tt.a.Compare(tt.b); got != tt.exp {
+			t.Errorf("%q.Compare(%q) = %v, expected %v", tt.a, tt.b, got, tt.exp)
+		}
+	}
+
+	c := &Chunk{Chunks: []*Chunk{{ID: NewID("data")}, {ID: NewID("LIST")}, {ID: NewID("fmt ")}}}
+	c.SortChildren(func(a, b *Chunk) bool { return a.ID.Compare(b.ID) < 0 })
+	if c.Chunks[0].ID != NewID("LIST") || c.Chunks[2].ID != NewID("fmt ") {
+		t.Errorf("got order %q, %q, %q", c.Chunks[0].ID, c.Chunks[1].ID, c.Chunks[2].ID)
+	}
+}
+
+func TestFind(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	var visited []string
+	next := c.Find(func(c *Chunk) bool {
+		visited = append(visited, c.ID.String())
+		return !c.IsContainer()
+	})
+	for _, exp := range []string{"fmt ", "fact"} {
+		if got := next(); got == nil || got.ID != NewID(exp) {
+			t.Fatalf("got %v, expected %q", got, exp)
+		}
+	}
+	if exp := []string{"RIFF", "fmt ", "fact"}; !reflect.DeepEqual(visited, exp) {
+		t.Errorf("visited %q before stopping, expected %q", visited, exp)
+	}
+	for _, exp := range []string{"data", "ISFT"} {
+		if got := next(); got == nil || got.ID != NewID(exp) {
+			t.Fatalf("got %v, expected %q", got, exp)
+		}
+	}
+	if got := next(); got != nil {
+		t.Errorf("got %v after the last match", got)
+	}
+	if got := next(); got != nil {
+		t.Errorf("got %v after the end", got)
+	}
+}
+
+func TestCaseInsensitiveLookup(t *testing.T) {
+	b := listBytes("RIFF", "WAVE", leafBytes("FMT ", make([]byte, 16)), leafBytes("Data", []byte{1, 2}), leafBytes("data", []byte{3, 4}))
+	for _, fold := range []bool{false, true} {
+		d := NewDecoder(bytes.NewReader(b))
+		d.CaseInsensitiveLookup = fold
+		d.Map(NewID("fmt "), WaveFmtDecoder)
+		d.Map(NewID("data"), func(io.Reader) (interface{}, error) { return "lower", nil })
+		d.MapIn(NewID("WAVE"), NewID("DATA"), func(io.Reader) (interface{}, error) { return "upper", nil })
+		c, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if _, ok := c.Chunks[0].Content.(WaveFmt); ok != fold {
+			t.Errorf("fold %v: FMT content is %v", fold, c.Chunks[0].Content)
+		}
+		if c.Chunks[0].ID != NewID("FMT ") {
+			t.Errorf("fold %v: ID changed to %q", fold, c.Chunks[0].ID)
+		}
+		var exp interface{}
+		if fold {
+			exp = "upper"
+		}
+		if got := c.Chunks[1].Content; got != exp {
+			t.Errorf("fold %v: Data content is %v, expected %v", fold, got, exp)
+		}
+		if got := c.Chunks[2].Content; got != "lower" {
+			t.Errorf("fold %v: exact match content is %v", fold, got)
+		}
+	}
+}
+
+func TestDeterministicWrite(t *testing.T) {
+	build := func() *Chunk {
+		c := &Chunk{ID: NewID("RIFF"), ListID: NewID("WAVE")}
+		for _, id := range []string{"fmt ", "odd ", "data"} {
+			c.Chunks = append(c.Chunks, &Chunk{ID: NewID(id), Data: []byte(id[:3]), Content: map[string]int{"a": 1, "b": 2}})
+		}
+		c.UpdateLengths()
+		return c
+	}
+	var outs [][]byte
+	for i := 0; i < 3; i++ {
+		buf := new(bytes.Buffer)
+		if _, err := build().WriteTo(buf); err != nil {
+			t.Fatalf("WriteTo: %v", err)
+		}
+		outs = append(outs, buf.Bytes())
+	}
+	for i := range outs[1:] {
+		if !bytes.Equal(outs[0], outs[i+1]) {
+			t.Errorf("writes differ: %q and %q", outs[0], outs[i+1])
+		}
+	}
+	exp := listBytes("RIFF", "WAVE", leafBytes("fmt ", []byte("fmt")), leafBytes("odd ", []byte("odd")), leafBytes("data", []byte("dat")))
+	if !bytes.Equal(outs[0], exp) {
+		t.Errorf("got %q, expected %q with zero pad bytes", outs[0], exp)
+	}
+}
+
+func TestMaxContentDecodes(t *testing.T) {
+	b := manyChunks(10)
+	for _, tt := range []struct {
+		max int
+		ok  bool
+	}{
+		{0, true},
+		{10, true},
+		{9, false},
+	} {
+		calls := 0
+		d := NewDecoder(bytes.NewReader(append(b, b...)))
+		d.MaxContentDecodes = tt.max
+		d.Tolerant = true
+		d.Map(NewID("00dc"), func(io.Reader) (interface{}, error) {
+			calls++
+			return nil, nil
+		})
+		for i := 0; i < 2; i++ {
+			_, err := d.Decode()
+			if tt.ok && err != nil {
+				t.Errorf("max %v: Decode #%v: %v", tt.max, i, err)
+			} else if !tt.ok && err == nil {
+				t.Errorf("max %v: Decode #%v: expected error", tt.max, i)
+			}
+			if !tt.ok {
+				break
+			}
+		}
+		if !tt.ok && calls != tt.max {
+			t.Errorf("max %v: got %v calls", tt.max, calls)
+		}
+	}
+}
+
+func TestDecodePosition(t *testing.T) {
+	hand, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	// A RIFF of odd length, followed by its pad byte.
+	odd := []byte("RIFF\x0d\x00\x00\x00TESTx   \x01\x00\x00\x00a\x00")
+	// A LIST holding 3 stray bytes, only decoded in Tolerant mode.
+	stray := []byte("RIFF\x14\x00\x00\x00TESTLIST\x07\x00\x00\x00INFOabc\x00")
+
+	for _, tt := range []struct {
+		name   string
+		b      []byte
+		decode func(d *Decoder) (*Chunk, error)
+	}{
+		{"hand.wav", hand, (*Decoder).Decode},
+		{"odd length", odd, (*Decoder).Decode},
+		{"structure", hand, (*Decoder).DecodeStructure},
+		{"path", hand, func(d *Decoder) (*Chunk, error) { return d.DecodePath(NewID("fmt ")) }},
+		{"partial content", hand, func(d *Decoder) (*Chunk, error) {
+			d.Map(NewID("data"), func(r io.Reader) (interface{}, error) {
+				_, err := r.Read(make([]byte, 2))
+				return nil, err
+			})
+			return d.Decode()
+		}},
+		{"tolerant", stray, func(d *Decoder) (*Chunk, error) {
+			d.Tolerant = true
+			return d.Decode()
+		}},
+	} {
+		r := bytes.NewReader(append(append([]byte{}, tt.b...), "next"...))
+		d := NewDecoder(r)
+		if _, err := tt.decode(d); err != nil {
+			t.Errorf("%v: %v", tt.name, err)
+			continue
+		}
+		if pos := r.Size() - int64(r.Len()); pos != int64(len(tt.b)) || d.BytesRead() != pos {
+			t.Errorf("%v: reader at offset %v after reading %v bytes, expected %v", tt.name, pos, d.BytesRead(), len(tt.b))
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package riff
+
+import (
+	"fmt"
+	"io"
+)
+
+// ChunkScanner reads the chunks of a RIFF stream one at a time, like
+// bufio.Scanner reads lines. Successive calls to Scan step through the
+// subchunks of the top-level RIFF or RIFX chunk, returning containers as
+// single chunks, with their ListID but without subchunks, unless Recurse is
+// set. Only the current chunk is held in memory.
+type ChunkScanner struct {
+	// Recurse makes Scan step into containers, returning their subchunks
+	// after them.
+	Recurse bool
+	// ReadData makes Scan read the data of leaf chunks into the Data of the
+	// chunks it returns. Otherwise only their headers are read, and their
+	// data can be read from Reader.
+	ReadData bool
+
+	d     *Decoder
+	root  *Chunk // the top-level chunk, without subchunks
+	form  ID
+	stack []scanned // containers being scanned, innermost last
+	chunk *Chunk
+	depth int
+	data  *io.LimitedReader // unread data of the current chunk
+	err   error
+}
+
+// scanned is a container whose subchunks are being scanned.
+type scanned struct {
+	c *Chunk
+	r *io.LimitedReader // unread subchunks
+}
+
+// NewChunkScanner returns a ChunkScanner reading from r.
+func NewChunkScanner(r io.Reader) *ChunkScanner {
+	return &ChunkScanner{d: NewDecoder(r)}
+}
+
+// Scan advances to the next chunk, which is then available through Chunk,
+// skipping the data of the current one left unread. It returns false at
+// the end of the top-level chunk, or on an error, which Err returns.
+func (s *ChunkScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.err = s.scan(); s.err != nil {
+		s.chunk, s.data = nil, nil
+		return false
+	}
+	return true
+}
+
+// Chunk returns the chunk read by the last call to Scan. Containers have
+// no subchunks, IsContainer telling them apart from leaves.
+func (s *ChunkScanner) Chunk() *Chunk {
+	return s.chunk
+}
+
+// Depth returns how deep the chunk returned by Chunk is nested in the
+// top-level chunk, 0 for its subchunks. It is only above 0 with Recurse.
+func (s *ChunkScanner) Depth() int {
+	return s.depth
+}
+
+// Form returns the form type of the top-level chunk, once Scan was called.
+func (s *ChunkScanner) Form() ID {
+	return s.form
+}
+
+// Reader returns a reader over the data of the current chunk not read yet,
+// which for a container not stepped into is its subchunks.
+func (s *ChunkScanner) Reader() io.Reader {
+	if s.data == nil {
+		return &io.LimitedReader{}
+	}
+	return s.data
+}
+
+// Err returns the first error met by Scan, or nil if it stopped at the end
+// of the top-level chunk.
+func (s *ChunkScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+func (s *ChunkScanner) scan() error {
+	if s.stack == nil {
+		return s.start()
+	}
+	if s.chunk != nil && s.data != nil {
+		if err := skip(s.data, s.data.N); err != nil {
+			return fmt.Errorf("offset %v: skip %q: %w", s.chunk.Offset, s.chunk.ID, err)
+		}
+		if err := s.skipPad(s.chunk); err != nil {
+			return err
+		}
+	}
+	for s.stack[len(s.stack)-1].r.N == 0 {
+		top := s.stack[len(s.stack)-1]
+		if s.stack = s.stack[:len(s.stack)-1]; len(s.stack) == 0 {
+			return io.EOF
+		}
+		if err := s.skipPad(top.c); err != nil {
+			return err
+		}
+	}
+
+	r := s.stack[len(s.stack)-1].r
+	if r.N < 8 {
+		return fmt.Errorf("offset %v: %v stray bytes at the end of a container", s.d.r.n, r.N)
+	}
+	c := &Chunk{Offset: s.d.r.n}
+	var err error
+	if c.ID, c.Len, err = s.d.readHeader(r); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("offset %v: %w", c.Offset, err)
+	}
+	if int64(c.Len) > r.N {
+		return fmt.Errorf("offset %v: chunk %q of length %v overruns its container by %v bytes", c.Offset, c.ID, c.Len, int64(c.Len)-r.N)
+	}
+	s.chunk, s.depth = c, len(s.stack)-1
+	s.data = &io.LimitedReader{R: r, N: int64(c.Len)}
+	if c.IsContainer() {
+		if c.Len < 4 {
+			return fmt.Errorf("offset %v: container of length %v has no room for a form type", c.Offset, c.Len)
+		}
+		if _, err := c.ListID.ReadFrom(s.data); err != nil {
+			return fmt.Errorf("offset %v: read form type: %w", c.Offset, err)
+		}
+		if s.Recurse {
+			s.stack = append(s.stack, scanned{c, s.data})
+			s.data = nil
+		}
+		return nil
+	}
+	if s.ReadData {
+		if err := s.d.checkSize(c); err != nil {
+			return fmt.Errorf("offset %v: %v", c.Offset, err)
+		}
+		if c.Data, err = s.d.readFull(s.data, int64(c.Len)); err != nil {
+			return fmt.Errorf("offset %v: read %q data: %w", c.Offset, c.ID, err)
+		}
+	}
+	return nil
+}
+
+// start reads the header and form type of the top-level chunk, then its
+// first subchunk.
+func (s *ChunkScanner) start() error {
+	id, l, err := s.d.readHeader(s.d.r)
+	if err != nil {
+		return err
+	}
+	if id != riff && id != rifx {
+		return fmt.Errorf("not a RIFF stream, top-level id is %q", id)
+	}
+	if l < 4 {
+		return fmt.Errorf("container of length %v has no room for a form type", l)
+	}
+	if _, err := s.form.ReadFrom(s.d.r); err != nil {
+		return fmt.Errorf("read form type: %w", err)
+	}
+	s.root = &Chunk{ID: id, Len: l, ListID: s.form}
+	s.stack = []scanned{{s.root, &io.LimitedReader{R: s.d.r, N: int64(l) - 4}}}
+	return s.scan()
+}
+
+// skipPad skips the pad byte following the odd-length chunk c, unless c
+// ends its container.
+func (s *ChunkScanner) skipPad(c *Chunk) error {
+	r := s.stack[len(s.stack)-1].r
+	if c.Len%2 == 0 || r.N == 0 {
+		return nil
+	}
+	if err := skip(r, 1); err != nil {
+		return fmt.Errorf("offset %v: skip pad of %q: %w", s.d.r.n, c.ID, err)
+	}
+	return nil
+}
+
+// Next reads the header of the next subchunk of the top-level RIFF or RIFX
+// chunk read by d, as ChunkScanner.Scan does: its ID, length, offset and for
+// containers ListID, without its data or subchunks, which can then be read
+// with ReadData, or skipped with Skip or by calling Next again. Next
+// returns io.EOF at the end of the top-level chunk. It must not be mixed
+// with Decode on the same input.
+func (d *Decoder) Next() (*Chunk, error) {
+	if d.next == nil {
+		d.next = &ChunkScanner{d: d}
+	}
+	if !d.next.Scan() {
+		if err := d.next.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return d.next.Chunk(), nil
+}
+
+// Skip skips the data of the chunk returned by the last call to Next, or
+// for a container its subchunks, seeking past them if the reader is an
+// io.Seeker.
+func (d *Decoder) Skip() error {
+	s := d.next
+	if s == nil || s.chunk == nil {
+		return fmt.Errorf("Skip called before Next")
+	}
+	if err := skip(s.data, s.data.N); err != nil {
+		return fmt.Errorf("offset %v: skip %q: %w", s.chunk.Offset, s.chunk.ID, err)
+	}
+	return nil
+}
+
+// ReadData reads the data of the chunk returned by the last call to Next,
+// or what is left of it, or for a container its serialized subchunks.
+func (d *Decoder) ReadData() ([]byte, error) {
+	s := d.next
+	if s == nil || s.chunk == nil {
+		return nil, fmt.Errorf("ReadData called before Next")
+	}
+	if err := d.checkSize(s.chunk); err != nil {
+		return nil, err
+	}
+	l := s.data.N
+	b, err := d.readFull(s.data, l)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("read data: chunk %q truncated after %v of %v bytes: %w", s.chunk.ID, len(b), l, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,172 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestChunkScanner(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+
+	s := NewChunkScanner(f)
+	s.ReadData = true
+	var got []*Chunk
+	for s.Scan() {
+		got = append(got, s.Chunk())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if s.Form() != NewID("WAVE") {
+		t.Errorf("got form type %q, expected WAVE", s.Form())
+	}
+
+	exp := decodeFile(t, "data/hand.wav").Chunks
+	if len(got) != len(exp) {
+		t.Fatalf("got %v chunks, expected %v", len(got), len(exp))
+	}
+	for i, c := range got {
+		e := exp[i]
+		if c.ID != e.ID || c.Len != e.Len || c.Offset != e.Offset || c.ListID != e.ListID {
+			t.Errorf("chunk #%v: got %q len %v offset %v form %q, expected %q len %v offset %v form %q",
+				i, c.ID, c.Len, c.Offset, c.ListID, e.ID, e.Len, e.Offset, e.ListID)
+		}
+		if c.IsContainer() {
+			if len(c.Chunks) != 0 || c.Data != nil {
+				t.Errorf("container %q was not returned as a single chunk: %v", c.ListID, c)
+			}
+		} else if !bytes.Equal(c.Data, e.Data) {
+			t.Errorf("chunk %q: got %v bytes of data, expected %v", c.ID, len(c.Data), len(e.Data))
+		}
+	}
+}
+
+func TestChunkScannerRecurse(t *testing.T) {
+	b := BuildRIFF(NewID("TEST"),
+		ChunkSpec{ID: "odd ", Data: []byte("abc")},
+		ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{
+			{ID: "INAM", Data: []byte("x")},
+			{ID: "LIST", Form: "deep", Chunks: []ChunkSpec{{ID: "ISFT", Data: []byte("yyy")}}},
+		}},
+		ChunkSpec{ID: "last", Data: []byte("zz")},
+	)
+	s := NewChunkScanner(bytes.NewReader(b))
+	s.Recurse = true
+	var events []string
+	for s.Scan() {
+		c := s.Chunk()
+		data, err := ioutil.ReadAll(s.Reader())
+		if err != nil {
+			t.Fatalf("read %q: %v", c.ID, err)
+		}
+		events = append(events, fmt.Sprintf("%v %s %s %q", s.Depth(), c.ID[:], c.ListID[:], data))
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	exp := []string{
+		`0 odd  ` + "\x00\x00\x00\x00" + ` "abc"`,
+		`0 LIST INFO ""`,
+		`1 INAM ` + "\x00\x00\x00\x00" + ` "x"`,
+		`1 LIST deep ""`,
+		`2 ISFT ` + "\x00\x00\x00\x00" + ` "yyy"`,
+		`0 last ` + "\x00\x00\x00\x00" + ` "zz"`,
+	}
+	if !reflect.DeepEqual(events, exp) {
+		t.Errorf("got\n%q\nexpected\n%q", events, exp)
+	}
+
+	s = NewChunkScanner(bytes.NewReader(b[:len(b)-6]))
+	for s.Scan() {
+	}
+	if s.Err() == nil {
+		t.Errorf("expected an error scanning a truncated stream")
+	}
+}
+
+func TestDecoderNext(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+
+	exp := decodeFile(t, "data/hand.wav").Chunks
+	d := NewDecoder(f)
+	if err := d.Skip(); err == nil {
+		t.Errorf("expected error skipping before Next")
+	}
+	for i := 0; ; i++ {
+		c, err := d.Next()
+		if err == io.EOF {
+			if i != len(exp) {
+				t.Errorf("got %v chunks, expected %v", i, len(exp))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next #%v: %v", i, err)
+		}
+		e := exp[i]
+		if c.ID != e.ID || c.Len != e.Len || c.Offset != e.Offset || c.ListID != e.ListID {
+			t.Errorf("chunk #%v: got %q len %v offset %v, expected %q len %v offset %v", i, c.ID, c.Len, c.Offset, e.ID, e.Len, e.Offset)
+		}
+		switch c.ID {
+		case NewID("data"):
+			if err := d.Skip(); err != nil {
+				t.Errorf("Skip: %v", err)
+			}
+		case NewID("fmt "):
+			if data, err := d.ReadData(); err != nil || !bytes.Equal(data, e.Data) {
+				t.Errorf("ReadData: got %q, %v; expected %q", data, err, e.Data)
+			}
+		}
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Errorf("got %v after the last chunk, expected io.EOF", err)
+	}
+
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	d = NewDecoder(bytes.NewReader(b[:5000]))
+	for {
+		c, err := d.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if c.ID == NewID("data") {
+			break
+		}
+	}
+	if _, err := d.ReadData(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated data: got error %v", err)
+	}
+}
+
+func TestReadDataMaxChunkSize(t *testing.T) {
+	// Without a limit, a chunk longer than what is left of a stream that
+	// can't be seeked is read as truncated.
+	b := withRIFFLen(listBytes("RIFF", "WAVE", leafBytes("data", []byte("samples"))), 0xffffffff)
+	binary.LittleEndian.PutUint32(b[16:], 0xfffffff0)
+	d := NewDecoder(bytes.NewBuffer(b))
+	d.MaxChunkSize = 0
+	if _, err := d.Next(); err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if data, err := d.ReadData(); !errors.Is(err, io.ErrUnexpectedEOF) || data != nil {
+		t.Errorf("ReadData got %q, %v, expected a truncated chunk", data, err)
+	}
+}
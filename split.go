@@ -0,0 +1,207 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// SplitByForm returns a standalone RIFF tree for every RIFF or RIFX chunk
+// held by c, by form type, as when separating the files bundled in a
+// single RIFF. To split files concatenated at the top level, decoded with
+// DecodeAll, use a Chunk holding them as c. Only the first chunk of every
+// form type is returned. The trees returned share their subchunks with c.
+func (c *Chunk) SplitByForm() map[ID]*Chunk {
+	m := make(map[ID]*Chunk)
+	for _, sc := range c.Chunks {
+		if sc.ID != riff && sc.ID != rifx {
+			continue
+		}
+		if _, ok := m[sc.ListID]; !ok {
+			m[sc.ListID] = sc
+		}
+	}
+	return m
+}
+
+var (
+	aviForm = NewID("AVI ")
+	hdrlID  = NewID("hdrl")
+	avihID  = NewID("avih")
+	strlID  = NewID("strl")
+	moviID  = NewID("movi")
+	idx1ID  = NewID("idx1")
+)
+
+// ExtractStream returns a standalone AVI file holding only the stream with
+// the given index of the AVI file c: its "strl" header list, renumbered as
+// stream 0 in "avih", the chunks of its data in "movi", renamed from
+// "NNxx" to "00xx", and their "idx1" entries, with offsets recomputed.
+// Other chunks are kept, except for OpenDML "ix" indexes, which would point
+// to the original file. The returned tree shares its leaves' data with c,
+// but not its chunks, so that c is left unchanged. A chunk containing
+// itself is an error.
+func (c *Chunk) ExtractStream(index int) (*Chunk, error) {
+	if c.ID != riff || c.ListID != aviForm {
+		return nil, fmt.Errorf("not an AVI file: %q form %q", c.ID, c.ListID)
+	}
+	if _, err := c.MaxDepth(); err != nil {
+		return nil, err
+	}
+	hdrl := c.FindChunk(hdrlID)
+	if hdrl == nil {
+		return nil, fmt.Errorf("missing %q list", hdrlID)
+	}
+	var strl *Chunk
+	n := 0
+	for _, sc := range hdrl.Chunks {
+		if sc.IsContainer() && sc.ListID == strlID {
+			if n == index {
+				strl = sc
+			}
+			n++
+		}
+	}
+	if strl == nil || index > 99 {
+		return nil, fmt.Errorf("no stream #%v, the file has %v", index, n)
+	}
+	prefix := fmt.Sprintf("%02d", index)
+
+	out := &Chunk{ID: riff, ListID: aviForm}
+	var entries []AVIIndexEntry
+	var movi *Chunk
+	idx1 := -1 // index of the idx1 chunk in out
+	for _, sc := range c.Chunks {
+		switch {
+		case sc.IsContainer() && sc.ListID == hdrlID:
+			out.Chunks = append(out.Chunks, extractHdrl(sc, strl))
+		case sc.IsContainer() && sc.ListID == moviID:
+			movi = extractMovi(sc, prefix)
+			out.Chunks = append(out.Chunks, movi)
+		case sc.ID == idx1ID:
+			var err error
+			if entries, err = DecodeRecords[AVIIndexEntry](sc.Data, binary.LittleEndian); err != nil {
+				return nil, fmt.Errorf("decode idx1: %v", err)
+			}
+			idx1 = len(out.Chunks)
+			out.Chunks = append(out.Chunks, nil)
+		default:
+			out.Chunks = append(out.Chunks, detach(sc))
+		}
+	}
+	if idx1 >= 0 {
+		entries, err := reindex(entries, prefix, movi)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, entries)
+		out.Chunks[idx1] = &Chunk{ID: idx1ID, Data: buf.Bytes()}
+	}
+	if err := out.UpdateLengths(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// detach returns a copy of the tree rooted at c sharing the data of its
+// leaves, whose lengths can be updated without changing c.
+func detach(c *Chunk) *Chunk {
+	cc := *c
+	if c.Chunks != nil {
+		cc.Chunks = make([]*Chunk, len(c.Chunks))
+		for i, sc := range c.Chunks {
+			cc.Chunks[i] = detach(sc)
+		}
+	}
+	return &cc
+}
+
+// extractHdrl returns a copy of the hdrl list with strl as its only stream
+// header list.
+func extractHdrl(hdrl, strl *Chunk) *Chunk {
+	out := &Chunk{ID: hdrl.ID, ListID: hdrl.ListID}
+	for _, sc := range hdrl.Chunks {
+		switch {
+		case sc.IsContainer() && sc.ListID == strlID:
+			if sc == strl {
+				out.Chunks = append(out.Chunks, detach(sc))
+			}
+		case sc.ID == avihID && len(sc.Data) >= 28:
+			avih := *sc
+			avih.Data = append([]byte(nil), sc.Data...)
+			binary.LittleEndian.PutUint32(avih.Data[24:], 1) // dwStreams
+			out.Chunks = append(out.Chunks, &avih)
+		default:
+			out.Chunks = append(out.Chunks, detach(sc))
+		}
+	}
+	return out
+}
+
+// extractMovi returns a copy of the movi list, or of a rec list it holds,
+// with only the data chunks of the stream with the given two digit prefix,
+// renamed as stream 0. Rec lists left empty are dropped.
+func extractMovi(movi *Chunk, prefix string) *Chunk {
+	out := &Chunk{ID: movi.ID, ListID: movi.ListID}
+	for _, sc := range movi.Chunks {
+		if sc.IsContainer() {
+			if rec := extractMovi(sc, prefix); len(rec.Chunks) > 0 {
+				out.Chunks = append(out.Chunks, rec)
+			}
+			continue
+		}
+		id := sc.ID
+		if id[0] == 'i' && id[1] == 'x' {
+			continue
+		}
+		stream := isDigit(id[0]) && isDigit(id[1])
+		if stream && string(id[:2]) != prefix {
+			continue
+		}
+		sc = detach(sc)
+		if stream {
+			sc.ID[0], sc.ID[1] = '0', '0'
+		}
+		out.Chunks = append(out.Chunks, sc)
+	}
+	return out
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// reindex returns the idx1 entries of the stream with the given prefix,
+// renamed as stream 0, pointing to the data chunks of the extracted movi
+// list in order. Offsets are counted from the movi form type.
+func reindex(entries []AVIIndexEntry, prefix string, movi *Chunk) ([]AVIIndexEntry, error) {
+	if movi == nil {
+		return nil, nil
+	}
+	if err := movi.UpdateLengths(); err != nil {
+		return nil, err
+	}
+	var offsets []uint32
+	var walk func(c *Chunk, off uint32)
+	walk = func(c *Chunk, off uint32) {
+		for _, sc := range c.Chunks {
+			if sc.IsContainer() {
+				walk(sc, off+12)
+			} else if sc.ID[0] == '0' && sc.ID[1] == '0' {
+				offsets = append(offsets, off)
+			}
+			off += 8 + sc.Len + sc.Len%2
+		}
+	}
+	walk(movi, 4)
+
+	out := []AVIIndexEntry{}
+	for _, e := range entries {
+		if string(e.ChunkID[:2]) != prefix || e.Flags&AVIIndexList != 0 || len(out) == len(offsets) {
+			continue
+		}
+		e.ChunkID[0], e.ChunkID[1] = '0', '0'
+		e.Offset = offsets[len(out)]
+		out = append(out, e)
+	}
+	return out, nil
+}
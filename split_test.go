@@ -0,0 +1,107 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestSplitByForm(t *testing.T) {
+	wav := &Chunk{ID: riff, ListID: NewID("WAVE")}
+	avi := &Chunk{ID: riff, ListID: aviForm}
+	bundle := &Chunk{ID: riff, ListID: NewID("BNDL"), Chunks: []*Chunk{
+		wav, {ID: NewID("JUNK")}, avi, {ID: riff, ListID: NewID("WAVE")},
+	}}
+	got := bundle.SplitByForm()
+	if exp := map[ID]*Chunk{NewID("WAVE"): wav, aviForm: avi}; !reflect.DeepEqual(got, exp) || got[NewID("WAVE")] != wav {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestExtractStream(t *testing.T) {
+	avih := make([]byte, 56)
+	binary.LittleEndian.PutUint32(avih[24:], 2)
+	index := func(entries ...AVIIndexEntry) []byte {
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, entries)
+		return b.Bytes()
+	}
+	b := BuildRIFF(aviForm,
+		ChunkSpec{ID: "LIST", Form: "hdrl", Chunks: []ChunkSpec{
+			{ID: "avih", Data: avih},
+			{ID: "LIST", Form: "strl", Chunks: []ChunkSpec{{ID: "strh", Data: []byte("video")}}},
+			{ID: "LIST", Form: "strl", Chunks: []ChunkSpec{{ID: "strh", Data: []byte("audio")}}},
+		}},
+		ChunkSpec{ID: "LIST", Form: "movi", Chunks: []ChunkSpec{
+			{ID: "00dc", Data: []byte("frame1")},
+			{ID: "01wb", Data: []byte("aa")},
+			{ID: "LIST", Form: "rec ", Chunks: []ChunkSpec{{ID: "00dc", Data: []byte("f2")}}},
+			{ID: "01wb", Data: []byte("bbb")},
+		}},
+		ChunkSpec{ID: "idx1", Data: index(
+			AVIIndexEntry{NewID("00dc"), AVIIndexKeyFrame, 4, 6},
+			AVIIndexEntry{NewID("01wb"), 0, 18, 2},
+			AVIIndexEntry{NewID("00dc"), 0, 40, 2},
+			AVIIndexEntry{NewID("01wb"), 0, 50, 3},
+		)},
+	)
+	c, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	audio, err := c.ExtractStream(1)
+	if err != nil {
+		t.Fatalf("ExtractStream: %v", err)
+	}
+	binary.LittleEndian.PutUint32(avih[24:], 1)
+	exp := BuildRIFF(aviForm,
+		ChunkSpec{ID: "LIST", Form: "hdrl", Chunks: []ChunkSpec{
+			{ID: "avih", Data: avih},
+			{ID: "LIST", Form: "strl", Chunks: []ChunkSpec{{ID: "strh", Data: []byte("audio")}}},
+		}},
+		ChunkSpec{ID: "LIST", Form: "movi", Chunks: []ChunkSpec{
+			{ID: "00wb", Data: []byte("aa")},
+			{ID: "00wb", Data: []byte("bbb")},
+		}},
+		ChunkSpec{ID: "idx1", Data: index(
+			AVIIndexEntry{NewID("00wb"), 0, 4, 2},
+			AVIIndexEntry{NewID("00wb"), 0, 14, 3},
+		)},
+	)
+	got, err := audio.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, exp) {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+	if err := Validate(bytes.NewReader(got)); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	video, err := c.ExtractStream(0)
+	if err != nil {
+		t.Fatalf("ExtractStream(0): %v", err)
+	}
+	if rec := video.FindChunk(moviID, NewID("rec ")); rec == nil || len(rec.Chunks) != 1 {
+		t.Errorf("rec list of the video stream not kept: %v", video)
+	}
+	if _, err := c.ExtractStream(2); err == nil {
+		t.Errorf("expected error for a missing stream")
+	}
+
+	// Fixing the lengths of the extracted stream leaves c as it was.
+	strl := c.Chunks[0].Chunks[2]
+	strl.Chunks[0].Data = []byte("aud")
+	if _, err := c.ExtractStream(1); err != nil {
+		t.Fatalf("ExtractStream of an edited tree: %v", err)
+	}
+	if strl.Len != 18 || strl.Chunks[0].Len != 5 {
+		t.Errorf("ExtractStream changed the lengths of c to %v and %v", strl.Len, strl.Chunks[0].Len)
+	}
+	c.Chunks[0].Chunks = append(c.Chunks[0].Chunks, c)
+	if _, err := c.ExtractStream(1); err == nil {
+		t.Errorf("expected error for a cyclic tree")
+	}
+}
@@ -0,0 +1,88 @@
+package riff
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Handler receives the events generated by Decoder.Stream.
+type Handler interface {
+	// StartList is called when a container with the given id and form type
+	// starts.
+	StartList(id, formType ID)
+	// Chunk is called for every leaf chunk with a reader over its payload
+	// of length len. Any payload left unread is discarded after Chunk
+	// returns. An error stops the stream.
+	Chunk(id ID, r io.Reader, len uint32) error
+	// EndList is called once all the subchunks of the container with the
+	// given id have been streamed.
+	EndList(id ID)
+}
+
+// Stream reads the next chunk from the decoder's reader, calling h as
+// containers start and end and as leaf chunks are found, without building a
+// tree nor keeping any payload in memory. Registered DecoderFuncs aren't
+// called. Chunks are read as Decode reads them, following MaxDepth,
+// StrictIDs and Unpadded, and errors met in a chunk are DecodeErrors, but
+// Tolerant and Lenient don't apply.
+func (d *Decoder) Stream(h Handler) error {
+	err := d.stream(d.r, h, 0)
+	d.stop = nil
+	return err
+}
+
+// StreamContext is like Stream, but stops with the error of ctx if it is
+// done before a chunk is read, as DecodeContext does.
+func (d *Decoder) StreamContext(ctx context.Context, h Handler) error {
+	d.ctx = ctx
+	defer func() { d.ctx = nil }()
+	return d.Stream(h)
+}
+
+func (d *Decoder) stream(r io.Reader, h Handler, depth int) (err error) {
+	c := &Chunk{Offset: d.r.n}
+	defer func() {
+		if err != nil {
+			err = d.decodeError(c, depth, err)
+		}
+	}()
+	if err := d.chunkHeader(r, c); err != nil {
+		return err
+	}
+	if err := overrun(r, c); err != nil {
+		return err
+	}
+
+	if c.IsContainer() {
+		if err := d.formType(r, c, depth); err != nil {
+			return err
+		}
+		h.StartList(c.ID, c.ListID)
+		lr := &io.LimitedReader{R: r, N: int64(c.Len) - 4}
+		for n := 0; lr.N > 0; n++ {
+			if lr.N < 8 {
+				return fmt.Errorf("%v stray bytes after subchunk #%v", lr.N, n-1)
+			}
+			if err := d.stream(lr, h, depth+1); err != nil {
+				return fmt.Errorf("stream subchunk #%v: %w", n, err)
+			}
+		}
+		if _, err := d.pad(r, c); err != nil {
+			return err
+		}
+		h.EndList(c.ID)
+		return nil
+	}
+
+	payload := &io.LimitedReader{R: r, N: int64(c.Len)}
+	if err := h.Chunk(c.ID, payload, c.Len); err != nil {
+		d.stop = err
+		return err
+	}
+	if err := skip(payload, payload.N); err != nil {
+		return fmt.Errorf("skip data: %w", err)
+	}
+	_, err = d.pad(r, c)
+	return err
+}
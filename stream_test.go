@@ -0,0 +1,125 @@
+package riff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recorder is a Handler recording the events it receives.
+type recorder struct {
+	events []string
+	read   map[ID]int // bytes to read from each chunk, all if missing
+	fail   ID
+}
+
+func (r *recorder) StartList(id, form ID) {
+	r.events = append(r.events, fmt.Sprintf("start %s %s", id[:], form[:]))
+}
+
+func (r *recorder) Chunk(id ID, rd io.Reader, l uint32) error {
+	if id == r.fail {
+		return errors.New("fail")
+	}
+	var b []byte
+	var err error
+	if n, ok := r.read[id]; ok {
+		b = make([]byte, n)
+		_, err = io.ReadFull(rd, b)
+	} else {
+		b, err = ioutil.ReadAll(rd)
+	}
+	if err != nil {
+		return err
+	}
+	r.events = append(r.events, fmt.Sprintf("chunk %s %v %v", id[:], l, len(b)))
+	return nil
+}
+
+func (r *recorder) EndList(id ID) {
+	r.events = append(r.events, fmt.Sprintf("end %s", id[:]))
+}
+
+func TestStream(t *testing.T) {
+	f, err := os.Open("data/odd.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+
+	r := &recorder{read: map[ID]int{NewID("fmt "): 2, NewID("ISFT"): 0}}
+	if err := NewDecoder(f).Stream(r); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	exp := []string{
+		"start RIFF WAVE",
+		"chunk fmt  16 2",
+		"chunk data 7 7",
+		"start LIST INFO",
+		"chunk INAM 9 9",
+		"chunk ISFT 5 0",
+		"end LIST",
+		"end RIFF",
+	}
+	if !reflect.DeepEqual(r.events, exp) {
+		t.Errorf("got events\n%q\nexpected\n%q", r.events, exp)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	r = &recorder{fail: NewID("data")}
+	if err := NewDecoder(f).Stream(r); err == nil {
+		t.Errorf("expected the handler error to stop the stream")
+	}
+	if len(r.events) != 2 {
+		t.Errorf("got events %q after the error", r.events)
+	}
+}
+
+func TestStreamDecodeRules(t *testing.T) {
+	// The last odd-length leaf of a container may go without its pad byte.
+	leaf := leafBytes("abcd", []byte("xyz"))
+	b := listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 2)), leaf[:len(leaf)-1])
+	if _, err := NewDecoder(bytes.NewReader(b)).Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	r := &recorder{}
+	if err := NewDecoder(bytes.NewReader(b)).Stream(r); err != nil {
+		t.Fatalf("Stream of an unpadded last leaf: %v", err)
+	}
+	if exp := "chunk abcd 3 3"; len(r.events) != 4 || r.events[2] != exp {
+		t.Errorf("got events %q, expected %q third", r.events, exp)
+	}
+
+	nested := listBytes("RIFF", "WAVE", listBytes("LIST", "abcd", listBytes("LIST", "efgh")))
+	d := NewDecoder(bytes.NewReader(nested))
+	d.MaxDepth = 2
+	err := d.Stream(&recorder{})
+	if err == nil || !strings.Contains(err.Error(), "nesting depth exceeded") {
+		t.Errorf("got error %v streaming past MaxDepth", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Offset != 24 || de.ID != NewID("LIST") {
+		t.Errorf("got DecodeError %+v, expected the innermost LIST at offset 24", de)
+	}
+
+	d = NewDecoder(bytes.NewReader(listBytes("RIFF", "WAVE", leafBytes("ab\x01d", nil))))
+	d.StrictIDs = true
+	if err := d.Stream(&recorder{}); err == nil {
+		t.Errorf("expected StrictIDs to reject a non printable id")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewDecoder(bytes.NewReader(b)).StreamContext(ctx, &recorder{}); err != context.Canceled {
+		t.Errorf("got error %v streaming with a canceled context", err)
+	}
+}
@@ -0,0 +1,71 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// ReadCString reads a NUL terminated string from r, and returns it without
+// its terminator. If r ends before the terminator, the bytes read are
+// returned along with io.ErrUnexpectedEOF, or io.EOF if there were none.
+func ReadCString(r io.Reader) (string, error) {
+	var s []byte
+	var b [1]byte
+	for {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			if err == io.EOF && len(s) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return string(s), err
+		}
+		if b[0] == 0 {
+			return string(s), nil
+		}
+		s = append(s, b[0])
+	}
+}
+
+// ReadFixedString reads a string stored in a field of n bytes from r, as
+// found in most metadata chunks. The string ends at the first NUL byte, if
+// any, and its trailing spaces are removed.
+func ReadFixedString(r io.Reader, n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(bytes.TrimRight(b, " ")), nil
+}
+
+// DataUTF16 decodes the data of c as UTF-16 text, as written by Windows
+// tools. It is little endian unless it starts with a big endian byte order
+// mark; the byte order mark and any trailing NUL characters are removed.
+func (c *Chunk) DataUTF16() (string, error) {
+	b, err := c.loadedData()
+	if err != nil {
+		return "", err
+	}
+	if len(b)%2 != 0 {
+		return "", fmt.Errorf("%q data of odd length %v isn't UTF-16", c.ID, len(b))
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		b = b[2:]
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		b, order = b[2:], binary.BigEndian
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+	}
+	for len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u)), nil
+}
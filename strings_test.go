@@ -0,0 +1,77 @@
+package riff
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadCString(t *testing.T) {
+	r := bytes.NewReader([]byte("first\x00\x00last"))
+	for _, exp := range []struct {
+		s   string
+		err error
+	}{
+		{"first", nil},
+		{"", nil},
+		{"last", io.ErrUnexpectedEOF},
+		{"", io.EOF},
+	} {
+		if s, err := ReadCString(r); s != exp.s || err != exp.err {
+			t.Errorf("got %q, %v, expected %q, %v", s, err, exp.s, exp.err)
+		}
+	}
+}
+
+func TestReadFixedString(t *testing.T) {
+	for _, tt := range []struct {
+		in  string
+		n   int
+		exp string
+	}{
+		{"name\x00\x00\x00\x00", 8, "name"},
+		{"name\x00junk", 9, "name"},
+		{"padded  ", 8, "padded"},
+		{"  lead\x00 ", 8, "  lead"},
+		{"full", 4, "full"},
+		{"\x00\x00", 2, ""},
+		{"more text", 4, "more"},
+	} {
+		r := bytes.NewReader([]byte(tt.in))
+		s, err := ReadFixedString(r, tt.n)
+		if err != nil || s != tt.exp {
+			t.Errorf("%q: got %q, %v, expected %q", tt.in, s, err, tt.exp)
+		}
+		if r.Len() != len(tt.in)-tt.n {
+			t.Errorf("%q: %v bytes left, expected %v", tt.in, r.Len(), len(tt.in)-tt.n)
+		}
+	}
+	if _, err := ReadFixedString(bytes.NewReader([]byte("short")), 8); err != io.ErrUnexpectedEOF {
+		t.Errorf("short field: got %v, expected io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDataUTF16(t *testing.T) {
+	for _, tt := range []struct {
+		data []byte
+		exp  string
+	}{
+		{[]byte("T\x00i\x00t\x00l\x00e\x00"), "Title"},
+		{[]byte("\xff\xfeT\x00\xe9\x00\x00\x00\x00\x00"), "Té"},
+		{[]byte("\xfe\xff\x00T\x00\xe9"), "Té"},
+		{[]byte("\x3d\xd8\xb5\xdc"), "\U0001f4b5"},
+		{nil, ""},
+	} {
+		c := &Chunk{ID: NewID("DISP"), Data: tt.data}
+		got, err := c.DataUTF16()
+		if err != nil || got != tt.exp {
+			t.Errorf("%q: got %q, %v, expected %q", tt.data, got, err, tt.exp)
+		}
+	}
+	if _, err := (&Chunk{Data: []byte("odd")}).DataUTF16(); err == nil {
+		t.Errorf("expected error for odd length data")
+	}
+	if _, err := (&Chunk{ID: NewID("DISP"), Len: 4}).DataUTF16(); err == nil {
+		t.Errorf("expected error for a chunk without data")
+	}
+}
@@ -0,0 +1,140 @@
+package riff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestTolerant(t *testing.T) {
+	overrun := listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 16)), leafBytes("data", make([]byte, 10)))
+	overrun[len(overrun)-14] = 100 // data claims 100 bytes
+
+	truncated := listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 16)), leafBytes("data", make([]byte, 500)))[:56]
+
+	badList := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		[]byte("LIST\x02\x00\x00\x00ab"),
+		leafBytes("data", make([]byte, 4)),
+	)
+
+	for _, tt := range []struct {
+		name   string
+		file   []byte
+		errs   int
+		chunks int
+		len    uint32
+	}{
+		{"overrun", overrun, 1, 2, 4 + 24 + 18},
+		{"truncated", truncated, 2, 2, 4 + 24 + 20},
+		{"bad list", badList, 1, 1, 4 + 24},
+	} {
+		if _, err := NewDecoder(bytes.NewReader(tt.file)).Decode(); err == nil {
+			t.Errorf("%v: expected error when not tolerant", tt.name)
+		}
+
+		d := NewDecoder(bytes.NewReader(tt.file))
+		d.Tolerant = true
+		c, err := d.Decode()
+		if err != nil {
+			t.Errorf("%v: Decode: %v", tt.name, err)
+			continue
+		}
+		if len(d.Errors()) != tt.errs {
+			t.Errorf("%v: got errors %v, expected %v errors", tt.name, d.Errors(), tt.errs)
+		}
+		if len(c.Chunks) != tt.chunks || c.Len != tt.len {
+			t.Errorf("%v: got %v chunks and length %v, expected %v and %v", tt.name, len(c.Chunks), c.Len, tt.chunks, tt.len)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := c.WriteTo(buf); err != nil {
+			t.Fatalf("%v: WriteTo: %v", tt.name, err)
+		}
+		if err := Validate(buf); err != nil {
+			t.Errorf("%v: salvaged tree is invalid: %v", tt.name, err)
+		}
+	}
+
+	d := NewDecoder(bytes.NewReader(truncated))
+	d.Tolerant = true
+	c, _ := d.Decode()
+	if data := c.FindChunk(NewID("data")); data == nil || len(data.Data) != 12 {
+		t.Errorf("truncated data chunk: got %v", data)
+	}
+	if !errors.Is(d.Errors()[0], io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, expected io.ErrUnexpectedEOF", d.Errors()[0])
+	}
+
+	d = NewDecoder(bytes.NewReader(overrun))
+	d.Tolerant = true
+	d.Map(NewID("fmt "), func(io.Reader) (interface{}, error) { return nil, errors.New("bad fmt") })
+	d.MapVerify(NewID("data"), func(*Chunk) error { return errors.New("bad data") })
+	if _, err := d.Decode(); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(d.Errors()) != 3 {
+		t.Errorf("got errors %v, expected 3", d.Errors())
+	}
+	if _, err := d.Decode(); err != io.EOF || d.Errors() != nil {
+		t.Errorf("second Decode: got %v with errors %v", err, d.Errors())
+	}
+}
+
+func TestLenient(t *testing.T) {
+	b := listBytes("RIFF", "WAVE",
+		leafBytes("fmt ", make([]byte, 16)),
+		listBytes("LIST", "INFO", leafBytes("INAM", []byte("name"))),
+		leafBytes("data", make([]byte, 7)),
+	)
+	b[52] = 5               // INAM claims 5 bytes of the 4 left in INFO
+	b[len(b)-12] = 100      // data claims 100 bytes
+	b = b[:len(b)-1]        // without the pad byte of data
+	b[4] = byte(len(b) - 8) // which the RIFF length doesn't count
+	if _, err := NewDecoder(bytes.NewReader(b)).Decode(); err == nil {
+		t.Errorf("expected error when not lenient")
+	}
+
+	d := NewDecoder(bytes.NewReader(b))
+	d.Lenient = true
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if errs := d.Errors(); errs != nil {
+		t.Errorf("got errors %v, expected none", errs)
+	}
+	for _, tt := range []struct {
+		c             *Chunk
+		len, declared uint32
+		clamped       bool
+	}{
+		{c.FindChunk(NewID("fmt ")), 16, 16, false},
+		{c.FindChunk(NewID("INFO"), NewID("INAM")), 4, 5, true},
+		{c.FindChunk(NewID("data")), 7, 100, true},
+	} {
+		declared, ok := tt.c.Clamped()
+		if tt.c.Len != tt.len || ok != tt.clamped || ok && declared != tt.declared {
+			t.Errorf("%q: got length %v, declared %v, clamped %v, expected %v, %v, %v", tt.c.ID, tt.c.Len, declared, ok, tt.len, tt.declared, tt.clamped)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	again, err := NewDecoder(buf).Decode()
+	if err != nil {
+		t.Fatalf("decode the written file: %v", err)
+	}
+	if !again.Equal(c) {
+		t.Errorf("written file decoded as %v, expected %v", again, c)
+	}
+
+	bad := listBytes("RIFF", "WAVE", []byte("LIST\x02\x00\x00\x00ab"))
+	d = NewDecoder(bytes.NewReader(bad))
+	d.Lenient = true
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected error for a broken LIST when lenient")
+	}
+}
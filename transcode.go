@@ -0,0 +1,140 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// TranscodeOptions are the conversions made by Transcode.
+type TranscodeOptions struct {
+	// BigEndian makes Transcode write a RIFX stream rather than a RIFF one.
+	// The numeric fields of the "fmt ", "fact" and "cue " chunks are byte
+	// swapped as by ToBigEndian and ToLittleEndian.
+	BigEndian bool
+	// StripJunk drops the padding chunks, "JUNK", "junk", "PAD " and "FLLR".
+	StripJunk bool
+}
+
+// Transcode copies the RIFF or RIFX stream read from r to w, converting it
+// as set by opts, one chunk at a time, so that only the data of the chunks
+// whose byte order is swapped is ever held in memory.
+//
+// If w is an io.WriteSeeker, the length of every container is written once
+// its subchunks have been, seeking back to its header, so lengths are
+// recomputed and odd-length chunks always padded. Otherwise lengths are
+// copied as read, which is only possible if no chunk is stripped.
+func Transcode(r io.Reader, w io.Writer, opts TranscodeOptions) error {
+	ws, seek := w.(io.WriteSeeker)
+	if opts.StripJunk && !seek {
+		return fmt.Errorf("Transcode needs an io.WriteSeeker to strip chunks, got %T", w)
+	}
+	s := NewChunkScanner(r)
+	s.Recurse = true
+	ok := s.Scan()
+	if s.root == nil {
+		if err := s.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	var in binary.ByteOrder = binary.LittleEndian
+	if s.root.ID == rifx {
+		in = binary.BigEndian
+	}
+	swap := (s.root.ID == rifx) != opts.BigEndian
+
+	out := &writer{w: w, bigEndian: opts.BigEndian}
+	var open []int64 // offsets in w of the headers of the containers being written
+	start := func(id, form ID, l uint32) {
+		open = append(open, out.n)
+		out.Write(id[:])
+		out.writeUint32(l)
+		out.Write(form[:])
+	}
+	end := func() error {
+		start := open[len(open)-1]
+		open = open[:len(open)-1]
+		l := out.n - start - 8
+		if l%2 != 0 && len(open) > 0 {
+			out.Write([]byte{0})
+		}
+		if !seek || out.err != nil {
+			return out.err
+		}
+		pos := out.n
+		var b [4]byte
+		if opts.BigEndian {
+			binary.BigEndian.PutUint32(b[:], uint32(l))
+		} else {
+			binary.LittleEndian.PutUint32(b[:], uint32(l))
+		}
+		if _, err := ws.Seek(start+4-pos, io.SeekCurrent); err != nil {
+			return err
+		}
+		if _, err := ws.Write(b[:]); err != nil {
+			return err
+		}
+		_, err := ws.Seek(pos-start-8, io.SeekCurrent)
+		return err
+	}
+
+	id := riff
+	if opts.BigEndian {
+		id = rifx
+	}
+	start(id, s.root.ListID, s.root.Len)
+	for ; ok; ok = s.Scan() {
+		c := s.Chunk()
+		for len(open) > s.Depth()+1 {
+			if err := end(); err != nil {
+				return err
+			}
+		}
+		if c.IsContainer() {
+			start(c.ID, c.ListID, c.Len)
+			continue
+		}
+		if opts.StripJunk && junkIDs[c.ID] {
+			continue
+		}
+
+		out.Write(c.ID[:])
+		out.writeUint32(c.Len)
+		var n int64
+		if _, ok := fieldLayouts[c.ID]; ok && swap {
+			data, err := ioutil.ReadAll(s.Reader())
+			if err != nil {
+				return fmt.Errorf("read %q: %v", c.ID, err)
+			}
+			out.Write((&Chunk{ID: c.ID, Data: data}).swapped(in).Data)
+			n = int64(len(data))
+		} else if out.err == nil {
+			var err error
+			if n, err = io.Copy(out, s.Reader()); err != nil && out.err == nil {
+				return fmt.Errorf("read %q: %v", c.ID, err)
+			}
+		}
+		if out.err != nil {
+			return out.err
+		}
+		if n < int64(c.Len) {
+			return fmt.Errorf("read %q: %w", c.ID, io.ErrUnexpectedEOF)
+		}
+		// Without seeking, pad bytes are only written where the lengths
+		// read account for them.
+		if c.Len%2 != 0 && (seek || s.stack[len(s.stack)-1].r.N > 0) {
+			out.Write([]byte{0})
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	for len(open) > 0 {
+		if err := end(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
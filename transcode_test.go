@@ -0,0 +1,70 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranscode(t *testing.T) {
+	file := func(build func(ID, ...ChunkSpec) []byte, order binary.AppendByteOrder, junk bool) []byte {
+		f := order.AppendUint16(nil, WaveFormatPCM)
+		f = order.AppendUint16(f, 1)
+		f = order.AppendUint32(f, 8000)
+		f = order.AppendUint32(f, 8000)
+		f = order.AppendUint16(f, 1)
+		f = order.AppendUint16(f, 8)
+		specs := []ChunkSpec{
+			{ID: "fmt ", Data: f},
+			{ID: "fact", Data: order.AppendUint32(nil, 3)},
+			{ID: "JUNK", Data: make([]byte, 5)},
+			{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("odd")}}},
+			{ID: "data", Data: []byte{1, 2, 3}},
+		}
+		if !junk {
+			specs = append(specs[:2], specs[3:]...)
+		}
+		return build(NewID("WAVE"), specs...)
+	}
+	be := file(BuildRIFX, binary.BigEndian, true)
+
+	buf := new(bytes.Buffer)
+	if err := Transcode(bytes.NewReader(be), buf, TranscodeOptions{}); err != nil {
+		t.Fatalf("Transcode: %v", err)
+	}
+	if exp := file(BuildRIFF, binary.LittleEndian, true); !bytes.Equal(buf.Bytes(), exp) {
+		t.Errorf("got %q, expected %q", buf.Bytes(), exp)
+	}
+	buf.Reset()
+	if err := Transcode(bytes.NewReader(be), buf, TranscodeOptions{BigEndian: true}); err != nil || !bytes.Equal(buf.Bytes(), be) {
+		t.Errorf("RIFX transcoded to RIFX as %q, %v; expected it unchanged", buf.Bytes(), err)
+	}
+	if err := Transcode(bytes.NewReader(be), buf, TranscodeOptions{StripJunk: true}); err == nil {
+		t.Errorf("expected error stripping chunks to a writer that can't seek")
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("prefix")
+	if err := Transcode(bytes.NewReader(be), f, TranscodeOptions{StripJunk: true}); err != nil {
+		t.Fatalf("Transcode stripping junk: %v", err)
+	}
+	f.WriteString("suffix")
+	got, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := "prefix" + string(file(BuildRIFF, binary.LittleEndian, false)) + "suffix"; string(got) != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+
+	if err := Transcode(bytes.NewReader(be[:len(be)-4]), new(bytes.Buffer), TranscodeOptions{}); err == nil {
+		t.Errorf("expected error transcoding a truncated stream")
+	}
+}
@@ -0,0 +1,330 @@
+package riff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Validate walks the whole RIFF structure read from r verifying that every
+// chunk fits in its container and that every chunk is word aligned. RIFX
+// files are read with big endian lengths. Payloads are discarded as they are
+// read, so at most one chunk header is held in memory at any time. The first
+// structural error found is returned, prefixed with the offset in the
+// stream at which it was detected.
+//
+// RF64 files are validated using the sizes held by the ds64 chunk they
+// start with for the RF64 and data chunks whose length is 0xFFFFFFFF.
+//
+// Files whose RIFF length is 8 bytes off, because their encoder counted the
+// chunk header in it or subtracted it twice, are reported as such.
+func Validate(r io.Reader) error {
+	_, err := ValidateWithOptions(r, ValidateOptions{})
+	return err
+}
+
+// ValidateOptions changes what ValidateWithOptions considers an error.
+type ValidateOptions struct {
+	// StrictLengths makes any chunk length with its high bit set an error.
+	// No legitimate chunk is 2GiB or longer, so such a length is most
+	// likely a negative size written by a buggy encoder.
+	StrictLengths bool
+}
+
+// ValidateWithOptions is like Validate, but also returns warnings about
+// suspicious yet valid chunks, each prefixed with its offset. Chunk lengths
+// with their high bit set are warned about, or are an error if
+// o.StrictLengths is set.
+func ValidateWithOptions(r io.Reader, o ValidateOptions) (warnings []string, err error) {
+	v := &validator{r: r, rf64Data: -1, strictLengths: o.StrictLengths}
+	err = v.validate()
+	return v.warnings, err
+}
+
+func (v *validator) validate() error {
+	id, l, err := v.header()
+	if err != nil {
+		return v.errorf(0, "read header: %v", err)
+	}
+	if id != riff && id != rifx && id != rf64ID {
+		return v.errorf(0, "not a RIFF file, top-level id is %q", id)
+	}
+	if id != rf64ID || l != math.MaxUint32 {
+		if err := v.checkLen(0, id, l); err != nil {
+			return err
+		}
+	}
+	if err := v.push(id, 0, l); err != nil {
+		return err
+	}
+	v.rootLen = l
+	if id == rf64ID {
+		if err := v.ds64(); err != nil {
+			return err
+		}
+	}
+
+	for len(v.stack) > 0 {
+		top := &v.stack[len(v.stack)-1]
+		if top.left == 0 {
+			v.stack = v.stack[:len(v.stack)-1]
+			if err := v.skip(top.pad); err != nil {
+				return v.errorf(v.off, "read %q pad: %v", top.id, err)
+			}
+			continue
+		}
+
+		start := v.off
+		if top.left < 8 {
+			return v.errorf(start, "%d stray bytes at the end of %q", top.left, top.id)
+		}
+		id, l, err := v.header()
+		if err == io.EOF && len(v.stack) == 1 && v.rf64Data < 0 && top.left == 8 {
+			return v.errorf(0, "RIFF length %v is 8 bytes too long, the encoder counted the chunk header", v.rootLen)
+		}
+		if err != nil {
+			return v.errorf(start, "read chunk header: %v", err)
+		}
+		n := int64(l)
+		if v.rf64Data >= 0 && id == dataID && l == math.MaxUint32 {
+			n = v.rf64Data
+		} else if err := v.checkLen(start, id, l); err != nil {
+			return err
+		}
+		size := n + n%2
+		if n%2 != 0 && 8+n == top.left {
+			size = n // its pad byte follows the container instead, as Decoder allows
+		}
+		if 8+size > top.left {
+			if len(v.stack) == 1 && v.rf64Data < 0 && 8+size-top.left == 8 && v.skip(size) == nil && v.atEOF() {
+				return v.errorf(0, "RIFF length %v is 8 bytes too short, the encoder subtracted the chunk header twice", v.rootLen)
+			}
+			if n == int64(l) && l&highBit != 0 {
+				return v.errorf(start, "chunk %q of length %v overruns %q by %v bytes, the length may be the negative size %v", id, l, top.id, 8+size-top.left, int32(l))
+			}
+			return v.errorf(start, "chunk %q of length %v overruns %q by %v bytes", id, n, top.id, 8+size-top.left)
+		}
+		top.left -= 8 + size
+
+		if isContainer(id) {
+			if err := v.push(id, start, l); err != nil {
+				return err
+			}
+			v.stack[len(v.stack)-1].pad = size - n
+			continue
+		}
+		if err := v.skip(size); err != nil {
+			return v.errorf(start, "read %q payload: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// span is a container whose children are still being validated.
+type span struct {
+	id   ID
+	left int64 // bytes of children not yet read
+	pad  int64 // pad bytes following the container
+}
+
+type validator struct {
+	r       io.Reader
+	off     int64
+	stack   []span
+	rootLen uint32 // length of the RIFF chunk
+	// rf64Data is the data chunk size held by the ds64 chunk of an RF64
+	// file, or -1.
+	rf64Data int64
+
+	bigEndian bool // lengths are big endian, as in RIFX files
+
+	strictLengths bool
+	warnings      []string
+}
+
+// highBit is the high bit of a chunk length, set in negative sizes.
+const highBit = 1 << 31
+
+// checkLen warns about the length l of the chunk id starting at off if its
+// high bit is set, or fails if lengths are strict.
+func (v *validator) checkLen(off int64, id ID, l uint32) error {
+	if l&highBit == 0 {
+		return nil
+	}
+	if v.strictLengths {
+		return v.errorf(off, "chunk %q length %v has its high bit set, it may be the negative size %v", id, l, int32(l))
+	}
+	v.warnings = append(v.warnings, fmt.Sprintf("offset %v: chunk %q length %v has its high bit set", off, id, l))
+	return nil
+}
+
+func (v *validator) errorf(off int64, format string, args ...interface{}) error {
+	return fmt.Errorf("offset %v: %v", off, fmt.Sprintf(format, args...))
+}
+
+// header reads the ID and length of the next chunk, in the byte order of
+// the RIFF or RIFX chunk holding it, as Decoder does.
+func (v *validator) header() (ID, uint32, error) {
+	var b [8]byte
+	n, err := io.ReadFull(v.r, b[:])
+	v.off += int64(n)
+	if err != nil {
+		return ID{}, 0, err
+	}
+	var id ID
+	copy(id[:], b[:4])
+	if id == riff || id == rifx || id == rf64ID {
+		v.bigEndian = id == rifx
+	}
+	if v.bigEndian {
+		return id, binary.BigEndian.Uint32(b[4:]), nil
+	}
+	return id, binary.LittleEndian.Uint32(b[4:]), nil
+}
+
+// ds64 reads the ds64 chunk an RF64 file starts with, right after the form
+// type of its RF64 chunk. The RF64 size it holds replaces the length of the
+// RF64 chunk if that is 0xFFFFFFFF, and its data size is kept for the data
+// chunk.
+func (v *validator) ds64() error {
+	start := v.off
+	id, l, err := v.header()
+	if err != nil {
+		return v.errorf(start, "read ds64 chunk header: %v", err)
+	}
+	if id != ds64ID {
+		return v.errorf(start, "RF64 file starts with %q instead of a ds64 chunk", id)
+	}
+	if l < 16 {
+		return v.errorf(start, "%q chunk of %v bytes has no room for the RF64 and data sizes", id, l)
+	}
+	var b [16]byte
+	n, err := io.ReadFull(v.r, b[:])
+	v.off += int64(n)
+	if err != nil {
+		return v.errorf(start, "read %q payload: %v", id, err)
+	}
+	if err := v.skip(int64(l) - 16 + int64(l%2)); err != nil {
+		return v.errorf(start, "read %q payload: %v", id, err)
+	}
+	size := int64(8 + l + l%2)
+	top := &v.stack[0]
+	if v.rootLen == math.MaxUint32 {
+		rf64 := binary.LittleEndian.Uint64(b[:])
+		if rf64 < uint64(4+size) || rf64 > math.MaxInt64 {
+			return v.errorf(0, "RF64 size %v is shorter than its form type and %q chunk", rf64, id)
+		}
+		top.left = int64(rf64) - 4
+	}
+	if size > top.left {
+		return v.errorf(start, "chunk %q of length %v overruns %q by %v bytes", id, l, top.id, size-top.left)
+	}
+	top.left -= size
+	data := binary.LittleEndian.Uint64(b[8:])
+	if data >= math.MaxInt64 {
+		return v.errorf(start, "data size %v in the %q chunk is too large", data, id)
+	}
+	v.rf64Data = int64(data)
+	return nil
+}
+
+// push reads the form type of the container starting at off and makes it
+// the container whose children are validated next. Its length may be odd
+// if its last child is, as that child's pad byte then follows the
+// container. The length of an RF64 chunk may be 0xFFFFFFFF, to be replaced
+// by the size in its ds64 chunk.
+func (v *validator) push(id ID, off int64, l uint32) error {
+	if l < 4 {
+		return v.errorf(off, "container %q of length %v has no room for a form type", id, l)
+	}
+	var form ID
+	n, err := io.ReadFull(v.r, form[:])
+	v.off += int64(n)
+	if err != nil {
+		return v.errorf(off, "read %q form type: %v", id, err)
+	}
+	v.stack = append(v.stack, span{id: form, left: int64(l) - 4})
+	return nil
+}
+
+// skip discards the next n bytes of the stream.
+func (v *validator) skip(n int64) error {
+	m, err := io.CopyN(io.Discard, v.r, n)
+	v.off += m
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// atEOF reports whether the stream has no more bytes.
+func (v *validator) atEOF() bool {
+	var b [1]byte
+	n, err := io.ReadFull(v.r, b[:])
+	v.off += int64(n)
+	return err == io.EOF
+}
+
+// VerifyAlignment checks that every chunk in the tree rooted at c starts on
+// an even offset once written with WriteTo, as RIFF requires. Offsets are
+// computed from what WriteTo emits, so a leaf whose Data has odd length but
+// whose Len is even, and therefore gets no pad byte, misaligns every chunk
+// written after it. The first misaligned chunk is reported. A chunk
+// containing itself is an error.
+func (c *Chunk) VerifyAlignment() error {
+	if _, err := c.MaxDepth(); err != nil {
+		return err
+	}
+	_, err := c.verifyAlignment(0)
+	return err
+}
+
+// verifyAlignment checks the alignment of c written at offset off, and
+// returns the offset following it.
+func (c *Chunk) verifyAlignment(off int64) (int64, error) {
+	if off%2 != 0 {
+		return 0, fmt.Errorf("chunk %q at offset %v is not word aligned", c.ID, off)
+	}
+	if !c.IsContainer() {
+		return off + 8 + c.dataLen() + int64(c.Len%2), nil
+	}
+	off += 12
+	for _, sc := range c.Chunks {
+		var err error
+		if off, err = sc.verifyAlignment(off); err != nil {
+			return 0, err
+		}
+	}
+	return off, nil
+}
+
+// CheckContainerLength checks that the length of every container in the
+// tree rooted at c is exactly 4 bytes of form type plus the sizes of its
+// subchunks, header and pad byte included, as given by their Len. This
+// catches containers whose declared length disagrees with their contents,
+// such as ones decoded in Tolerant mode. The first mismatch is reported. A
+// chunk containing itself is an error.
+func (c *Chunk) CheckContainerLength() error {
+	if _, err := c.MaxDepth(); err != nil {
+		return err
+	}
+	return c.checkContainerLength()
+}
+
+func (c *Chunk) checkContainerLength() error {
+	if !c.IsContainer() {
+		return nil
+	}
+	exp := int64(4)
+	for _, sc := range c.Chunks {
+		if err := sc.checkContainerLength(); err != nil {
+			return err
+		}
+		exp += 8 + int64(sc.Len) + int64(sc.Len%2)
+	}
+	if int64(c.Len) != exp {
+		return fmt.Errorf("container %q of form type %q has length %v, but its subchunks add up to %v", c.ID, c.ListID, c.Len, exp)
+	}
+	return nil
+}
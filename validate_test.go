@@ -0,0 +1,203 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	if err := Validate(bytes.NewReader(b)); err != nil {
+		t.Errorf("Validate(hand.wav): %v", err)
+	}
+
+	odd := listBytes("RIFF", "TEST", leafBytes("odd ", []byte("abc")), leafBytes("next", nil))
+	if err := Validate(bytes.NewReader(odd)); err != nil {
+		t.Errorf("Validate(odd): %v", err)
+	}
+	rifx := BuildRIFX(NewID("TEST"), ChunkSpec{ID: "odd ", Data: []byte("abc")}, ChunkSpec{ID: "LIST", Form: "INFO", Chunks: []ChunkSpec{{ID: "INAM", Data: []byte("x")}}})
+	if err := Validate(bytes.NewReader(rifx)); err != nil {
+		t.Errorf("Validate(rifx): %v", err)
+	}
+
+	// A last odd-length chunk whose pad byte isn't counted in the lengths
+	// of its containers, nor written at the end of the file, is accepted
+	// as Decoder does.
+	unpadded := odd[:len(odd)-8-1]
+	binary.LittleEndian.PutUint32(unpadded[4:], uint32(len(unpadded)-8))
+	nested := listBytes("RIFF", "TEST", leafBytes("LIST", append([]byte("INFO"), unpadded[12:]...)), leafBytes("next", nil))
+	for name, b := range map[string][]byte{"unpadded": unpadded, "nested unpadded": nested} {
+		if _, err := NewDecoder(bytes.NewReader(b)).Decode(); err != nil {
+			t.Errorf("Decode(%v): %v", name, err)
+		}
+		if err := Validate(bytes.NewReader(b)); err != nil {
+			t.Errorf("Validate(%v): %v", name, err)
+		}
+	}
+	rifxOverrun := append([]byte(nil), rifx...)
+	rifxOverrun[18] = 1 // odd length now 259, past the container
+
+	overrun := listBytes("RIFF", "TEST", leafBytes("data", []byte("abcd")))
+	overrun[16] = 6 // data length now claims two bytes past the container
+	tests := []struct {
+		name string
+		data []byte
+		msg  string
+	}{
+		{"truncated", b[:1000], "offset 62"},
+		{"not riff", append([]byte("JUNK"), b[4:]...), "offset 0"},
+		{"little endian rifx", append([]byte("RIFX"), b[4:]...), "overruns"},
+		{"rifx overrun", rifxOverrun, "offset 12"},
+		{"overrun", overrun, "offset 12"},
+		{"length includes header", withRIFFLen(b, 7944+8), "8 bytes too long"},
+		{"length misses header", withRIFFLen(b, 7944-8), "8 bytes too short"},
+		{"stray", append(listBytes("RIFF", "TEST", leafBytes("data", nil))[:4], 7, 0, 0, 0, 'T', 'E', 'S', 'T', 1, 2, 3), "3 stray bytes"},
+	}
+	for _, test := range tests {
+		err := Validate(bytes.NewReader(test.data))
+		if err == nil {
+			t.Errorf("%v: expected error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.msg) {
+			t.Errorf("%v: error %q doesn't mention %q", test.name, err, test.msg)
+		}
+	}
+}
+
+func TestValidateRF64(t *testing.T) {
+	c := decodeFile(t, "data/hand.wav")
+	buf := new(bytes.Buffer)
+	e := NewEncoder(buf)
+	e.RF64 = true
+	if err := e.Encode(c); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	b := buf.Bytes()
+	warnings, err := ValidateWithOptions(bytes.NewReader(b), ValidateOptions{StrictLengths: true})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("Validate(rf64): got %q, %v", warnings, err)
+	}
+
+	short := append([]byte{}, b...)
+	binary.LittleEndian.PutUint64(short[20:], 7944+36-2) // RF64 size
+	long := append([]byte{}, b...)
+	binary.LittleEndian.PutUint64(long[28:], 1<<32) // data size
+	noDS64 := append([]byte{}, b...)
+	copy(noDS64[12:], "JUNK")
+	tests := []struct {
+		name string
+		data []byte
+		msg  string
+	}{
+		{"short rf64 size", short, `overruns "WAVE" by 2 bytes`},
+		{"long data size", long, `chunk "data" of length 4294967296 overruns "WAVE"`},
+		{"no ds64", noDS64, `instead of a ds64 chunk`},
+		{"truncated", b[:30], `read "ds64" payload`},
+	}
+	for _, test := range tests {
+		err := Validate(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.msg) {
+			t.Errorf("%v: got error %v, expected one mentioning %q", test.name, err, test.msg)
+		}
+	}
+}
+
+// withRIFFLen returns a copy of the file b with its RIFF length set to l.
+func withRIFFLen(b []byte, l uint32) []byte {
+	b = append([]byte{}, b...)
+	binary.LittleEndian.PutUint32(b[4:], l)
+	return b
+}
+
+func TestVerifyAlignment(t *testing.T) {
+	f, err := os.Open("data/odd.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+	c, err := NewDecoder(f).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if err := c.VerifyAlignment(); err != nil {
+		t.Errorf("VerifyAlignment: %v", err)
+	}
+
+	// Give data an even length without changing its odd-sized payload.
+	c.Chunks[1].Len++
+	err = c.VerifyAlignment()
+	if err == nil || !strings.Contains(err.Error(), `"LIST" at offset 51`) {
+		t.Errorf("expected LIST to be misaligned, got %v", err)
+	}
+}
+
+func TestValidateHighBitLength(t *testing.T) {
+	negative := listBytes("RIFF", "TEST", leafBytes("data", []byte("abcd")))
+	binary.LittleEndian.PutUint32(negative[16:], uint32(0xfffffffc)) // -4
+	if err := Validate(bytes.NewReader(negative)); err == nil || !strings.Contains(err.Error(), "negative size -4") {
+		t.Errorf("got error %v, expected a negative size", err)
+	}
+
+	// A RIFF length with its high bit set that fits a 2GiB+ file isn't an
+	// error, but is worth a warning. The file here is truncated, so the
+	// validation fails once the warning is recorded.
+	huge := withRIFFLen(listBytes("RIFF", "TEST"), highBit|4)
+	warnings, err := ValidateWithOptions(bytes.NewReader(huge), ValidateOptions{})
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "high bit") {
+		t.Errorf("got warnings %q, expected one about the high bit", warnings)
+	}
+	if err == nil || strings.Contains(err.Error(), "high bit") {
+		t.Errorf("got error %v, expected one about truncation", err)
+	}
+	_, err = ValidateWithOptions(bytes.NewReader(huge), ValidateOptions{StrictLengths: true})
+	if err == nil || !strings.Contains(err.Error(), "offset 0: chunk \"RIFF\" length 2147483652 has its high bit set") {
+		t.Errorf("strict: got error %v", err)
+	}
+
+	warnings, err = ValidateWithOptions(bytes.NewReader(listBytes("RIFF", "TEST")), ValidateOptions{StrictLengths: true})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("valid file: got %q, %v", warnings, err)
+	}
+}
+
+func TestCheckContainerLength(t *testing.T) {
+	c := decodeFile(t, "data/odd.wav")
+	if err := c.CheckContainerLength(); err != nil {
+		t.Errorf("CheckContainerLength: %v", err)
+	}
+
+	info := &Chunk{ID: list, ListID: NewID("INFO"), Len: 20, Chunks: []*Chunk{
+		{ID: NewID("INAM"), Len: 3, Data: []byte("abc")},
+	}}
+	c = &Chunk{ID: riff, ListID: NewID("WAVE"), Len: 4 + 8 + 20, Chunks: []*Chunk{info}}
+	err := c.CheckContainerLength()
+	if err == nil || !strings.Contains(err.Error(), `"INFO" has length 20, but its subchunks add up to 16`) {
+		t.Errorf("expected the INFO length to be reported, got %v", err)
+	}
+	info.Len, c.Len = 16, 4+8+16
+	if err := c.CheckContainerLength(); err != nil {
+		t.Errorf("CheckContainerLength: %v", err)
+	}
+	c.Len++
+	if err := c.CheckContainerLength(); err == nil || !strings.Contains(err.Error(), `"WAVE" has length 29`) {
+		t.Errorf("expected the RIFF length to be reported, got %v", err)
+	}
+}
+
+func TestVerifyCyclic(t *testing.T) {
+	c := cyclicTree()
+	if err := c.CheckContainerLength(); err == nil || !strings.Contains(err.Error(), "contains itself") {
+		t.Errorf("CheckContainerLength of a cyclic tree: %v", err)
+	}
+	if err := c.VerifyAlignment(); err == nil || !strings.Contains(err.Error(), "contains itself") {
+		t.Errorf("VerifyAlignment of a cyclic tree: %v", err)
+	}
+}
@@ -0,0 +1,542 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+)
+
+var (
+	wave   = NewID("WAVE")
+	info   = NewID("INFO")
+	fmtID  = NewID("fmt ")
+	dataID = NewID("data")
+	factID = NewID("fact")
+)
+
+// Format tags of WaveFmt.
+const (
+	WaveFormatPCM        = 0x0001
+	WaveFormatIEEEFloat  = 0x0003
+	WaveFormatMPEGLayer3 = 0x0055
+	WaveFormatExtensible = 0xFFFE
+)
+
+// WaveFmt is the content of the "fmt " chunk of a WAV file.
+type WaveFmt struct {
+	FormatTag     uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32 // Average bytes per second
+	BlockAlign    uint16 // Bytes per sample frame, all channels included
+	BitsPerSample uint16
+	Extra         []byte // Format specific bytes following cbSize, if any
+
+	// Fields of the WAVEFORMATEXTENSIBLE layout, decoded from Extra when
+	// FormatTag is WaveFormatExtensible. The encoder writes Extra instead.
+	ValidBitsPerSample uint16   // Bits of precision in each sample
+	ChannelMask        uint32   // Speaker positions of the channels
+	SubFormat          [16]byte // GUID of the format, see Format
+}
+
+// subFormatBase is the GUID of extensible subformats past their first
+// two bytes, which hold a format tag.
+var subFormatBase = [14]byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71}
+
+// Format returns the format tag of the audio of f: FormatTag, or for the
+// extensible layout the format tag its SubFormat GUID is derived from, such
+// as WaveFormatPCM or WaveFormatIEEEFloat. It returns WaveFormatExtensible
+// if SubFormat is not derived from a format tag.
+func (f WaveFmt) Format() uint16 {
+	if f.FormatTag != WaveFormatExtensible || !bytes.Equal(f.SubFormat[2:], subFormatBase[:]) {
+		return f.FormatTag
+	}
+	return binary.LittleEndian.Uint16(f.SubFormat[:])
+}
+
+// WaveFmtDecoder is a DecoderFunc for "fmt " chunks that sets Content to a
+// WaveFmt. It handles both the 16 byte WAVEFORMAT layout and the extended
+// ones carrying a cbSize field and extra format bytes.
+func WaveFmtDecoder(r io.Reader) (interface{}, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, fmt.Errorf("fmt chunk too short: %v", err)
+	}
+	f := WaveFmt{
+		FormatTag:     binary.LittleEndian.Uint16(b[0:]),
+		Channels:      binary.LittleEndian.Uint16(b[2:]),
+		SampleRate:    binary.LittleEndian.Uint32(b[4:]),
+		ByteRate:      binary.LittleEndian.Uint32(b[8:]),
+		BlockAlign:    binary.LittleEndian.Uint16(b[12:]),
+		BitsPerSample: binary.LittleEndian.Uint16(b[14:]),
+	}
+
+	var cbSize uint16
+	if err := binary.Read(r, binary.LittleEndian, &cbSize); err == io.EOF {
+		return f, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read cbSize: %v", err)
+	}
+	if cbSize > 0 {
+		f.Extra = make([]byte, cbSize)
+		if _, err := io.ReadFull(r, f.Extra); err != nil {
+			return nil, fmt.Errorf("read %v extra format bytes: %v", cbSize, err)
+		}
+	}
+	if f.FormatTag == WaveFormatExtensible {
+		if len(f.Extra) < 22 {
+			return nil, fmt.Errorf("extensible fmt chunk has %v extra format bytes, expected 22", len(f.Extra))
+		}
+		f.ValidBitsPerSample = binary.LittleEndian.Uint16(f.Extra)
+		f.ChannelMask = binary.LittleEndian.Uint32(f.Extra[2:])
+		copy(f.SubFormat[:], f.Extra[6:])
+	}
+	return f, nil
+}
+
+// WaveFmtEncoder is an EncoderFunc for "fmt " chunks that serializes a
+// WaveFmt, or a pointer to one, into the layout read by WaveFmtDecoder. The
+// cbSize field is written only if Extra is not empty or the format is not
+// PCM.
+func WaveFmtEncoder(v interface{}) ([]byte, error) {
+	var f WaveFmt
+	switch v := v.(type) {
+	case WaveFmt:
+		f = v
+	case *WaveFmt:
+		f = *v
+	default:
+		return nil, fmt.Errorf("can't encode %T as a fmt chunk", v)
+	}
+	b := make([]byte, 16, 18+len(f.Extra))
+	binary.LittleEndian.PutUint16(b[0:], f.FormatTag)
+	binary.LittleEndian.PutUint16(b[2:], f.Channels)
+	binary.LittleEndian.PutUint32(b[4:], f.SampleRate)
+	binary.LittleEndian.PutUint32(b[8:], f.ByteRate)
+	binary.LittleEndian.PutUint16(b[12:], f.BlockAlign)
+	binary.LittleEndian.PutUint16(b[14:], f.BitsPerSample)
+	if len(f.Extra) == 0 && f.FormatTag == WaveFormatPCM {
+		return b, nil
+	}
+	if len(f.Extra) > 0xffff {
+		return nil, fmt.Errorf("%v extra format bytes don't fit in cbSize", len(f.Extra))
+	}
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(f.Extra)))
+	return append(b, f.Extra...), nil
+}
+
+// WriteWAV writes a WAV file holding the samples pcm in the given format.
+// A "fact" chunk is added for formats other than PCM, with a number of
+// sample frames computed from BlockAlign, which only makes sense for
+// formats with fixed size frames such as IEEE float.
+func WriteWAV(w io.Writer, format WaveFmt, pcm []byte) (int64, error) {
+	b, err := WaveFmtEncoder(format)
+	if err != nil {
+		return 0, err
+	}
+	root := &Chunk{ID: riff, ListID: wave, Chunks: []*Chunk{{ID: fmtID, Data: b}}}
+	if format.FormatTag != WaveFormatPCM {
+		var frames uint32
+		if format.BlockAlign > 0 {
+			frames = uint32(len(pcm) / int(format.BlockAlign))
+		}
+		fact := binary.LittleEndian.AppendUint32(nil, frames)
+		root.Chunks = append(root.Chunks, &Chunk{ID: factID, Data: fact})
+	}
+	root.Chunks = append(root.Chunks, &Chunk{ID: dataID, Data: pcm})
+	root.updateLengths()
+	return root.WriteTo(w)
+}
+
+// WAVFile is a decoded WAV file.
+type WAVFile struct {
+	Format WaveFmt
+	Info   map[ID]string // Strings in the INFO list, if any
+	Root   *Chunk        // The RIFF chunk the file was decoded from
+	data   *Chunk
+}
+
+// OpenWAV decodes the WAV file read from r. It fails if the file isn't a
+// RIFF WAVE file or lacks either the "fmt " or the "data" chunk. A "wavl"
+// list of "data" and "slnt" chunks is accepted instead of a "data" chunk
+// for PCM and IEEE float files, and read as the samples of its data chunks
+// with its silences in between, see Segments. The INFO
+// strings are decoded from the code page of the CSET chunk, if the file has
+// one and its code page is supported, or else kept as they are.
+func OpenWAV(r io.Reader) (*WAVFile, error) {
+	d := NewDecoder(r)
+	d.Map(fmtID, WaveFmtDecoder)
+	d.Map(csetID, CsetDecoder)
+	d.Map(slntID, SlntDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		return nil, err
+	}
+	if c.ID != riff || c.ListID != wave {
+		return nil, fmt.Errorf("not a WAVE file: %q form %q", c.ID, c.ListID)
+	}
+
+	w := &WAVFile{Root: c, Info: make(map[ID]string)}
+	f := c.FindChunk(fmtID)
+	if f == nil || f.IsContainer() {
+		return nil, fmt.Errorf("missing %q chunk", fmtID)
+	}
+	format, ok := f.Content.(WaveFmt)
+	if !ok {
+		return nil, fmt.Errorf("%q chunk not decoded, its content is %T", fmtID, f.Content)
+	}
+	w.Format = format
+	if w.data = c.FindChunk(dataID); w.data == nil {
+		l := c.FindChunk(wavlID)
+		if l == nil || !l.IsContainer() {
+			return nil, fmt.Errorf("missing %q chunk", dataID)
+		}
+		data, err := flattenWavl(l, w.Format, d.MaxChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		w.data = &Chunk{ID: dataID, Len: uint32(len(data)), Data: data}
+	}
+	var cset CsetChunk
+	if cs := c.FindChunk(csetID); cs != nil {
+		cset, _ = cs.Content.(CsetChunk)
+	}
+	if l := c.FindChunk(info); l != nil {
+		for _, sc := range l.Chunks {
+			s, err := cset.DecodeString(sc.Data)
+			if err != nil {
+				s, _ = ReadFixedString(bytes.NewReader(sc.Data), len(sc.Data))
+			}
+			w.Info[sc.ID] = s
+		}
+	}
+	return w, nil
+}
+
+// NumSamples returns the number of sample frames, each holding one sample
+// per channel, of the file. It is computed from the length of the data
+// chunk for PCM files, extensible ones included, and read from the "fact"
+// chunk for compressed ones.
+func (w *WAVFile) NumSamples() int {
+	if w.Format.Format() == WaveFormatPCM && w.Format.BlockAlign > 0 {
+		return len(w.data.Data) / int(w.Format.BlockAlign)
+	}
+	if f := w.Root.FindChunk(factID); f != nil && len(f.Data) >= 4 {
+		return int(binary.LittleEndian.Uint32(f.Data))
+	}
+	return 0
+}
+
+// Duration returns the playing time of the file.
+func (w *WAVFile) Duration() time.Duration {
+	if w.Format.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(w.NumSamples()) * time.Second / time.Duration(w.Format.SampleRate)
+}
+
+// SetSampleRate changes the sample rate of the file to hz without touching
+// its samples, so that they play faster or slower. ByteRate is scaled by
+// the same factor, and the fmt chunk of Root is encoded again with
+// SetContent, after which the lengths of Root are updated. It fails if the
+// fmt chunk wasn't decoded to a WaveFmt.
+func (w *WAVFile) SetSampleRate(hz uint32) error {
+	if hz == 0 {
+		return fmt.Errorf("invalid sample rate 0")
+	}
+	c := w.Root.FindChunk(fmtID)
+	if c == nil {
+		return fmt.Errorf("missing %q chunk", fmtID)
+	}
+	f, ok := c.Content.(WaveFmt)
+	if !ok {
+		return fmt.Errorf("%q chunk not decoded, its content is %T", fmtID, c.Content)
+	}
+	if f.SampleRate > 0 {
+		f.ByteRate = uint32(uint64(f.ByteRate) * uint64(hz) / uint64(f.SampleRate))
+	} else {
+		f.ByteRate = hz * uint32(f.BlockAlign)
+	}
+	f.SampleRate = hz
+	if err := c.SetContent(f, WaveFmtEncoder); err != nil {
+		return err
+	}
+	w.Format = f
+	return w.Root.UpdateLengths()
+}
+
+// Samples returns the interleaved samples of a PCM file, sign extended to
+// int32. 8 bit samples, which are unsigned, are centered on zero.
+// WAVE_FORMAT_EXTENSIBLE files whose subformat is PCM are read too.
+func (w *WAVFile) Samples() ([]int32, error) {
+	if format := w.Format.Format(); format != WaveFormatPCM {
+		return nil, fmt.Errorf("unsupported format %#x, only PCM samples can be read", format)
+	}
+	b := w.data.Data
+	switch w.Format.BitsPerSample {
+	case 8:
+		s := make([]int32, len(b))
+		for i, v := range b {
+			s[i] = int32(v) - 128
+		}
+		return s, nil
+	case 16:
+		s := make([]int32, len(b)/2)
+		for i := range s {
+			s[i] = int32(int16(binary.LittleEndian.Uint16(b[2*i:])))
+		}
+		return s, nil
+	case 24:
+		s := make([]int32, len(b)/3)
+		for i := range s {
+			s[i] = int24LE(b[3*i:])
+		}
+		return s, nil
+	case 32:
+		s := make([]int32, len(b)/4)
+		for i := range s {
+			s[i] = int32(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported PCM sample size of %v bits", w.Format.BitsPerSample)
+}
+
+// Channels returns the samples of a PCM or IEEE float file, one slice per
+// channel, scaled to [-1, 1]. Integer samples of 8, 16, 24 and 32 bits are
+// divided by the magnitude of their lowest value, and 32 bit float samples
+// are returned as they are. Sample frames are BlockAlign bytes apart.
+func (w *WAVFile) Channels() ([][]float64, error) {
+	sample, size, err := w.sampleFunc()
+	if err != nil {
+		return nil, err
+	}
+	f := w.Format
+	b := w.data.Data
+	frames := len(b) / int(f.BlockAlign)
+	channels := make([][]float64, f.Channels)
+	for i := range channels {
+		channels[i] = make([]float64, frames)
+	}
+	for i := 0; i < frames; i++ {
+		frame := b[i*int(f.BlockAlign):]
+		for j, ch := range channels {
+			ch[i] = sample(frame[j*size:])
+		}
+	}
+	return channels, nil
+}
+
+// sampleFunc returns the function scaling a sample of the file, as
+// returned by Channels, and the size in bytes of a sample.
+func (w *WAVFile) sampleFunc() (func(b []byte) float64, int, error) {
+	f := w.Format
+	var sample func(b []byte) float64
+	switch format := f.Format(); {
+	case format == WaveFormatPCM && f.BitsPerSample == 8:
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case format == WaveFormatPCM && f.BitsPerSample == 16:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case format == WaveFormatPCM && f.BitsPerSample == 24:
+		sample = func(b []byte) float64 { return float64(int24LE(b)) / (1 << 23) }
+	case format == WaveFormatPCM && f.BitsPerSample == 32:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case format == WaveFormatIEEEFloat && f.BitsPerSample == 32:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case format == WaveFormatPCM || format == WaveFormatIEEEFloat:
+		return nil, 0, fmt.Errorf("unsupported sample size of %v bits for format %#x", f.BitsPerSample, format)
+	default:
+		return nil, 0, fmt.Errorf("unsupported format %#x, only PCM and IEEE float samples can be read", format)
+	}
+	size := int(f.BitsPerSample) / 8
+	if f.Channels == 0 || int(f.BlockAlign) < int(f.Channels)*size {
+		return nil, 0, fmt.Errorf("block align %v too small for %v channels of %v bits", f.BlockAlign, f.Channels, f.BitsPerSample)
+	}
+	return sample, size, nil
+}
+
+// Overview returns the lowest and highest sample, scaled like by Channels,
+// of each of the given number of buckets the sample frames of the file are
+// split into, as needed to draw its waveform. Channels are mixed down to
+// mono. The data is read in a single pass, a few frames at a time, so
+// files whose data chunk was created by SectionChunk aren't loaded in
+// memory. Buckets holding no frame, when there are fewer frames than
+// buckets, are 0.
+func (w *WAVFile) Overview(buckets int) (min, max []float64, err error) {
+	mins, maxs, err := w.overview(buckets, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mins[0], maxs[0], nil
+}
+
+// OverviewChannels is like Overview, but returns the lowest and highest
+// samples of each channel rather than of their mix.
+func (w *WAVFile) OverviewChannels(buckets int) (min, max [][]float64, err error) {
+	return w.overview(buckets, false)
+}
+
+// overviewFrames is the number of sample frames read at once by overview.
+const overviewFrames = 1024
+
+func (w *WAVFile) overview(buckets int, mix bool) (min, max [][]float64, err error) {
+	if buckets <= 0 {
+		return nil, nil, fmt.Errorf("invalid number of buckets %v", buckets)
+	}
+	sample, size, err := w.sampleFunc()
+	if err != nil {
+		return nil, nil, err
+	}
+	channels := int(w.Format.Channels)
+	outputs := channels
+	if mix {
+		outputs = 1
+	}
+	min, max = make([][]float64, outputs), make([][]float64, outputs)
+	for i := range min {
+		min[i], max[i] = make([]float64, buckets), make([]float64, buckets)
+		for j := range min[i] {
+			min[i][j], max[i][j] = math.Inf(1), math.Inf(-1)
+		}
+	}
+
+	align := int(w.Format.BlockAlign)
+	frames := w.data.dataLen() / int64(align)
+	r := io.NewSectionReader(readerAt{w.data}, 0, frames*int64(align))
+	buf := make([]byte, overviewFrames*align)
+	for i := int64(0); i < frames; {
+		n := len(buf)
+		if left := (frames - i) * int64(align); left < int64(n) {
+			n = int(left)
+		}
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, nil, fmt.Errorf("read %q: %v", dataID, err)
+		}
+		for off := 0; off < n; off, i = off+align, i+1 {
+			bucket := int(i * int64(buckets) / frames)
+			var sum float64
+			for ch := 0; ch < channels; ch++ {
+				v := sample(buf[off+ch*size:])
+				if mix {
+					sum += v
+					continue
+				}
+				min[ch][bucket] = math.Min(min[ch][bucket], v)
+				max[ch][bucket] = math.Max(max[ch][bucket], v)
+			}
+			if mix {
+				v := sum / float64(channels)
+				min[0][bucket] = math.Min(min[0][bucket], v)
+				max[0][bucket] = math.Max(max[0][bucket], v)
+			}
+		}
+	}
+
+	for i := range min {
+		for j := range min[i] {
+			if math.IsInf(min[i][j], 1) {
+				min[i][j], max[i][j] = 0, 0
+			}
+		}
+	}
+	return min, max, nil
+}
+
+// readerAt reads the data of a leaf chunk, from its section if it has one.
+type readerAt struct{ c *Chunk }
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if r.c.section != nil {
+		return r.c.section.ReadAt(p, off)
+	}
+	return bytes.NewReader(r.c.Data).ReadAt(p, off)
+}
+
+// PeakPos is the peak value of a channel and the position of the sample
+// frame where it happens.
+type PeakPos struct {
+	Value    float32
+	Position uint32
+}
+
+// PeakChunk is the content of a "PEAK" chunk, holding the peak of every
+// channel so waveforms can be drawn without scanning the samples.
+type PeakChunk struct {
+	Version   uint32
+	TimeStamp uint32    // Seconds since 1970-01-01 when the peaks were computed
+	Peaks     []PeakPos // One per channel
+}
+
+// PeakDecoder is a DecoderFunc for "PEAK" chunks that sets Content to a
+// PeakChunk.
+func PeakDecoder(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 {
+		return nil, fmt.Errorf("PEAK chunk too short: %v bytes", len(b))
+	}
+	peaks, err := DecodeRecords[PeakPos](b[8:], binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+	p := PeakChunk{
+		Version:   binary.LittleEndian.Uint32(b),
+		TimeStamp: binary.LittleEndian.Uint32(b[4:]),
+		Peaks:     peaks,
+	}
+	return p, nil
+}
+
+// Flags of AcidChunk.
+const (
+	AcidOneShot   = 0x01 // The file plays once rather than looping
+	AcidRootNote  = 0x02 // RootNote is set
+	AcidStretch   = 0x04 // The loop may be time stretched
+	AcidDiskBased = 0x08 // The file is streamed from disk
+)
+
+// AcidChunk is the content of an "acid" chunk, written by loop based audio
+// software to describe the musical properties of a loop.
+type AcidChunk struct {
+	Flags            uint32
+	RootNote         uint16 // MIDI note number, if Flags has AcidRootNote
+	Beats            uint32 // Length of the loop in beats
+	MeterDenominator uint16
+	MeterNumerator   uint16
+	Tempo            float32 // Beats per minute
+}
+
+// AcidDecoder is a DecoderFunc for "acid" chunks that sets Content to an
+// AcidChunk.
+func AcidDecoder(r io.Reader) (interface{}, error) {
+	var raw struct {
+		Flags            uint32
+		RootNote         uint16
+		_                uint16
+		_                float32
+		Beats            uint32
+		MeterDenominator uint16
+		MeterNumerator   uint16
+		Tempo            float32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+		return nil, fmt.Errorf("acid chunk too short: %v", err)
+	}
+	return AcidChunk{
+		Flags:            raw.Flags,
+		RootNote:         raw.RootNote,
+		Beats:            raw.Beats,
+		MeterDenominator: raw.MeterDenominator,
+		MeterNumerator:   raw.MeterNumerator,
+		Tempo:            raw.Tempo,
+	}, nil
+}
@@ -0,0 +1,478 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaveFmtDecoder(t *testing.T) {
+	tests := []struct {
+		data []byte
+		exp  WaveFmt
+		ok   bool
+	}{
+		{
+			data: []byte{1, 0, 2, 0, 0x44, 0xac, 0, 0, 0x10, 0xb1, 2, 0, 4, 0, 16, 0},
+			exp:  WaveFmt{FormatTag: 1, Channels: 2, SampleRate: 44100, ByteRate: 176400, BlockAlign: 4, BitsPerSample: 16},
+			ok:   true,
+		},
+		{
+			data: []byte{1, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x40, 0x1f, 0, 0, 1, 0, 8, 0, 0, 0},
+			exp:  WaveFmt{FormatTag: 1, Channels: 1, SampleRate: 8000, ByteRate: 8000, BlockAlign: 1, BitsPerSample: 8},
+			ok:   true,
+		},
+		{
+			data: []byte{0x55, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x40, 0x1f, 0, 0, 1, 0, 0, 0, 2, 0, 0xab, 0xcd},
+			exp:  WaveFmt{FormatTag: 0x55, Channels: 1, SampleRate: 8000, ByteRate: 8000, BlockAlign: 1, Extra: []byte{0xab, 0xcd}},
+			ok:   true,
+		},
+		{
+			data: append([]byte{0xfe, 0xff, 6, 0, 0x80, 0xbb, 0, 0, 0, 0xf9, 0x15, 0, 18, 0, 24, 0, 22, 0, 20, 0, 0x3f, 0, 0, 0}, subFormatGUID(WaveFormatIEEEFloat)...),
+			exp: WaveFmt{FormatTag: WaveFormatExtensible, Channels: 6, SampleRate: 48000, ByteRate: 1440000, BlockAlign: 18, BitsPerSample: 24,
+				Extra:              append([]byte{20, 0, 0x3f, 0, 0, 0}, subFormatGUID(WaveFormatIEEEFloat)...),
+				ValidBitsPerSample: 20, ChannelMask: 0x3f, SubFormat: [16]byte(subFormatGUID(WaveFormatIEEEFloat))},
+			ok: true,
+		},
+		{data: []byte{0xfe, 0xff, 1, 0, 0x40, 0x1f, 0, 0, 0x40, 0x1f, 0, 0, 1, 0, 8, 0, 2, 0, 1, 2}},
+		{data: []byte{1, 0, 1, 0, 0x40, 0x1f}},
+		{data: []byte{1, 0, 1, 0, 0x40, 0x1f, 0, 0, 0x40, 0x1f, 0, 0, 1, 0, 8, 0, 2, 0, 1}},
+	}
+	for i, test := range tests {
+		got, err := WaveFmtDecoder(bytes.NewReader(test.data))
+		if !test.ok {
+			if err == nil {
+				t.Errorf("test %v: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %v: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("test %v: got %+v, expected %+v", i, got, test.exp)
+		}
+	}
+}
+
+func TestWaveFmtDecoderMap(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	d.Map(NewID("fmt "), WaveFmtDecoder)
+	c, err := d.Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	got, ok := c.FindChunk(NewID("fmt ")).Content.(WaveFmt)
+	if !ok {
+		t.Fatalf("fmt content is %T, expected WaveFmt", c.FindChunk(NewID("fmt ")).Content)
+	}
+	if got.FormatTag != WaveFormatMPEGLayer3 || got.Channels != 1 || got.SampleRate != 11025 || got.ByteRate != 2500 {
+		t.Errorf("got format %+v", got)
+	}
+	if len(got.Extra) != 12 {
+		t.Errorf("got %v extra format bytes, expected the 12 following cbSize", len(got.Extra))
+	}
+}
+
+// subFormatGUID returns the extensible SubFormat GUID of the format tag.
+func subFormatGUID(tag uint16) []byte {
+	return append([]byte{byte(tag), byte(tag >> 8)}, subFormatBase[:]...)
+}
+
+func TestWaveFmtFormat(t *testing.T) {
+	for _, tt := range []struct {
+		f   WaveFmt
+		exp uint16
+	}{
+		{WaveFmt{FormatTag: WaveFormatPCM}, WaveFormatPCM},
+		{WaveFmt{FormatTag: WaveFormatExtensible, SubFormat: [16]byte(subFormatGUID(WaveFormatPCM))}, WaveFormatPCM},
+		{WaveFmt{FormatTag: WaveFormatExtensible, SubFormat: [16]byte(subFormatGUID(WaveFormatIEEEFloat))}, WaveFormatIEEEFloat},
+		{WaveFmt{FormatTag: WaveFormatExtensible, SubFormat: [16]byte{1, 2, 3}}, WaveFormatExtensible},
+	} {
+		if got := tt.f.Format(); got != tt.exp {
+			t.Errorf("%x: got format %#x, expected %#x", tt.f.SubFormat, got, tt.exp)
+		}
+	}
+}
+
+func TestWaveFmtEncoder(t *testing.T) {
+	for _, tt := range []struct {
+		f    WaveFmt
+		size int
+	}{
+		{WaveFmt{FormatTag: WaveFormatPCM, Channels: 2, SampleRate: 44100, ByteRate: 176400, BlockAlign: 4, BitsPerSample: 16}, 16},
+		{WaveFmt{FormatTag: WaveFormatMPEGLayer3, Channels: 1, SampleRate: 8000, ByteRate: 1000, BlockAlign: 1, Extra: []byte{1, 2, 3, 4}}, 22},
+	} {
+		b, err := WaveFmtEncoder(&tt.f)
+		if err != nil {
+			t.Fatalf("WaveFmtEncoder: %v", err)
+		}
+		if len(b) != tt.size {
+			t.Errorf("format %#x: encoded %v bytes, expected %v", tt.f.FormatTag, len(b), tt.size)
+		}
+		got, err := WaveFmtDecoder(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("WaveFmtDecoder: %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.f) {
+			t.Errorf("got %+v, expected %+v", got, tt.f)
+		}
+	}
+}
+
+func TestOpenWAV(t *testing.T) {
+	f, err := os.Open("data/odd.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+
+	w, err := OpenWAV(f)
+	if err != nil {
+		t.Fatalf("OpenWAV: %v", err)
+	}
+	if w.Format.SampleRate != 8000 || w.Format.BitsPerSample != 8 {
+		t.Errorf("unexpected format %+v", w.Format)
+	}
+	exp := map[ID]string{NewID("INAM"): "Odd song", NewID("ISFT"): "riff"}
+	if !reflect.DeepEqual(w.Info, exp) {
+		t.Errorf("info: got %q, expected %q", w.Info, exp)
+	}
+	s, err := w.Samples()
+	if err != nil {
+		t.Fatalf("Samples: %v", err)
+	}
+	if expS := []int32{0, 12, 22, 32, 22, 12, 0}; !reflect.DeepEqual(s, expS) {
+		t.Errorf("samples: got %v, expected %v", s, expS)
+	}
+
+	bad := map[string][]byte{
+		"not wave":     listBytes("RIFF", "AVI ", leafBytes("fmt ", make([]byte, 16))),
+		"missing fmt":  listBytes("RIFF", "WAVE", leafBytes("data", nil)),
+		"missing data": listBytes("RIFF", "WAVE", leafBytes("fmt ", make([]byte, 16))),
+		"fmt list":     listBytes("RIFF", "WAVE", listBytes("LIST", "fmt "), leafBytes("data", nil)),
+	}
+	for name, b := range bad {
+		if _, err := OpenWAV(bytes.NewReader(b)); err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+	}
+}
+
+func TestSamples(t *testing.T) {
+	tests := []struct {
+		bits uint16
+		data []byte
+		exp  []int32
+	}{
+		{16, []byte{0xff, 0x7f, 0x00, 0x80}, []int32{32767, -32768}},
+		{24, []byte{0xff, 0xff, 0x7f, 0x00, 0x00, 0x80, 0xff, 0xff, 0xff}, []int32{8388607, -8388608, -1}},
+		{32, []byte{0xfe, 0xff, 0xff, 0xff}, []int32{-2}},
+	}
+	for _, test := range tests {
+		w := &WAVFile{
+			Format: WaveFmt{FormatTag: WaveFormatPCM, BitsPerSample: test.bits},
+			data:   &Chunk{Data: test.data},
+		}
+		got, err := w.Samples()
+		if err != nil {
+			t.Errorf("%v bits: %v", test.bits, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%v bits: got %v, expected %v", test.bits, got, test.exp)
+		}
+	}
+
+	extensible := &WAVFile{
+		Format: WaveFmt{FormatTag: WaveFormatExtensible, BitsPerSample: 16, SubFormat: [16]byte(subFormatGUID(WaveFormatPCM))},
+		data:   &Chunk{Data: []byte{0xff, 0x7f}},
+	}
+	if got, err := extensible.Samples(); err != nil || !reflect.DeepEqual(got, []int32{32767}) {
+		t.Errorf("extensible PCM: got %v, %v", got, err)
+	}
+	extensible.Format.SubFormat = [16]byte(subFormatGUID(WaveFormatIEEEFloat))
+	if _, err := extensible.Samples(); err == nil {
+		t.Errorf("expected error for extensible IEEE float samples")
+	}
+}
+
+func TestChannels(t *testing.T) {
+	float := func(v float32) []byte {
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(v))
+	}
+	tests := []struct {
+		format WaveFmt
+		data   []byte
+		exp    [][]float64
+	}{
+		{
+			WaveFmt{FormatTag: WaveFormatPCM, Channels: 2, BlockAlign: 2, BitsPerSample: 8},
+			[]byte{0, 128, 192, 64},
+			[][]float64{{-1, 0.5}, {0, -0.5}},
+		},
+		{
+			WaveFmt{FormatTag: WaveFormatPCM, Channels: 2, BlockAlign: 4, BitsPerSample: 16},
+			[]byte{0x00, 0x80, 0x00, 0x40, 0x00, 0xc0, 0x00, 0x00, 0xff},
+			[][]float64{{-1, -0.5}, {0.5, 0}},
+		},
+		{
+			WaveFmt{FormatTag: WaveFormatPCM, Channels: 1, BlockAlign: 3, BitsPerSample: 24},
+			[]byte{0x00, 0x00, 0x80, 0x00, 0x00, 0x20},
+			[][]float64{{-1, 0.25}},
+		},
+		{
+			WaveFmt{FormatTag: WaveFormatExtensible, Channels: 1, BlockAlign: 4, BitsPerSample: 32, SubFormat: [16]byte(subFormatGUID(WaveFormatPCM))},
+			[]byte{0x00, 0x00, 0x00, 0xc0},
+			[][]float64{{-0.5}},
+		},
+		{
+			WaveFmt{FormatTag: WaveFormatIEEEFloat, Channels: 2, BlockAlign: 8, BitsPerSample: 32},
+			append(float(0.25), float(-1)...),
+			[][]float64{{0.25}, {-1}},
+		},
+	}
+	for _, test := range tests {
+		w := &WAVFile{Format: test.format, data: &Chunk{Data: test.data}}
+		got, err := w.Channels()
+		if err != nil {
+			t.Errorf("%v bits: %v", test.format.BitsPerSample, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%v bits: got %v, expected %v", test.format.BitsPerSample, got, test.exp)
+		}
+	}
+
+	for _, f := range []WaveFmt{
+		{FormatTag: WaveFormatMPEGLayer3, Channels: 1, BlockAlign: 1, BitsPerSample: 8},
+		{FormatTag: WaveFormatIEEEFloat, Channels: 1, BlockAlign: 8, BitsPerSample: 64},
+		{FormatTag: WaveFormatPCM, Channels: 1, BlockAlign: 2, BitsPerSample: 12},
+		{FormatTag: WaveFormatPCM, Channels: 2, BlockAlign: 2, BitsPerSample: 16},
+	} {
+		w := &WAVFile{Format: f, data: &Chunk{Data: make([]byte, 8)}}
+		if _, err := w.Channels(); err == nil {
+			t.Errorf("expected error for %+v", f)
+		}
+	}
+}
+
+func TestOverview(t *testing.T) {
+	const frames = 3000
+	b := make([]byte, 4*frames)
+	for i := 0; i < frames; i++ {
+		binary.LittleEndian.PutUint16(b[4*i:], uint16(i))
+		binary.LittleEndian.PutUint16(b[4*i+2:], uint16(-2*i))
+	}
+	w := &WAVFile{
+		Format: WaveFmt{FormatTag: WaveFormatPCM, Channels: 2, BlockAlign: 4, BitsPerSample: 16},
+		data:   SectionChunk(dataID, bytes.NewReader(b), 0, int64(len(b))),
+	}
+	const s = 1 << 15
+	min, max, err := w.Overview(2)
+	if err != nil {
+		t.Fatalf("Overview: %v", err)
+	}
+	if exp := []float64{-749.5 / s, -1499.5 / s}; !reflect.DeepEqual(min, exp) {
+		t.Errorf("got min %v, expected %v", min, exp)
+	}
+	if exp := []float64{0, -750.0 / s}; !reflect.DeepEqual(max, exp) {
+		t.Errorf("got max %v, expected %v", max, exp)
+	}
+
+	mins, maxs, err := w.OverviewChannels(2)
+	if err != nil {
+		t.Fatalf("OverviewChannels: %v", err)
+	}
+	if exp := [][]float64{{0, 1500.0 / s}, {-2998.0 / s, -5998.0 / s}}; !reflect.DeepEqual(mins, exp) {
+		t.Errorf("got min %v, expected %v", mins, exp)
+	}
+	if exp := [][]float64{{1499.0 / s, 2999.0 / s}, {0, -3000.0 / s}}; !reflect.DeepEqual(maxs, exp) {
+		t.Errorf("got max %v, expected %v", maxs, exp)
+	}
+
+	w.data = &Chunk{ID: dataID, Data: b[:8]}
+	min, max, err = w.Overview(4)
+	if err != nil {
+		t.Fatalf("Overview: %v", err)
+	}
+	if exp := []float64{0, 0, -0.5 / s, 0}; !reflect.DeepEqual(min, exp) {
+		t.Errorf("got min %v for 2 frames, expected %v", min, exp)
+	}
+	if _, _, err := w.Overview(0); err == nil {
+		t.Errorf("expected error for 0 buckets")
+	}
+	w.data = SectionChunk(dataID, bytes.NewReader(b[:10]), 0, 20)
+	if _, _, err := w.Overview(1); err == nil {
+		t.Errorf("expected error for a short data section")
+	}
+}
+
+func TestPeakDecoder(t *testing.T) {
+	b := []byte{1, 0, 0, 0, 0x10, 0, 0, 0}
+	b = append(b, 0, 0, 0x40, 0x3f, 7, 0, 0, 0) // 0.75 at frame 7
+	b = append(b, 0, 0, 0x80, 0x3f, 0, 1, 0, 0) // 1.0 at frame 256
+	got, err := PeakDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("PeakDecoder: %v", err)
+	}
+	exp := PeakChunk{Version: 1, TimeStamp: 16, Peaks: []PeakPos{{0.75, 7}, {1, 256}}}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+
+	for _, n := range []int{4, 12} {
+		if _, err := PeakDecoder(bytes.NewReader(b[:n])); err == nil {
+			t.Errorf("expected error for %v bytes", n)
+		}
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	pcm := WaveFmt{FormatTag: WaveFormatPCM, Channels: 1, SampleRate: 8000, ByteRate: 16000, BlockAlign: 2, BitsPerSample: 16}
+	float := WaveFmt{FormatTag: WaveFormatIEEEFloat, Channels: 1, SampleRate: 8000, ByteRate: 32000, BlockAlign: 4, BitsPerSample: 32}
+	for _, tt := range []struct {
+		format WaveFmt
+		data   []byte
+		size   int64
+	}{
+		{pcm, []byte{1, 0, 0xff, 0xff, 0, 0x80}, 12 + 24 + 14},
+		{float, make([]byte, 12), 12 + 26 + 12 + 20},
+		{WaveFmt{FormatTag: WaveFormatPCM, Channels: 1, SampleRate: 8000, ByteRate: 8000, BlockAlign: 1, BitsPerSample: 8}, []byte{1, 2, 3}, 12 + 24 + 12},
+	} {
+		buf := new(bytes.Buffer)
+		n, err := WriteWAV(buf, tt.format, tt.data)
+		if err != nil {
+			t.Fatalf("format %#x: WriteWAV: %v", tt.format.FormatTag, err)
+		}
+		if n != tt.size || int64(buf.Len()) != n {
+			t.Errorf("format %#x: wrote %v bytes, expected %v", tt.format.FormatTag, n, tt.size)
+		}
+		if err := Validate(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("format %#x: Validate: %v", tt.format.FormatTag, err)
+		}
+		w, err := OpenWAV(buf)
+		if err != nil {
+			t.Fatalf("format %#x: OpenWAV: %v", tt.format.FormatTag, err)
+		}
+		if !reflect.DeepEqual(w.Format, tt.format) {
+			t.Errorf("format %#x: got format %+v", tt.format.FormatTag, w.Format)
+		}
+		if exp := len(tt.data) / int(tt.format.BlockAlign); w.NumSamples() != exp {
+			t.Errorf("format %#x: got %v samples, expected %v", tt.format.FormatTag, w.NumSamples(), exp)
+		}
+		if got := w.Root.FindChunk(dataID).Data; !bytes.Equal(got, tt.data) {
+			t.Errorf("format %#x: got data %v, expected %v", tt.format.FormatTag, got, tt.data)
+		}
+	}
+}
+
+func TestAcidDecoder(t *testing.T) {
+	b := []byte{
+		0x06, 0, 0, 0, // stretch, root note set
+		60, 0, // middle C
+		0x80, 0, 0, 0, 0, 0, // unknown
+		8, 0, 0, 0, // 8 beats
+		4, 0, 4, 0, // 4/4
+		0, 0, 0xf0, 0x42, // 120 BPM
+	}
+	got, err := AcidDecoder(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("AcidDecoder: %v", err)
+	}
+	exp := AcidChunk{Flags: AcidRootNote | AcidStretch, RootNote: 60, Beats: 8, MeterDenominator: 4, MeterNumerator: 4, Tempo: 120}
+	if got != exp {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+	if _, err := AcidDecoder(bytes.NewReader(b[:20])); err == nil {
+		t.Errorf("expected error for a short acid chunk")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		path    string
+		samples int
+		dur     time.Duration
+	}{
+		{"data/odd.wav", 7, 875 * time.Microsecond},
+		{"data/hand.wav", 34398, 3120000000},
+	}
+	for _, test := range tests {
+		f, err := os.Open(test.path)
+		if err != nil {
+			t.Fatalf("open test file: %v", err)
+		}
+		w, err := OpenWAV(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("OpenWAV(%v): %v", test.path, err)
+		}
+		if got := w.NumSamples(); got != test.samples {
+			t.Errorf("%v: %v samples, expected %v", test.path, got, test.samples)
+		}
+		if got := w.Duration(); got != test.dur {
+			t.Errorf("%v: duration %v, expected %v", test.path, got, test.dur)
+		}
+	}
+
+	// Extensible PCM files need no fact chunk.
+	w := &WAVFile{
+		Root:   &Chunk{ID: riff, ListID: wave},
+		Format: WaveFmt{FormatTag: WaveFormatExtensible, SampleRate: 8000, BlockAlign: 4, SubFormat: [16]byte(subFormatGUID(WaveFormatPCM))},
+		data:   &Chunk{Data: make([]byte, 8)},
+	}
+	if got, dur := w.NumSamples(), w.Duration(); got != 2 || dur != 250*time.Microsecond {
+		t.Errorf("extensible PCM: %v samples lasting %v, expected 2 lasting 250µs", got, dur)
+	}
+}
+
+func TestSetSampleRate(t *testing.T) {
+	f, err := os.Open("data/hand.wav")
+	if err != nil {
+		t.Fatalf("open test file: %v", err)
+	}
+	defer f.Close()
+	w, err := OpenWAV(f)
+	if err != nil {
+		t.Fatalf("OpenWAV: %v", err)
+	}
+	exp := w.Format
+	exp.SampleRate, exp.ByteRate = 2*exp.SampleRate, 2*exp.ByteRate
+	if err := w.SetSampleRate(exp.SampleRate); err != nil {
+		t.Fatalf("SetSampleRate: %v", err)
+	}
+	if !reflect.DeepEqual(w.Format, exp) {
+		t.Errorf("got format %+v, expected %+v", w.Format, exp)
+	}
+
+	b, err := w.Root.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	w, err = OpenWAV(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("OpenWAV of the edited file: %v", err)
+	}
+	if !reflect.DeepEqual(w.Format, exp) {
+		t.Errorf("read back format %+v, expected %+v", w.Format, exp)
+	}
+	if got := w.Duration(); got != 1560*time.Millisecond {
+		t.Errorf("duration %v, expected 1.56s", got)
+	}
+
+	raw := &WAVFile{Root: &Chunk{ID: riff, ListID: wave, Chunks: []*Chunk{{ID: fmtID, Len: 16, Data: make([]byte, 16)}}}}
+	if err := raw.SetSampleRate(44100); err == nil {
+		t.Errorf("expected error with a fmt chunk not decoded")
+	}
+}
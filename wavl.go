@@ -0,0 +1,125 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	wavlID = NewID("wavl")
+	slntID = NewID("slnt")
+)
+
+// SlntChunk is the content of a "slnt" chunk of a "wavl" LIST, standing for
+// a stretch of silence between the "data" chunks of the list.
+type SlntChunk struct {
+	Samples uint32 // Length of the silence, in sample frames
+}
+
+// SlntDecoder is a DecoderFunc for "slnt" chunks that sets Content to a
+// SlntChunk.
+func SlntDecoder(r io.Reader) (interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseSlnt(b)
+}
+
+func parseSlnt(b []byte) (SlntChunk, error) {
+	if len(b) < 4 {
+		return SlntChunk{}, fmt.Errorf("slnt chunk too short: %v bytes", len(b))
+	}
+	return SlntChunk{Samples: binary.LittleEndian.Uint32(b)}, nil
+}
+
+// WaveSegment is a stretch of the timeline of a WAV file, either samples
+// or silence.
+type WaveSegment struct {
+	Start  int    // First sample frame of the segment on the timeline
+	Frames int    // Number of sample frames
+	Data   []byte // Samples of the segment, nil for silence
+}
+
+// Segments returns the timeline of the file: the "data" and "slnt" chunks
+// of its "wavl" list in order, with the sample frames each one starts at,
+// or for a file with a single "data" chunk a single segment holding it.
+// Both chunks decoded with SlntDecoder and raw ones are handled.
+func (w *WAVFile) Segments() ([]WaveSegment, error) {
+	align := int(w.Format.BlockAlign)
+	if align == 0 {
+		return nil, fmt.Errorf("invalid block align 0")
+	}
+	l := w.Root.FindChunk(wavlID)
+	if l == nil || !l.IsContainer() {
+		return []WaveSegment{{Frames: len(w.data.Data) / align, Data: w.data.Data}}, nil
+	}
+	return wavlSegments(l, align)
+}
+
+// wavlSegments returns the segments of the wavl list l, for sample frames
+// of align bytes. Chunks other than "data" and "slnt" are ignored.
+func wavlSegments(l *Chunk, align int) ([]WaveSegment, error) {
+	var segs []WaveSegment
+	start := 0
+	for _, sc := range l.Chunks {
+		s := WaveSegment{Start: start}
+		switch sc.ID {
+		case dataID:
+			s.Frames, s.Data = len(sc.Data)/align, sc.Data
+		case slntID:
+			slnt, ok := sc.Content.(SlntChunk)
+			if !ok {
+				var err error
+				if slnt, err = parseSlnt(sc.Data); err != nil {
+					return nil, err
+				}
+			}
+			s.Frames = int(slnt.Samples)
+		default:
+			continue
+		}
+		segs = append(segs, s)
+		start += s.Frames
+	}
+	return segs, nil
+}
+
+// flattenWavl returns the samples of the wavl list l of a file in format f,
+// with its silences as silent sample frames. Only PCM and IEEE float
+// samples can be flattened, and flattening fails if the samples would take
+// more than max bytes, so that a small file claiming hours of silence
+// can't exhaust memory. Zero means no limit.
+func flattenWavl(l *Chunk, f WaveFmt, max uint32) ([]byte, error) {
+	if format := f.Format(); format != WaveFormatPCM && format != WaveFormatIEEEFloat || f.BlockAlign == 0 {
+		return nil, fmt.Errorf("can't flatten the %q list of a file of format %#x", wavlID, f.FormatTag)
+	}
+	segs, err := wavlSegments(l, int(f.BlockAlign))
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, s := range segs {
+		size += int64(s.Frames) * int64(f.BlockAlign)
+		if max > 0 && size > int64(max) {
+			return nil, fmt.Errorf("%q list of more than %v bytes once flattened", wavlID, max)
+		}
+	}
+
+	var silence byte // 8 bit samples are unsigned
+	if f.Format() == WaveFormatPCM && f.BitsPerSample <= 8 {
+		silence = 0x80
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+	for _, s := range segs {
+		if s.Data != nil {
+			buf.Write(s.Data)
+			continue
+		}
+		buf.Write(bytes.Repeat([]byte{silence}, s.Frames*int(f.BlockAlign)))
+	}
+	return buf.Bytes(), nil
+}
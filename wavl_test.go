@@ -0,0 +1,97 @@
+package riff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSlntDecoder(t *testing.T) {
+	got, err := SlntDecoder(bytes.NewReader([]byte{3, 1, 0, 0}))
+	if err != nil {
+		t.Fatalf("SlntDecoder: %v", err)
+	}
+	if exp := (SlntChunk{Samples: 259}); got != exp {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+	if _, err := SlntDecoder(bytes.NewReader([]byte{3})); err == nil {
+		t.Errorf("expected error for a short slnt chunk")
+	}
+}
+
+func TestWavl(t *testing.T) {
+	f, err := WaveFmtEncoder(WaveFmt{FormatTag: WaveFormatPCM, Channels: 1, SampleRate: 8000, ByteRate: 8000, BlockAlign: 1, BitsPerSample: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := BuildRIFF(wave,
+		ChunkSpec{ID: "fmt ", Data: f},
+		ChunkSpec{ID: "LIST", Form: "wavl", Chunks: []ChunkSpec{
+			{ID: "data", Data: []byte{0x81, 0x82}},
+			{ID: "slnt", Data: binary.LittleEndian.AppendUint32(nil, 3)},
+			{ID: "data", Data: []byte{0x7f}},
+		}},
+	)
+	w, err := OpenWAV(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("OpenWAV: %v", err)
+	}
+	segs, err := w.Segments()
+	if err != nil {
+		t.Fatalf("Segments: %v", err)
+	}
+	exp := []WaveSegment{
+		{Start: 0, Frames: 2, Data: []byte{0x81, 0x82}},
+		{Start: 2, Frames: 3},
+		{Start: 5, Frames: 1, Data: []byte{0x7f}},
+	}
+	if !reflect.DeepEqual(segs, exp) {
+		t.Errorf("got segments %+v, expected %+v", segs, exp)
+	}
+	samples, err := w.Samples()
+	if err != nil {
+		t.Fatalf("Samples: %v", err)
+	}
+	if exp := []int32{1, 2, 0, 0, 0, -1}; !reflect.DeepEqual(samples, exp) {
+		t.Errorf("got samples %v, expected %v", samples, exp)
+	}
+	if n := w.NumSamples(); n != 6 {
+		t.Errorf("got %v samples, expected 6", n)
+	}
+
+	b, err = ioutil.ReadFile("data/odd.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	if w, err = OpenWAV(bytes.NewReader(b)); err != nil {
+		t.Fatalf("OpenWAV: %v", err)
+	}
+	if segs, err := w.Segments(); err != nil || len(segs) != 1 || segs[0].Frames != 7 {
+		t.Errorf("got segments %+v, %v; expected the 7 frames of the data chunk", segs, err)
+	}
+}
+
+func TestWavlSilenceLimit(t *testing.T) {
+	f, err := WaveFmtEncoder(WaveFmt{FormatTag: WaveFormatPCM, Channels: 2, SampleRate: 8000, ByteRate: 64000, BlockAlign: 8, BitsPerSample: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slnt := func(n uint32) ChunkSpec {
+		return ChunkSpec{ID: "slnt", Data: binary.LittleEndian.AppendUint32(nil, n)}
+	}
+	for _, specs := range [][]ChunkSpec{
+		{slnt(0xffffffff)},
+		{slnt(DefaultMaxChunkSize / 16), slnt(DefaultMaxChunkSize / 16), slnt(1)},
+	} {
+		b := BuildRIFF(wave,
+			ChunkSpec{ID: "fmt ", Data: f},
+			ChunkSpec{ID: "LIST", Form: "wavl", Chunks: specs},
+		)
+		if _, err := OpenWAV(bytes.NewReader(b)); err == nil || !strings.Contains(err.Error(), "once flattened") {
+			t.Errorf("got error %v, expected the silence to exceed the limit", err)
+		}
+	}
+}
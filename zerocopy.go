@@ -0,0 +1,91 @@
+package riff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// NewBytesDecoder returns a Decoder reading from b, such as a memory mapped
+// file, without copying the data of leaves: their Data slices point into
+// b, so b must stay valid, and mapped, as long as the decoded chunks are in
+// use. Since mapped memory is usually read only, the Data of the decoded
+// chunks and the slices passed to rewrite functions must not be modified.
+// If BufferPool is set, data is copied to its buffers as usual.
+func NewBytesDecoder(b []byte) *Decoder {
+	d := NewDecoder(bytes.NewReader(b))
+	d.r.size = int64(len(b))
+	d.src = b
+	return d
+}
+
+// sliceData sets the data of the leaf c, read from r, to the slice of d.src
+// holding it, skips it, and reads its pad byte.
+func (d *Decoder) sliceData(r io.Reader, c *Chunk) error {
+	start, end := d.r.n, d.r.n+int64(c.Len)
+	if max := int64(len(d.src)); end > max {
+		err := fmt.Errorf("read data: chunk %q truncated after %v of %v bytes: %w", c.ID, max-start, c.Len, io.ErrUnexpectedEOF)
+		if !d.tolerate(c.Offset, err) {
+			return err
+		}
+		end = max
+		c.clamp(uint32(max - start))
+	}
+	if err := skip(r, end-start); err != nil {
+		return fmt.Errorf("read data: %w", err)
+	}
+	c.Data = d.src[start:end:end]
+	var err error
+	c.padByte, err = d.pad(r, c)
+	return err
+}
+
+// NewReaderAtDecoder returns a Decoder reading the size bytes of r, such as
+// a large AVI file, without reading the data of leaves: they are left
+// without Data, and their data is read from r on demand by Open, CopyData,
+// ReadDataInto and WriteTo, so r must stay open as long as the decoded
+// chunks are in use. The data of leaves with a DecoderFunc or a rewrite
+// function registered is read as usual, so that their Content is set.
+func NewReaderAtDecoder(r io.ReaderAt, size int64) *Decoder {
+	d := NewDecoder(io.NewSectionReader(r, 0, size))
+	d.r.size = size
+	d.at = r
+	return d
+}
+
+// needsData reports whether the data of leaves with the given ID must be
+// read for a DecoderFunc or a rewrite function, or for ds64 chunks to read
+// the sizes of their RF64 chunk.
+func (d *Decoder) needsData(id ID) bool {
+	if id == ds64ID {
+		return true
+	}
+	if _, ok := d.funcFor(id); ok {
+		return true
+	}
+	d.m.RLock()
+	defer d.m.RUnlock()
+	_, ok := d.rewrite[id]
+	return ok || d.fallback != nil
+}
+
+// sectionData sets the section of the leaf c, read from r, to the bytes of
+// d.at holding its data, skips them, and reads its pad byte.
+func (d *Decoder) sectionData(r io.Reader, c *Chunk) error {
+	start, end := d.r.n, d.r.n+int64(c.Len)
+	if max := d.r.size; end > max {
+		err := fmt.Errorf("read data: chunk %q truncated after %v of %v bytes: %w", c.ID, max-start, c.Len, io.ErrUnexpectedEOF)
+		if !d.tolerate(c.Offset, err) {
+			return err
+		}
+		end = max
+		c.clamp(uint32(max - start))
+	}
+	if err := skip(r, end-start); err != nil {
+		return fmt.Errorf("read data: %w", err)
+	}
+	c.section = io.NewSectionReader(d.at, start, end-start)
+	var err error
+	c.padByte, err = d.pad(r, c)
+	return err
+}
@@ -0,0 +1,128 @@
+package riff
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewBytesDecoder(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	want, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	d := NewBytesDecoder(b)
+	d.Map(NewID("fmt "), WaveFmtDecoder)
+	got, err := d.Decode()
+	if err != nil {
+		t.Fatalf("NewBytesDecoder: %v", err)
+	}
+	var w1, w2 bytes.Buffer
+	want.WriteTo(&w1)
+	got.WriteTo(&w2)
+	if !bytes.Equal(w1.Bytes(), w2.Bytes()) {
+		t.Errorf("trees decoded differently")
+	}
+	if data := got.FindChunk(NewID("data")); &data.Data[0] != &b[70] || cap(data.Data) != len(data.Data) {
+		t.Errorf("data chunk doesn't point into the input")
+	}
+	if _, ok := got.FindChunk(NewID("fmt ")).Content.(WaveFmt); !ok {
+		t.Errorf("fmt chunk not decoded")
+	}
+
+	d = NewBytesDecoder(b[:1000])
+	if _, err := d.Decode(); err == nil {
+		t.Errorf("expected error for a truncated file")
+	}
+	d = NewBytesDecoder(b[:1000])
+	d.Tolerant = true
+	if c, err := d.Decode(); err != nil || len(c.FindChunk(NewID("data")).Data) != 1000-70 {
+		t.Errorf("tolerant truncated decode: got %v, %v", c, err)
+	}
+}
+
+func TestNewReaderAtDecoder(t *testing.T) {
+	b, err := ioutil.ReadFile("data/hand.wav")
+	if err != nil {
+		t.Fatalf("read test file: %v", err)
+	}
+	want, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	d := NewReaderAtDecoder(bytes.NewReader(b), int64(len(b)))
+	d.Map(NewID("fmt "), WaveFmtDecoder)
+	got, err := d.Decode()
+	if err != nil {
+		t.Fatalf("NewReaderAtDecoder: %v", err)
+	}
+	if !EqualContent(got, want) {
+		t.Errorf("trees decoded differently")
+	}
+	data := got.FindChunk(NewID("data"))
+	if data.Data != nil {
+		t.Errorf("data chunk has %v bytes of Data, expected none", len(data.Data))
+	}
+	r, err := data.Open()
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if p, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(p, b[70:70+7800]) {
+		t.Errorf("Open read %v bytes, %v, expected the 7800 bytes of the data chunk", len(p), err)
+	}
+	if _, ok := got.FindChunk(NewID("fmt ")).Content.(WaveFmt); !ok {
+		t.Errorf("fmt chunk not decoded")
+	}
+	var buf bytes.Buffer
+	if _, err := got.WriteTo(&buf); err != nil || !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("WriteTo: %v, output differs from the input", err)
+	}
+
+	if _, err := NewReaderAtDecoder(bytes.NewReader(b), 1000).Decode(); err == nil {
+		t.Errorf("expected error for a truncated file")
+	}
+	if _, err := got.Open(); err == nil {
+		t.Errorf("expected error opening a container")
+	}
+}
+
+// scaledWAV returns hand.wav with its data chunk repeated n times.
+func scaledWAV(b *testing.B, n int) []byte {
+	c := decodeFile(b, "data/hand.wav")
+	data := c.FindChunk(NewID("data"))
+	data.Data = bytes.Repeat(data.Data, n)
+	c.UpdateLengths()
+	buf := new(bytes.Buffer)
+	if _, err := c.WriteTo(buf); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkDecodeStream(b *testing.B) {
+	file := scaledWAV(b, 1000)
+	b.SetBytes(int64(len(file)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewDecoder(bytes.NewReader(file)).Decode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+	file := scaledWAV(b, 1000)
+	b.SetBytes(int64(len(file)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewBytesDecoder(file).Decode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}